@@ -0,0 +1,146 @@
+package backfill
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	repo "src/repository"
+	"src/utils"
+)
+
+// UserReport counts the poops found in an export for one member
+type UserReport struct {
+	UserID int64
+	Name   string
+	// Found is every poop in the export, Added the ones that weren't logged yet
+	Found int
+	Added int
+}
+
+// Report summarises an import, per member
+type Report struct {
+	ChatID int64
+	DryRun bool
+	Users  []UserReport
+}
+
+// Import logs every poop in the export that isn't logged yet, keyed by the original message ID so running it again adds nothing.
+// A dry run only reports what would be added.
+func Import(ctx context.Context, r repo.Repository, chatID int64, export *Export, loc *time.Location, dryRun bool) (Report, error) {
+	users := make(map[int64]*UserReport)
+	for _, message := range export.Messages {
+		userID, ok := message.UserID()
+		if !ok || !utils.IsPoop(string(message.Text), message.stickerEmoji()) {
+			continue
+		}
+
+		sentAt, err := message.SentAt(loc)
+		if err != nil {
+			return Report{}, err
+		}
+
+		user, ok := users[userID]
+		if !ok {
+			user = &UserReport{UserID: userID}
+			users[userID] = user
+		}
+		// Keep the latest name the member posted under
+		user.Name = message.From
+		user.Found++
+
+		added, err := importPoop(ctx, r, chatID, userID, message, sentAt.UTC(), dryRun)
+		if err != nil {
+			return Report{}, err
+		}
+		if added {
+			user.Added++
+		}
+	}
+
+	report := Report{ChatID: chatID, DryRun: dryRun}
+	for _, user := range users {
+		if !dryRun {
+			if err := recordImportedUser(ctx, r, *user); err != nil {
+				return Report{}, err
+			}
+		}
+		report.Users = append(report.Users, *user)
+	}
+	sort.Slice(report.Users, func(i, j int) bool {
+		if report.Users[i].Added != report.Users[j].Added {
+			return report.Users[i].Added > report.Users[j].Added
+		}
+		return report.Users[i].UserID < report.Users[j].UserID
+	})
+	return report, nil
+}
+
+// recordImportedUser names members the bot never saw after the name they have in the export.
+// Exports only have display names, not @usernames, so the name is a first name with no sighting time,
+// it never replaces a name the bot saw and any later sighting replaces it.
+func recordImportedUser(ctx context.Context, r repo.Repository, user UserReport) error {
+	err := r.UpsertUser(ctx, repo.User{UserID: user.UserID, FirstName: user.Name})
+	if err != nil {
+		return fmt.Errorf("failed to record user %d: %w", user.UserID, err)
+	}
+	return nil
+}
+
+// importPoop logs a poop from the export. It's logged without a username, logs keep @usernames and exports don't have them.
+func importPoop(ctx context.Context, r repo.Repository, chatID int64, userID int64, message Message, sentAt time.Time, dryRun bool) (bool, error) {
+	if dryRun {
+		// LogPoop leaves the message alone when it was logged, or backfilled from a forward it takes the log of
+		logged, err := r.IsPoopLogged(ctx, chatID, message.ID)
+		if err != nil {
+			return false, fmt.Errorf("failed to check message %d: %w", message.ID, err)
+		}
+		if !logged {
+			logged, err = r.IsForwardLogged(ctx, chatID, userID, sentAt.Unix())
+			if err != nil {
+				return false, fmt.Errorf("failed to check message %d: %w", message.ID, err)
+			}
+		}
+		return !logged, nil
+	}
+
+	err := r.LogPoop(ctx, chatID, userID, "", message.ID, sentAt.Format("2006-01-02 15:04:05"), sentAt.Unix())
+	if errors.Is(err, repo.ErrPoopAlreadyLogged) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to log message %d: %w", message.ID, err)
+	}
+	return true, nil
+}
+
+// Write prints the report as a table
+func (r Report) Write(w io.Writer) error {
+	action := "Added"
+	if r.DryRun {
+		action = "Would add"
+	}
+
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(table, "User ID\tName\tFound\t%s\n", action)
+	found, added := 0, 0
+	for _, user := range r.Users {
+		fmt.Fprintf(table, "%d\t%s\t%d\t%d\n", user.UserID, user.Name, user.Found, user.Added)
+		found += user.Found
+		added += user.Added
+	}
+	fmt.Fprintf(table, "Total\t\t%d\t%d\n", found, added)
+	if err := table.Flush(); err != nil {
+		return err
+	}
+
+	if r.DryRun {
+		_, err := fmt.Fprintf(w, "Dry run, nothing was written to chat %d.\n", r.ChatID)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,229 @@
+package backfill
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"src/config"
+	repo "src/repository"
+)
+
+const testChatID = int64(-1001234567890)
+
+func loadTestExport(t *testing.T) *Export {
+	t.Helper()
+	file, err := os.Open("testdata/result.json")
+	if err != nil {
+		t.Fatalf("Failed to open export: %v", err)
+	}
+	defer file.Close()
+
+	export, err := ParseExport(file)
+	if err != nil {
+		t.Fatalf("ParseExport() error = %v", err)
+	}
+	return export
+}
+
+func setupTestRepository(t *testing.T) repo.Repository {
+	t.Helper()
+	db, err := repo.OpenDBConnection(&config.Config{DBPath: filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	r := repo.NewRepository(db)
+	if err := r.RegisterGroup(context.Background(), testChatID, "Poopers", "UTC"); err != nil {
+		t.Fatalf("Failed to register test group: %v", err)
+	}
+	return r
+}
+
+func TestParseExport(t *testing.T) {
+	export := loadTestExport(t)
+
+	chatID, err := export.ChatID()
+	if err != nil || chatID != testChatID {
+		t.Errorf("ChatID() = %d, %v, want %d", chatID, err, testChatID)
+	}
+	if len(export.Messages) != 7 {
+		t.Fatalf("ParseExport() read %d messages, want 7", len(export.Messages))
+	}
+	if text := string(export.Messages[3].Text); text != "💩 again" {
+		t.Errorf("formatted text = %q, want the parts joined", text)
+	}
+	if _, ok := export.Messages[0].UserID(); ok {
+		t.Error("UserID() of a service message is ok")
+	}
+	if _, ok := export.Messages[5].UserID(); ok {
+		t.Error("UserID() of a channel post is ok")
+	}
+	if userID, ok := export.Messages[1].UserID(); !ok || userID != 1001 {
+		t.Errorf("UserID() = %d, %v, want 1001", userID, ok)
+	}
+
+	old := Message{ID: 1, Date: "2024-12-31T08:00:00"}
+	lisbon, _ := time.LoadLocation("Europe/Lisbon")
+	sentAt, err := old.SentAt(lisbon)
+	if err != nil || !sentAt.Equal(time.Date(2024, 12, 31, 8, 0, 0, 0, time.UTC)) {
+		t.Errorf("SentAt() without a unix time = %v, %v", sentAt, err)
+	}
+}
+
+func TestExportChatID(t *testing.T) {
+	tests := []struct {
+		exportType string
+		want       int64
+		wantErr    bool
+	}{
+		{exportType: "private_supergroup", want: -1001234567890},
+		{exportType: "public_supergroup", want: -1001234567890},
+		{exportType: "private_group", want: -1234567890},
+		{exportType: "personal_chat", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.exportType, func(t *testing.T) {
+			export := Export{Type: tt.exportType, ID: 1234567890}
+			got, err := export.ChatID()
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("ChatID() = %d, %v, want %d", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestImport(t *testing.T) {
+	r := setupTestRepository(t)
+	ctx := context.Background()
+	export := loadTestExport(t)
+
+	// The bot was running for the last message, which alice then deleted
+	if err := r.LogPoop(ctx, testChatID, 1001, "alice", 7, "2025-01-01 00:30:00", 1735691400); err != nil {
+		t.Fatalf("LogPoop() error = %v", err)
+	}
+	if err := r.DeletePoop(ctx, testChatID, 7, 1001, time.Now().Unix()); err != nil {
+		t.Fatalf("DeletePoop() error = %v", err)
+	}
+	if err := r.UpsertUser(ctx, repo.User{UserID: 1001, Username: "alice", FirstName: "Alice", LastSeenUnix: 1735691400}); err != nil {
+		t.Fatalf("UpsertUser() error = %v", err)
+	}
+
+	dryRun, err := Import(ctx, r, testChatID, export, time.UTC, true)
+	if err != nil {
+		t.Fatalf("Import() dry run error = %v", err)
+	}
+	want := []UserReport{
+		{UserID: 1001, Name: "Alice L.", Found: 2, Added: 1},
+		{UserID: 1002, Name: "Bob", Found: 1, Added: 1},
+	}
+	assertUsers(t, dryRun.Users, want)
+	if count, _ := r.GetYearlyPoopCount(ctx, testChatID, 1002, 2024); count != 0 {
+		t.Errorf("the dry run logged %d poops for bob", count)
+	}
+
+	var out bytes.Buffer
+	if err := dryRun.Write(&out); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if !strings.Contains(out.String(), "Would add") || !strings.Contains(out.String(), "Dry run") {
+		t.Errorf("dry run report = %q, want it marked as a dry run", out.String())
+	}
+
+	report, err := Import(ctx, r, testChatID, export, time.UTC, false)
+	if err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+	assertUsers(t, report.Users, want)
+
+	for userID, wantCount := range map[int64]int{1001: 1, 1002: 1} {
+		count, err := r.GetYearlyPoopCount(ctx, testChatID, userID, 2024)
+		if err != nil || count != wantCount {
+			t.Errorf("GetYearlyPoopCount(%d) = %d, %v, want %d", userID, count, err, wantCount)
+		}
+	}
+	// Alice keeps the name the bot saw her with, bob, who the bot never saw, goes by his name in the export
+	leaderboard, err := r.GetLeaderboard(ctx, testChatID, repo.YearPeriod(2024), repo.MostPoopsFirst, 0)
+	if err != nil {
+		t.Fatalf("GetLeaderboard() error = %v", err)
+	}
+	names := map[string]bool{}
+	for _, user := range leaderboard {
+		names[user.Username] = true
+	}
+	if len(names) != 2 || !names["alice"] || !names["Bob"] {
+		t.Errorf("leaderboard after the import = %+v, want alice and Bob", leaderboard)
+	}
+	if user, err := r.GetUser(ctx, 1001); err != nil || user.Username != "alice" || user.FirstName != "Alice" {
+		t.Errorf("GetUser() of alice = %+v, %v, want the import to leave her alone", user, err)
+	}
+	if user, err := r.GetUser(ctx, 1002); err != nil || user.Username != "" || user.FirstName != "Bob" {
+		t.Errorf("GetUser() of bob = %+v, %v, want him recorded by his name in the export", user, err)
+	}
+	if members, err := r.FindMembersByName(ctx, testChatID, "Bob"); err != nil || len(members) != 1 {
+		t.Errorf("FindMembersByName() = %+v, %v, want bob, so his hidden forwards can be backfilled", members, err)
+	}
+
+	// The deleted log stays deleted
+	if count, _ := r.GetYearlyPoopCount(ctx, testChatID, 1001, 2025); count != 0 {
+		t.Errorf("the import brought back alice's deleted poop")
+	}
+
+	again, err := Import(ctx, r, testChatID, export, time.UTC, false)
+	if err != nil {
+		t.Fatalf("second Import() error = %v", err)
+	}
+	for _, user := range again.Users {
+		if user.Added != 0 {
+			t.Errorf("second Import() added %d poops for %d, want none", user.Added, user.UserID)
+		}
+	}
+}
+
+func TestImport_ReconcilesForwards(t *testing.T) {
+	r := setupTestRepository(t)
+	ctx := context.Background()
+	export := loadTestExport(t)
+
+	// Bob's sticker was backfilled from a forward that hid where it came from
+	forward := repo.ForwardedPoop{ChatID: testChatID, UserID: 1002, Username: "Bob", SentAtUnix: 1735637400, ForwardMessageID: 9}
+	if err := r.LogForwardedPoop(ctx, forward); err != nil {
+		t.Fatalf("LogForwardedPoop() error = %v", err)
+	}
+
+	want := []UserReport{
+		{UserID: 1001, Name: "Alice L.", Found: 2, Added: 2},
+		{UserID: 1002, Name: "Bob", Found: 1, Added: 0},
+	}
+	dryRun, err := Import(ctx, r, testChatID, export, time.UTC, true)
+	if err != nil {
+		t.Fatalf("Import() dry run error = %v", err)
+	}
+	assertUsers(t, dryRun.Users, want)
+
+	report, err := Import(ctx, r, testChatID, export, time.UTC, false)
+	if err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+	assertUsers(t, report.Users, want)
+	if count, err := r.GetYearlyPoopCount(ctx, testChatID, 1002, 2024); err != nil || count != 1 {
+		t.Errorf("GetYearlyPoopCount() of bob = %d, %v, want his forward counted once", count, err)
+	}
+}
+
+func assertUsers(t *testing.T, got []UserReport, want []UserReport) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("users = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("user %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
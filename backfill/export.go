@@ -0,0 +1,123 @@
+// Package backfill imports poops from Telegram Desktop chat exports, for logs from before the bot existed or while it was down.
+package backfill
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Export is the result.json Telegram Desktop writes when exporting a chat as JSON
+type Export struct {
+	Name     string    `json:"name"`
+	Type     string    `json:"type"`
+	ID       int64     `json:"id"`
+	Messages []Message `json:"messages"`
+}
+
+// Message is an exported message, only the fields the importer needs
+type Message struct {
+	ID           int64  `json:"id"`
+	Type         string `json:"type"`
+	Date         string `json:"date"`
+	DateUnixtime string `json:"date_unixtime"`
+	From         string `json:"from"`
+	FromID       string `json:"from_id"`
+	Text         Text   `json:"text"`
+	MediaType    string `json:"media_type"`
+	StickerEmoji string `json:"sticker_emoji"`
+}
+
+// Text is a message's text, which exports write as a string or, for formatted messages, as an array of strings and entities
+type Text string
+
+func (t *Text) UnmarshalJSON(data []byte) error {
+	var plain string
+	if err := json.Unmarshal(data, &plain); err == nil {
+		*t = Text(plain)
+		return nil
+	}
+
+	var parts []json.RawMessage
+	if err := json.Unmarshal(data, &parts); err != nil {
+		return fmt.Errorf("text is neither a string nor an array: %w", err)
+	}
+
+	var text strings.Builder
+	for _, part := range parts {
+		var entity struct {
+			Text string `json:"text"`
+		}
+		if err := json.Unmarshal(part, &plain); err == nil {
+			text.WriteString(plain)
+		} else if err := json.Unmarshal(part, &entity); err == nil {
+			text.WriteString(entity.Text)
+		} else {
+			return fmt.Errorf("invalid text entity: %w", err)
+		}
+	}
+	*t = Text(text.String())
+	return nil
+}
+
+// ParseExport reads a result.json export
+func ParseExport(r io.Reader) (*Export, error) {
+	var export Export
+	if err := json.NewDecoder(r).Decode(&export); err != nil {
+		return nil, fmt.Errorf("failed to parse export: %w", err)
+	}
+	return &export, nil
+}
+
+// ChatID is the ID the Bot API knows the exported chat by.
+// Exports leave out the -100 prefix of supergroups and the minus sign of basic groups.
+func (e *Export) ChatID() (int64, error) {
+	switch e.Type {
+	case "public_supergroup", "private_supergroup":
+		return -1_000_000_000_000 - e.ID, nil
+	case "private_group":
+		return -e.ID, nil
+	default:
+		return 0, fmt.Errorf("can't import a chat of type %q, only groups", e.Type)
+	}
+}
+
+// UserID returns the Telegram user who sent the message, false for service messages and posts by channels
+func (m Message) UserID() (int64, bool) {
+	if m.Type != "message" || !strings.HasPrefix(m.FromID, "user") {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(strings.TrimPrefix(m.FromID, "user"), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return id, true
+}
+
+// SentAt is when the message was posted. Older exports only have the date in the exporting computer's timezone, which is read in loc.
+func (m Message) SentAt(loc *time.Location) (time.Time, error) {
+	if m.DateUnixtime != "" {
+		unix, err := strconv.ParseInt(m.DateUnixtime, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid date_unixtime %q of message %d", m.DateUnixtime, m.ID)
+		}
+		return time.Unix(unix, 0), nil
+	}
+
+	sentAt, err := time.ParseInLocation("2006-01-02T15:04:05", m.Date, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q of message %d", m.Date, m.ID)
+	}
+	return sentAt, nil
+}
+
+// stickerEmoji is the emoji of a sticker message, empty for other messages
+func (m Message) stickerEmoji() string {
+	if m.MediaType != "sticker" {
+		return ""
+	}
+	return m.StickerEmoji
+}
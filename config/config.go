@@ -2,9 +2,13 @@ package config
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"strconv"
+	"strings"
+	"time"
+
+	"src/utils"
 
 	dotenv "github.com/joho/godotenv"
 )
@@ -13,19 +17,57 @@ type Config struct {
 	TelegramToken string
 	DBPath        string
 	GroupChatID   int64
+	GroupChatIDs  []int64
 	MyChatID      int64
 
-	StickerIDs map[string]string
+	// DefaultTimezone is the IANA timezone newly registered groups start with
+	DefaultTimezone string
+
+	// UndoGracePeriod is how long after logging a poop /undo can still retract it
+	UndoGracePeriod time.Duration
+
+	// InactivityThreshold is how long a member can go without logging before the bot checks on them, zero disables check-ins
+	InactivityThreshold time.Duration
+	// InactivityCheckInDM sends check-ins as a private message instead of a mention in the group
+	InactivityCheckInDM bool
+
+	// WellnessThreshold is how many poops in a local day are fine, logging more triggers a wellness alert, zero disables it
+	WellnessThreshold int
+	// WellnessEscalationThreshold triggers a second, more worried alert above this many poops, zero disables it
+	WellnessEscalationThreshold int
+
+	// ReactionRulesPath points to an optional JSON file of reaction rules, sticker reactions live in the database
+	ReactionRulesPath string
+
+	// APIBaseURL is the Bot API root the token and method are appended to, overridden to run against a local server
 	APIBaseURL string
+
+	// UpdateMode is how updates are received, "polling" or "webhook"
+	UpdateMode string
+	// WebhookURL is the public HTTPS URL Telegram posts updates to, its path is also the local endpoint
+	WebhookURL string
+	// WebhookListenAddr is the local address the webhook server listens on
+	WebhookListenAddr string
+	// WebhookSecret is sent back by Telegram in X-Telegram-Bot-Api-Secret-Token to prove updates are genuine
+	WebhookSecret string
+
+	// MonitoringListenAddr is where /healthz and /metrics are served, empty disables them
+	MonitoringListenAddr string
+
+	// LogLevel is the least severe level logged, one of debug, info, warn or error
+	LogLevel slog.Level
 }
 
+const (
+	UpdateModePolling = "polling"
+	UpdateModeWebhook = "webhook"
+)
+
 // LoadConfig loads configuration from environment variables
 func LoadConfig() (*Config, error) {
 	_ = dotenv.Load(".env")
 
-	cfg := &Config{
-		StickerIDs: make(map[string]string),
-	}
+	cfg := &Config{}
 
 	cfg.TelegramToken = os.Getenv("TELEGRAM_TOKEN")
 	if cfg.TelegramToken == "" {
@@ -46,7 +88,23 @@ func LoadConfig() (*Config, error) {
 		cfg.GroupChatID = groupChatID
 	} else {
 		cfg.GroupChatID = -1002481034087
-		log.Println("Warning: GROUP_CHAT_ID not set, using default value")
+		slog.Warn("GROUP_CHAT_ID not set, using default value", "group_chat_id", cfg.GroupChatID)
+	}
+
+	// GroupChatID is always served, GROUP_CHAT_IDS adds more groups to the same deployment
+	cfg.GroupChatIDs = []int64{cfg.GroupChatID}
+	for _, idStr := range strings.Split(os.Getenv("GROUP_CHAT_IDS"), ",") {
+		idStr = strings.TrimSpace(idStr)
+		if idStr == "" {
+			continue
+		}
+		chatID, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid GROUP_CHAT_IDS entry %q: %w", idStr, err)
+		}
+		if chatID != cfg.GroupChatID {
+			cfg.GroupChatIDs = append(cfg.GroupChatIDs, chatID)
+		}
 	}
 
 	myChatIDStr := os.Getenv("MY_CHAT_ID")
@@ -58,19 +116,104 @@ func LoadConfig() (*Config, error) {
 		cfg.MyChatID = myChatID
 	} else {
 		cfg.MyChatID = 824870685
-		log.Println("Warning: MY_CHAT_ID not set, using default value")
+		slog.Warn("MY_CHAT_ID not set, using default value", "my_chat_id", cfg.MyChatID)
 	}
 
-	cfg.StickerIDs = map[string]string{
-		"struggle": "AgADOxkAAgTYWVE",
-		"esnoopi":  "AgADRhoAAhq7WVE",
-		"jurassic": "AgADQRcAAu99WVE",
-		"girly":    "AgADrxkAAtHnYFE",
-		"scared":   "AgADfBkAAgwIYVE",
-		"sus":      "AgADcxgAAvVG0FE",
+	cfg.DefaultTimezone = os.Getenv("DEFAULT_TIMEZONE")
+	if cfg.DefaultTimezone == "" {
+		cfg.DefaultTimezone = "UTC"
+	}
+	if err := utils.ValidateTimezone(cfg.DefaultTimezone); err != nil {
+		return nil, fmt.Errorf("invalid DEFAULT_TIMEZONE: %w", err)
 	}
 
-	cfg.APIBaseURL = "https://api.telegram.org/bot"
+	cfg.UndoGracePeriod = 15 * time.Minute
+	if gracePeriodStr := os.Getenv("UNDO_GRACE_PERIOD"); gracePeriodStr != "" {
+		gracePeriod, err := time.ParseDuration(gracePeriodStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid UNDO_GRACE_PERIOD: %w", err)
+		}
+		cfg.UndoGracePeriod = gracePeriod
+	}
+
+	cfg.InactivityThreshold = 48 * time.Hour
+	if thresholdStr := os.Getenv("INACTIVITY_THRESHOLD"); thresholdStr != "" {
+		threshold, err := time.ParseDuration(thresholdStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid INACTIVITY_THRESHOLD: %w", err)
+		}
+		cfg.InactivityThreshold = threshold
+	}
+
+	if dmStr := os.Getenv("INACTIVITY_CHECKIN_DM"); dmStr != "" {
+		dm, err := strconv.ParseBool(dmStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid INACTIVITY_CHECKIN_DM: %w", err)
+		}
+		cfg.InactivityCheckInDM = dm
+	}
+
+	cfg.WellnessThreshold = 4
+	if thresholdStr := os.Getenv("WELLNESS_THRESHOLD"); thresholdStr != "" {
+		threshold, err := strconv.Atoi(thresholdStr)
+		if err != nil || threshold < 0 {
+			return nil, fmt.Errorf("invalid WELLNESS_THRESHOLD: %q", thresholdStr)
+		}
+		cfg.WellnessThreshold = threshold
+	}
+
+	if thresholdStr := os.Getenv("WELLNESS_ESCALATION_THRESHOLD"); thresholdStr != "" {
+		threshold, err := strconv.Atoi(thresholdStr)
+		if err != nil || threshold < 0 {
+			return nil, fmt.Errorf("invalid WELLNESS_ESCALATION_THRESHOLD: %q", thresholdStr)
+		}
+		// The escalation follows the first alert, so it can only come after it
+		if threshold != 0 && threshold <= cfg.WellnessThreshold {
+			return nil, fmt.Errorf("WELLNESS_ESCALATION_THRESHOLD (%d) must be above WELLNESS_THRESHOLD (%d)", threshold, cfg.WellnessThreshold)
+		}
+		cfg.WellnessEscalationThreshold = threshold
+	}
+
+	cfg.ReactionRulesPath = os.Getenv("REACTION_RULES_PATH")
+
+	cfg.APIBaseURL = os.Getenv("TELEGRAM_API_BASE_URL")
+	if cfg.APIBaseURL == "" {
+		cfg.APIBaseURL = "https://api.telegram.org/bot"
+	}
+
+	cfg.UpdateMode = strings.ToLower(os.Getenv("UPDATE_MODE"))
+	if cfg.UpdateMode == "" {
+		cfg.UpdateMode = UpdateModePolling
+	}
+	switch cfg.UpdateMode {
+	case UpdateModePolling:
+	case UpdateModeWebhook:
+		cfg.WebhookURL = os.Getenv("WEBHOOK_URL")
+		if cfg.WebhookURL == "" {
+			return nil, fmt.Errorf("WEBHOOK_URL is not set")
+		}
+		cfg.WebhookSecret = os.Getenv("WEBHOOK_SECRET")
+		if cfg.WebhookSecret == "" {
+			return nil, fmt.Errorf("WEBHOOK_SECRET is not set")
+		}
+		cfg.WebhookListenAddr = os.Getenv("WEBHOOK_LISTEN_ADDR")
+		if cfg.WebhookListenAddr == "" {
+			cfg.WebhookListenAddr = ":8080"
+		}
+	default:
+		return nil, fmt.Errorf("invalid UPDATE_MODE %q, expected %q or %q", cfg.UpdateMode, UpdateModePolling, UpdateModeWebhook)
+	}
+
+	cfg.MonitoringListenAddr = ":9091"
+	if addr, ok := os.LookupEnv("MONITORING_LISTEN_ADDR"); ok {
+		cfg.MonitoringListenAddr = addr
+	}
+
+	if levelStr := os.Getenv("LOG_LEVEL"); levelStr != "" {
+		if err := cfg.LogLevel.UnmarshalText([]byte(levelStr)); err != nil {
+			return nil, fmt.Errorf("invalid LOG_LEVEL: %w", err)
+		}
+	}
 
 	return cfg, nil
 }
@@ -2,11 +2,12 @@ package formatters
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 	"strings"
 	"time"
 
 	repo "src/repository"
+	"src/scheduler"
 )
 
 // daysInMonth calculates the number of days in a given month and year using time package
@@ -48,34 +49,84 @@ func parseMonthString(monthStr string) (time.Month, error) {
 	}
 }
 
+// markdownV2Escaper escapes every character MarkdownV2 treats as special. It replaces in a single pass,
+// so the backslashes it adds aren't escaped again.
+var markdownV2Escaper = strings.NewReplacer(
+	"\\", "\\\\",
+	"_", "\\_",
+	"*", "\\*",
+	"[", "\\[",
+	"]", "\\]",
+	"(", "\\(",
+	")", "\\)",
+	"~", "\\~",
+	"`", "\\`",
+	">", "\\>",
+	"<", "\\<",
+	"#", "\\#",
+	"+", "\\+",
+	"-", "\\-",
+	"=", "\\=",
+	"|", "\\|",
+	"{", "\\{",
+	"}", "\\}",
+	".", "\\.",
+	"!", "\\!",
+)
+
+// EscapeMarkdownV2 escapes free text, like members' names, for use in a MarkdownV2 message
 func EscapeMarkdownV2(s string) string {
-	s = strings.ReplaceAll(s, "_", "\\_")
-	s = strings.ReplaceAll(s, "-", "\\-")
-	s = strings.ReplaceAll(s, ".", "\\.")
-	s = strings.ReplaceAll(s, "!", "\\!")
-	s = strings.ReplaceAll(s, "(", "\\(")
-	s = strings.ReplaceAll(s, ")", "\\)")
-	s = strings.ReplaceAll(s, "[", "\\[")
-	s = strings.ReplaceAll(s, "]", "\\]")
-	s = strings.ReplaceAll(s, "{", "\\{")
-	s = strings.ReplaceAll(s, "}", "\\}")
-	s = strings.ReplaceAll(s, "=", "\\=")
-	s = strings.ReplaceAll(s, "+", "\\+")
-	s = strings.ReplaceAll(s, ">", "\\>")
-	s = strings.ReplaceAll(s, "<", "\\<")
-	s = strings.ReplaceAll(s, "|", "\\|")
-	return s
-}
-
-func BuildPoodiumMessage(topPoopers []repo.UserPoopCount) string {
-	if len(topPoopers) < 3 {
+	return markdownV2Escaper.Replace(s)
+}
+
+// medals are handed out by rank, members sharing a rank share its medal
+var medals = []string{"🥇", "🥈", "🥉"}
+
+// joinNames lists names as "a", "a and b" or "a, b and c"
+func joinNames(names []string) string {
+	if len(names) <= 1 {
+		return strings.Join(names, "")
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+}
+
+// formatPodiumTies calls out every medal shared by several members, so nobody wonders who got placed first
+func formatPodiumTies(leaderboard []repo.UserPoopCount) string {
+	var ties []string
+	for rank, medal := range medals {
+		var names []string
+		count := 0
+		for _, user := range leaderboard {
+			if user.Rank == rank+1 {
+				names = append(names, EscapeMarkdownV2(user.Username))
+				count = user.PoopCount
+			}
+		}
+		if len(names) > 1 {
+			ties = append(ties, fmt.Sprintf("🤝 %s are tied for %s with %d💩 each\\.", joinNames(names), medal, count))
+		}
+	}
+	return strings.Join(ties, "\n")
+}
+
+// BuildPoodiumMessage lists the members on the podium, it works with any number of them and calls out ties
+func BuildPoodiumMessage(podium []repo.UserPoopCount) string {
+	var lines []string
+	for _, user := range podium {
+		if user.Rank < 1 || user.Rank > len(medals) {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s %s \\- %d💩", medals[user.Rank-1], EscapeMarkdownV2(user.Username), user.PoopCount))
+	}
+	if len(lines) == 0 {
 		return "Not enough data for poodium\\."
 	}
 
-	escape := EscapeMarkdownV2
-	return "🥇 " + escape(topPoopers[0].Username) + " \\- " + fmt.Sprint(topPoopers[0].PoopCount) + "💩\n" +
-		"🥈 " + escape(topPoopers[1].Username) + " \\- " + fmt.Sprint(topPoopers[1].PoopCount) + "💩\n" +
-		"🥉 " + escape(topPoopers[2].Username) + " \\- " + fmt.Sprint(topPoopers[2].PoopCount) + "💩"
+	msg := strings.Join(lines, "\n")
+	if ties := formatPodiumTies(podium); ties != "" {
+		msg += "\n\n" + ties
+	}
+	return msg
 }
 
 func FormatPoopLog(username string, globalPoopCount int, monthlyPoopCounts []repo.MonthlyPoopCount, daysWithoutPoop int, maxStreak int, day string, poops int) string {
@@ -88,7 +139,7 @@ func FormatPoopLog(username string, globalPoopCount int, monthlyPoopCounts []rep
 		monthStr := yearMonth[5:]
 		month, err := parseMonthString(monthStr)
 		if err != nil {
-			log.Printf("Invalid month string: %s", monthStr)
+			slog.Warn("Invalid month string", "month", monthStr)
 			continue
 		}
 
@@ -118,7 +169,7 @@ func FormatPoopLog(username string, globalPoopCount int, monthlyPoopCounts []rep
 		monthStr := yearMonth[5:]
 		month, err := parseMonthString(monthStr)
 		if err != nil {
-			log.Printf("Invalid month string: %s", monthStr)
+			slog.Warn("Invalid month string", "month", monthStr)
 			continue
 		}
 		monthName := month.String()
@@ -128,8 +179,27 @@ func FormatPoopLog(username string, globalPoopCount int, monthlyPoopCounts []rep
 	return msg
 }
 
-func FormatLeaderboard(leaderboard []repo.UserPoopCount) string {
-	msg := "This month's leaderboard:\n"
+// FormatPeriod names a period the way people say it, e.g. "March 2025" or "the week of 10 March 2025"
+func FormatPeriod(period repo.Period) string {
+	const day = "2 January 2006"
+	switch period.Kind {
+	case repo.PeriodYear:
+		return period.Start.Format("2006")
+	case repo.PeriodMonth:
+		return period.Start.Format("January 2006")
+	case repo.PeriodWeek:
+		return "the week of " + period.Start.Format(day)
+	default:
+		return period.Start.Format(day) + " to " + period.LastDay().Format(day)
+	}
+}
+
+func FormatLeaderboard(period repo.Period, leaderboard []repo.UserPoopCount) string {
+	if len(leaderboard) == 0 {
+		return fmt.Sprintf("Nobody logged a 💩 in %s\\.", EscapeMarkdownV2(FormatPeriod(period)))
+	}
+
+	msg := fmt.Sprintf("Leaderboard for %s:\n", EscapeMarkdownV2(FormatPeriod(period)))
 	for _, user := range leaderboard {
 		escapedUsername := EscapeMarkdownV2(user.Username)
 		msg += fmt.Sprintf("\t\t\t• %s \\- %d💩\n", escapedUsername, user.PoopCount)
@@ -145,27 +215,295 @@ func FormatHelpMessage(isUnknownCommand bool) string {
 	message += "Here are the commands I understand:\n" +
 		"\t\t\t\t• _/help_ \\- Get a list of available commands\n" +
 		"\t\t\t\t• _/my\\_poop\\_log_ \\- Get your personal monthly poop statistics\n" +
-		"\t\t\t\t• _/leaderboard_ \\- Get the monthly leaderboard\n" +
+		"\t\t\t\t• _/leaderboard \\[period\\]_ \\- Get this month's leaderboard, or a week, month, year or date range's\n" +
+		"\t\t\t\t• _/leaderboard\\_week_ \\- Get this week's leaderboard\n" +
 		"\t\t\t\t• _/bottom\\_poopers_ \\- Get the reverse poodium\n" +
 		"\t\t\t\t• _/poodium_ \\- Get the monthly poodium\n" +
-		"\t\t\t\t• _/poodium\\_year_ \\- Get the yearly poodium" +
-		"\t\t\t\t• _/poop\\_wrapped_ \\- Get your personalized Poop Wrapped"
+		"\t\t\t\t• _/poodium\\_year_ \\- Get the yearly poodium\n" +
+		"\t\t\t\t• _/poop\\_wrapped \\[year\\]_ \\- Get your personalized Poop Wrapped\n" +
+		"\t\t\t\t• _/group\\_wrapped \\[year\\]_ \\- Get the group's year in review and awards\n" +
+		"\t\t\t\t• _/undo_ \\- Remove the poop you just logged\n" +
+		"\t\t\t\t• _/delete\\_poop_ \\- Reply to a poop to remove it\n" +
+		"\t\t\t\t• _/timezone \\[zone\\]_ \\- Show the group's timezone, or set it if you're the admin\n" +
+		"\t\t\t\t• _/my\\_timezone \\[zone\\|reset\\]_ \\- Show or override your own timezone\n" +
+		"\t\t\t\t• _/checkins \\[on\\|off\\]_ \\- Choose whether I check on you when you stop logging\n" +
+		"\t\t\t\t• _/stickers_ \\- List the stickers I react to\n" +
+		"\t\t\t\t• _/export\\_my\\_data \\[csv\\|json\\]_ \\- Get every poop you logged as a file"
 	return message
 }
 
-func FormatPoodiumTitle(monthName string) string {
-	return "🏆 Poodium for " + monthName + " 🏆\n"
+// escapeCode escapes text for use inside a MarkdownV2 code span
+func escapeCode(s string) string {
+	s = strings.ReplaceAll(s, "\\", "\\\\")
+	return strings.ReplaceAll(s, "`", "\\`")
+}
+
+func FormatGroupTimezone(timezone string) string {
+	return fmt.Sprintf("🕰 This group's timezone is `%s`\\.\nThe admin can change it with _/timezone Europe/Lisbon_\\.", escapeCode(timezone))
+}
+
+func FormatGroupTimezoneUpdated(timezone string) string {
+	return fmt.Sprintf("🕰 Group timezone set to `%s`\\. Days, months and years now follow it\\.", escapeCode(timezone))
+}
+
+func FormatUserTimezone(timezone string, groupTimezone string) string {
+	if timezone == "" {
+		return fmt.Sprintf("🕰 You follow the group's timezone, `%s`\\.\nUse _/my\\_timezone America/New\\_York_ to override it\\.", escapeCode(groupTimezone))
+	}
+	return fmt.Sprintf("🕰 Your timezone is `%s`\\.\nUse _/my\\_timezone reset_ to follow the group's timezone again\\.", escapeCode(timezone))
+}
+
+func FormatUserTimezoneUpdated(timezone string) string {
+	if timezone == "" {
+		return "🕰 Timezone override removed, you now follow the group's timezone\\."
+	}
+	return fmt.Sprintf("🕰 Your timezone is now `%s`\\.", escapeCode(timezone))
+}
+
+func FormatInvalidTimezone(timezone string) string {
+	return fmt.Sprintf("Sorry, `%s` isn't a timezone I know\\. Use an IANA name such as `Europe/Lisbon`\\.", escapeCode(timezone))
+}
+
+// FormatMention links to a user so Telegram notifies them, even if they have no username
+func FormatMention(userID int64, username string) string {
+	name := "friend"
+	if username != "" {
+		name = "@" + username
+	}
+	return fmt.Sprintf("[%s](tg://user?id=%d)", EscapeMarkdownV2(name), userID)
+}
+
+func FormatInactivityCheckIn(userID int64, username string, silence time.Duration) string {
+	days := int(silence.Hours() / 24)
+	return fmt.Sprintf("👋 Hey %s, we haven't seen a 💩 from you in %d days\\. Is everything ok?\n"+
+		"_Use /checkins off if you'd rather I didn't ask\\._", FormatMention(userID, username), days)
+}
+
+func FormatCheckInsStatus(enabled bool) string {
+	if enabled {
+		return "👋 I'll check on you if you stop logging\\. Use _/checkins off_ to stop me\\."
+	}
+	return "🙈 I won't check on you when you stop logging\\. Use _/checkins on_ to change that\\."
+}
+
+func FormatWellnessAlert(userID int64, username string, count int) string {
+	return fmt.Sprintf("🫶 %s, that's %d poops today\\. Is everything ok? Remember to drink plenty of water 💧", FormatMention(userID, username), count)
+}
+
+func FormatWellnessEscalation(userID int64, username string, count int) string {
+	return fmt.Sprintf("🚨 %s, %d poops in one day is a lot\\. If this keeps up, please consider seeing a doctor 🩺", FormatMention(userID, username), count)
+}
+
+func FormatStickerRegistered(sticker repo.Sticker) string {
+	return fmt.Sprintf("✅ I'll react to that sticker with %s from now on\\.", EscapeMarkdownV2(sticker.Emoji))
+}
+
+func FormatStickers(stickers []repo.Sticker) string {
+	if len(stickers) == 0 {
+		return "No stickers are registered yet\\. Reply to one with _/register\\_sticker 🎉_\\."
+	}
+
+	msg := "*Sticker reactions:*\n"
+	for _, sticker := range stickers {
+		set := sticker.SetName
+		if set == "" {
+			set = "no set"
+		}
+		msg += fmt.Sprintf("\t\t\t• %s `%s` \\(%s\\)\n", EscapeMarkdownV2(sticker.Emoji), escapeCode(sticker.FileUniqueID), EscapeMarkdownV2(set))
+	}
+	return msg
+}
+
+func FormatInvalidExportFormat(format string) string {
+	return fmt.Sprintf("I can't export `%s`\\. Use _/export\\_my\\_data csv_ or _/export\\_my\\_data json_\\.", escapeCode(format))
+}
+
+func FormatExportIntro(format string) string {
+	return fmt.Sprintf("📦 Here's every poop you logged as %s, deleted ones included\\. Times are in your local timezone\\.", strings.ToUpper(format))
+}
+
+func FormatExportNeedsPrivateChat() string {
+	return "I can only send your data in a private chat\\. Start a chat with me, then try again\\."
+}
+
+func FormatExportSentPrivately() string {
+	return "📬 I sent you your data in a private chat\\."
+}
+
+// formatLogTime shortens a "YYYY-MM-DD HH:MM:SS" timestamp to minutes
+func formatLogTime(timestamp string) string {
+	if len(timestamp) >= len("2006-01-02 15:04") {
+		return timestamp[:len("2006-01-02 15:04")]
+	}
+	return timestamp
+}
+
+func FormatDeleteConfirmation(username string, timestamp string) string {
+	return fmt.Sprintf("🗑 Remove the poop %s logged at `%s`?", EscapeMarkdownV2(username), escapeCode(formatLogTime(timestamp)))
+}
+
+func FormatPoopDeleted(username string, timestamp string) string {
+	return fmt.Sprintf("🗑 Removed the poop %s logged at `%s`\\.", EscapeMarkdownV2(username), escapeCode(formatLogTime(timestamp)))
+}
+
+func FormatUndoExpired(gracePeriod time.Duration) string {
+	return fmt.Sprintf("Your last poop is more than %d minutes old\\. Reply to it with _/delete\\_poop_ to remove it\\.", int(gracePeriod.Minutes()))
+}
+
+func FormatInvalidLeaderboardPeriod(period string) string {
+	return fmt.Sprintf("`%s` isn't a period I know\\. Try _week_, _2025\\-03_, _2024_ or _2025\\-01\\-01\\.\\.2025\\-02\\-15_\\.", escapeCode(period))
+}
+
+func FormatInvalidWrappedYear(year string) string {
+	return fmt.Sprintf("`%s` isn't a year I can wrap\\. Try a year like _2024_\\.", escapeCode(year))
+}
+
+func FormatNoWrapped(year int) string {
+	return fmt.Sprintf("You didn't log any poops in %d, so there's nothing to wrap 🤷", year)
+}
+
+// awardUnits describes what each group award value measures
+var awardUnits = map[string]string{
+	"Early Bird":                         "poops between 5 and 9 AM",
+	"Night Owl":                          "poops between 11 PM and 5 AM",
+	"Machine Gun":                        "poops in a single day",
+	"Consistency King":                   "days in a row",
+	"Weekend Warrior":                    "of poops on weekends",
+	"Boss makes a dollar, I make a dime": "poops on company time",
+}
+
+// FormatGroupWrapped builds the group's year in review, with the full leaderboard, totals and every award
+func FormatGroupWrapped(year int, leaderboard []repo.UserPoopCount, awards []repo.GroupAward) string {
+	if len(leaderboard) == 0 {
+		return fmt.Sprintf("Nobody logged any poops in %d, so there's nothing to wrap 🤷", year)
+	}
+
+	total := 0
+	for _, user := range leaderboard {
+		total += user.PoopCount
+	}
+
+	msg := fmt.Sprintf("*🎁 Group Poop Wrapped %d 🎁*\n\n", year)
+	msg += "*📊 Group Totals:*\n"
+	msg += fmt.Sprintf("🟤 Total dumps: `%d`\n", total)
+	msg += fmt.Sprintf("🧻 Poopers: `%d`\n", len(leaderboard))
+	msg += fmt.Sprintf("📈 Average per pooper: `%.1f`\n\n", float64(total)/float64(len(leaderboard)))
+
+	msg += "*🏆 Leaderboard:*\n"
+	for _, user := range leaderboard {
+		rank := fmt.Sprintf("%d\\.", user.Rank)
+		if user.Rank >= 1 && user.Rank <= len(medals) {
+			rank = medals[user.Rank-1]
+		}
+		msg += fmt.Sprintf("%s %s \\- %d💩\n", rank, EscapeMarkdownV2(user.Username), user.PoopCount)
+	}
+	if ties := formatPodiumTies(leaderboard); ties != "" {
+		msg += ties + "\n"
+	}
+
+	if len(awards) > 0 {
+		msg += "\n*🎖 Awards:*\n"
+		for _, award := range awards {
+			value := award.Value
+			if unit, ok := awardUnits[award.AwardName]; ok {
+				value += " " + unit
+			}
+			msg += fmt.Sprintf("%s *%s*: %s `%s`\n", award.Emoji, EscapeMarkdownV2(award.AwardName), EscapeMarkdownV2(award.Winner), escapeCode(value))
+		}
+	}
+
+	return msg
+}
+
+func FormatPoodiumTitle(period string) string {
+	return "🏆 Poodium for " + period + " 🏆\n"
+}
+
+// formatChange shows how a count moved since the previous period, e.g. "▲ +3"
+func formatChange(current int, previous int) string {
+	switch diff := current - previous; {
+	case diff > 0:
+		return fmt.Sprintf("▲ \\+%d", diff)
+	case diff < 0:
+		return fmt.Sprintf("▼ \\-%d", -diff)
+	default:
+		return "±0"
+	}
+}
+
+// FormatWeeklyRecap builds the Monday announcement of last week, its poodium, the group total and how each member did compared to the week before
+func FormatWeeklyRecap(period repo.Period, podium []repo.UserPoopCount, changes []repo.PeriodChange) string {
+	total, previousTotal := 0, 0
+	for _, change := range changes {
+		total += change.PoopCount
+		previousTotal += change.PreviousCount
+	}
+
+	msg := fmt.Sprintf("*📆 Weekly recap for %s 📆*\n\n", EscapeMarkdownV2(FormatPeriod(period)))
+	msg += BuildPoodiumMessage(podium) + "\n\n"
+	msg += fmt.Sprintf("🟤 Group total: `%d`💩 \\(%s\\)\n\n", total, formatChange(total, previousTotal))
+
+	msg += "*📊 Compared to the week before:*\n"
+	for _, change := range changes {
+		msg += fmt.Sprintf("\t\t\t• %s \\- %d💩 \\(%s\\)\n", EscapeMarkdownV2(change.Username), change.PoopCount, formatChange(change.PoopCount, change.PreviousCount))
+	}
+	return msg
 }
 
 func FormatYearlyPoodiumTitle(year int) string {
 	return fmt.Sprintf("🏆 Poodium for %d 🏆\n", year)
 }
 
-func GetMonthName(monthStr string) string {
-	month, err := parseMonthString(monthStr)
-	if err != nil {
-		log.Printf("Invalid month string: %s", monthStr)
-		return "Unknown"
+func FormatBackfillNotForwarded() string {
+	return "Forward me a 💩 from the group to log it there\\."
+}
+
+func FormatBackfillPickSender(senderName string) string {
+	if senderName == "" {
+		return "Telegram hides who posted this 💩\\. Who was it?"
 	}
-	return month.String()
+	return fmt.Sprintf("Telegram hides who posted this 💩, it only says *%s*\\. Who was it?", EscapeMarkdownV2(senderName))
+}
+
+func FormatBackfillLogged(name string) string {
+	return fmt.Sprintf("✅ Logged this poop for %s\\.", EscapeMarkdownV2(name))
+}
+
+func FormatBackfillAlreadyLogged(name string) string {
+	return fmt.Sprintf("This poop by %s was already logged, nothing changed\\.", EscapeMarkdownV2(name))
+}
+
+func FormatBackfillSkipped() string {
+	return "Skipped, this poop wasn't logged\\."
+}
+
+// formatJobTime shows a job's run time in UTC, the timezone job schedules are written in
+func formatJobTime(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return t.UTC().Format("2006-01-02 15:04") + " UTC"
+}
+
+func FormatJobs(jobs []scheduler.Status) string {
+	msg := "*⏰ Scheduled jobs:*\n"
+	for _, job := range jobs {
+		msg += fmt.Sprintf("\t\t\t• `%s` \\(`%s`\\)\n", escapeCode(job.Name), escapeCode(job.Spec))
+		msg += fmt.Sprintf("\t\t\t\t\t\tLast run: %s\n", EscapeMarkdownV2(formatJobTime(job.LastRun)))
+		msg += fmt.Sprintf("\t\t\t\t\t\tNext run: %s\n", EscapeMarkdownV2(formatJobTime(job.NextRun)))
+	}
+	msg += "Use _/jobs run \\<job\\>_ to run one now\\."
+	return msg
+}
+
+func FormatJobTriggered(job string) string {
+	return fmt.Sprintf("✅ Ran `%s`\\.", escapeCode(job))
+}
+
+func FormatJobFailed(job string) string {
+	return fmt.Sprintf("Sorry, `%s` failed\\. Check the logs for details\\.", escapeCode(job))
+}
+
+func FormatUnknownJob(job string) string {
+	return fmt.Sprintf("There's no job called `%s`\\. Use _/jobs_ to list them\\.", escapeCode(job))
 }
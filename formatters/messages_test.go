@@ -0,0 +1,132 @@
+package formatters
+
+import (
+	"strings"
+	"testing"
+
+	repo "src/repository"
+)
+
+func TestBuildPoodiumMessage(t *testing.T) {
+	tests := []struct {
+		name   string
+		podium []repo.UserPoopCount
+		want   string
+	}{
+		{
+			name: "nobody",
+			want: "Not enough data for poodium\\.",
+		},
+		{
+			name:   "one pooper",
+			podium: []repo.UserPoopCount{{Username: "alice", PoopCount: 4, Rank: 1}},
+			want:   "🥇 alice \\- 4💩",
+		},
+		{
+			name:   "two poopers",
+			podium: []repo.UserPoopCount{{Username: "alice", PoopCount: 4, Rank: 1}, {Username: "bob_b", PoopCount: 2, Rank: 2}},
+			want:   "🥇 alice \\- 4💩\n🥈 bob\\_b \\- 2💩",
+		},
+		{
+			name: "three ranks",
+			podium: []repo.UserPoopCount{
+				{Username: "alice", PoopCount: 4, Rank: 1},
+				{Username: "bob", PoopCount: 3, Rank: 2},
+				{Username: "charlie", PoopCount: 1, Rank: 3},
+			},
+			want: "🥇 alice \\- 4💩\n🥈 bob \\- 3💩\n🥉 charlie \\- 1💩",
+		},
+		{
+			name: "tie for gold",
+			podium: []repo.UserPoopCount{
+				{Username: "alice", PoopCount: 4, Rank: 1},
+				{Username: "bob", PoopCount: 4, Rank: 1},
+				{Username: "charlie", PoopCount: 2, Rank: 2},
+			},
+			want: "🥇 alice \\- 4💩\n🥇 bob \\- 4💩\n🥈 charlie \\- 2💩\n\n" +
+				"🤝 alice and bob are tied for 🥇 with 4💩 each\\.",
+		},
+		{
+			name: "ties for silver and bronze",
+			podium: []repo.UserPoopCount{
+				{Username: "alice", PoopCount: 5, Rank: 1},
+				{Username: "bob", PoopCount: 3, Rank: 2},
+				{Username: "charlie", PoopCount: 3, Rank: 2},
+				{Username: "dave", PoopCount: 3, Rank: 2},
+				{Username: "eve", PoopCount: 1, Rank: 3},
+				{Username: "frank", PoopCount: 1, Rank: 3},
+			},
+			want: "🥇 alice \\- 5💩\n🥈 bob \\- 3💩\n🥈 charlie \\- 3💩\n🥈 dave \\- 3💩\n🥉 eve \\- 1💩\n🥉 frank \\- 1💩\n\n" +
+				"🤝 bob, charlie and dave are tied for 🥈 with 3💩 each\\.\n" +
+				"🤝 eve and frank are tied for 🥉 with 1💩 each\\.",
+		},
+		{
+			name: "ranks below the podium are left out",
+			podium: []repo.UserPoopCount{
+				{Username: "alice", PoopCount: 4, Rank: 1},
+				{Username: "bob", PoopCount: 3, Rank: 2},
+				{Username: "charlie", PoopCount: 2, Rank: 3},
+				{Username: "dave", PoopCount: 1, Rank: 4},
+			},
+			want: "🥇 alice \\- 4💩\n🥈 bob \\- 3💩\n🥉 charlie \\- 2💩",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := BuildPoodiumMessage(tt.podium); got != tt.want {
+				t.Errorf("BuildPoodiumMessage() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatGroupWrapped_SharesMedals(t *testing.T) {
+	leaderboard := []repo.UserPoopCount{
+		{Username: "alice", PoopCount: 40, Rank: 1},
+		{Username: "bob", PoopCount: 40, Rank: 1},
+		{Username: "charlie", PoopCount: 30, Rank: 2},
+		{Username: "dave", PoopCount: 20, Rank: 3},
+		{Username: "eve", PoopCount: 10, Rank: 4},
+	}
+
+	msg := FormatGroupWrapped(2024, leaderboard, nil)
+
+	for _, want := range []string{
+		"🥇 alice \\- 40💩\n🥇 bob \\- 40💩\n🥈 charlie \\- 30💩\n🥉 dave \\- 20💩\n4\\. eve \\- 10💩\n",
+		"🤝 alice and bob are tied for 🥇 with 40💩 each\\.",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("FormatGroupWrapped() =\n%s\nwant it to contain\n%s", msg, want)
+		}
+	}
+}
+
+func TestEscapeMarkdownV2(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{`A*b_c\`, `A\*b\_c\\`},
+		{"~#`", "\\~\\#\\`"},
+		{"a.b-c!(d)[e]{f}", `a\.b\-c\!\(d\)\[e\]\{f\}`},
+		{"x>y<z=1+2|3", `x\>y\<z\=1\+2\|3`},
+		{"Zoë 💩", "Zoë 💩"},
+	}
+
+	for _, tt := range tests {
+		if got := EscapeMarkdownV2(tt.in); got != tt.want {
+			t.Errorf("EscapeMarkdownV2(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFormatLeaderboard_EscapesNames(t *testing.T) {
+	leaderboard := []repo.UserPoopCount{{Username: `A*b_c\`, PoopCount: 3, Rank: 1}}
+
+	msg := FormatLeaderboard(repo.MonthPeriod(2025, 3), leaderboard)
+
+	if !strings.Contains(msg, `• A\*b\_c\\ \- 3💩`) {
+		t.Errorf("FormatLeaderboard() = %q, want the name fully escaped", msg)
+	}
+}
@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"src/config"
+	"src/formatters"
+	"src/messenger"
+	repo "src/repository"
+
+	tg_bot "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	pickBackfillSenderAction = "backfill_pick"
+	skipBackfillAction       = "backfill_skip"
+
+	// backfillPickerSize is how many recent members the sender picker offers
+	backfillPickerSize = 10
+)
+
+// HandleForwardedPoop backfills a poop the admin forwarded to the bot into the main group.
+// The sender is taken from the forward, or from the name Telegram shows when they hide their account, and
+// otherwise the admin is asked to pick them. It returns the poop when it was logged right away.
+func HandleForwardedPoop(ctx context.Context, m messenger.Messenger, r repo.Repository, cfg *config.Config, message *tg_bot.Message) (*repo.ForwardedPoop, error) {
+	reply := tg_bot.NewMessage(message.Chat.ID, "")
+	reply.ReplyToMessageID = message.MessageID
+
+	if message.ForwardDate == 0 {
+		reply.Text = formatters.FormatBackfillNotForwarded()
+		_, err := m.SendText(reply)
+		return nil, err
+	}
+
+	poop := repo.ForwardedPoop{
+		ChatID:           cfg.GroupChatID,
+		SentAtUnix:       int64(message.ForwardDate),
+		ForwardMessageID: int64(message.MessageID),
+	}
+	// Only posts forwarded from channels say which message they were
+	if message.ForwardFromChat != nil && message.ForwardFromMessageID != 0 {
+		poop.OriginChatID = message.ForwardFromChat.ID
+		poop.OriginMessageID = int64(message.ForwardFromMessageID)
+	}
+
+	sender, err := resolveForwardSender(ctx, r, cfg.GroupChatID, message)
+	if err != nil {
+		return nil, err
+	}
+	if sender == nil {
+		return nil, askBackfillSender(ctx, m, r, reply, poop, message.ForwardSenderName)
+	}
+
+	poop.UserID = sender.UserID
+	poop.Username = sender.Username
+	err = r.LogForwardedPoop(ctx, poop)
+	if errors.Is(err, repo.ErrPoopAlreadyLogged) {
+		reply.Text = formatters.FormatBackfillAlreadyLogged(sender.DisplayName())
+		_, err = m.SendText(reply)
+		return nil, err
+	}
+	if err != nil {
+		reply.Text = "Sorry, I couldn't log that poop\\. Please try again later\\!"
+		_, sendErr := m.SendText(reply)
+		if sendErr != nil {
+			return nil, fmt.Errorf("failed to send error message: %w", sendErr)
+		}
+		return nil, err
+	}
+	slog.InfoContext(ctx, "Backfilled poop", "poop_chat_id", poop.ChatID, "poop_user_id", poop.UserID)
+	return &poop, nil
+}
+
+// resolveForwardSender finds who posted a forwarded message, nil when Telegram hides them and their name matches no single member
+func resolveForwardSender(ctx context.Context, r repo.Repository, chatID int64, message *tg_bot.Message) (*repo.User, error) {
+	if message.ForwardFrom != nil {
+		return &repo.User{
+			UserID:    message.ForwardFrom.ID,
+			Username:  message.ForwardFrom.UserName,
+			FirstName: message.ForwardFrom.FirstName,
+			LastName:  message.ForwardFrom.LastName,
+		}, nil
+	}
+	if message.ForwardSenderName == "" {
+		return nil, nil
+	}
+
+	members, err := r.FindMembersByName(ctx, chatID, message.ForwardSenderName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find members named %q: %w", message.ForwardSenderName, err)
+	}
+	if len(members) != 1 {
+		return nil, nil
+	}
+	return &members[0], nil
+}
+
+// askBackfillSender keeps the forward until the admin picks its sender from the group's recent members
+func askBackfillSender(ctx context.Context, m messenger.Messenger, r repo.Repository, reply tg_bot.MessageConfig, poop repo.ForwardedPoop, senderName string) error {
+	members, err := r.GetRecentMembers(ctx, poop.ChatID, backfillPickerSize)
+	if err != nil {
+		return fmt.Errorf("failed to get recent members: %w", err)
+	}
+
+	err = r.SavePendingBackfill(ctx, repo.PendingBackfill{
+		ForwardMessageID: poop.ForwardMessageID,
+		ChatID:           poop.ChatID,
+		SenderName:       senderName,
+		SentAtUnix:       poop.SentAtUnix,
+		OriginChatID:     poop.OriginChatID,
+		OriginMessageID:  poop.OriginMessageID,
+	}, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("failed to save pending backfill: %w", err)
+	}
+
+	var rows [][]tg_bot.InlineKeyboardButton
+	for i := 0; i < len(members); i += 2 {
+		var row []tg_bot.InlineKeyboardButton
+		for _, member := range members[i:min(i+2, len(members))] {
+			row = append(row, tg_bot.NewInlineKeyboardButtonData(member.DisplayName(),
+				callbackData(pickBackfillSenderAction, poop.ForwardMessageID, member.UserID)))
+		}
+		rows = append(rows, row)
+	}
+	rows = append(rows, tg_bot.NewInlineKeyboardRow(
+		tg_bot.NewInlineKeyboardButtonData("Skip", callbackData(skipBackfillAction, poop.ForwardMessageID)),
+	))
+
+	reply.Text = formatters.FormatBackfillPickSender(senderName)
+	reply.ReplyMarkup = tg_bot.NewInlineKeyboardMarkup(rows...)
+	_, err = m.SendText(reply)
+	return err
+}
+
+// HandlePickBackfillSender handles a member button of the sender picker, logging the forward for them
+func HandlePickBackfillSender(ctx context.Context, m messenger.Messenger, r repo.Repository, cfg *config.Config, query *tg_bot.CallbackQuery, args []string) error {
+	ids, err := parseCallbackIDs(args, 2)
+	if err != nil {
+		return err
+	}
+	forwardMessageID, userID := ids[0], ids[1]
+
+	if query.From.ID != cfg.MyChatID {
+		return answerCallback(m, query, "Only the admin can backfill poops.")
+	}
+
+	pending, err := r.TakePendingBackfill(ctx, forwardMessageID)
+	if errors.Is(err, repo.ErrPendingBackfillNotFound) {
+		if err := editCallbackMessage(m, query, "This poop was already handled\\."); err != nil {
+			return err
+		}
+		return answerCallback(m, query, "Already handled")
+	}
+	if err != nil {
+		return err
+	}
+
+	user, err := r.GetUser(ctx, userID)
+	if errors.Is(err, repo.ErrUserNotFound) {
+		// Members are recorded whenever they post, so this only happens for someone who left before users were tracked
+		user = repo.User{UserID: userID, FirstName: fmt.Sprintf("user %d", userID)}
+	} else if err != nil {
+		return restorePendingBackfill(ctx, m, r, query, pending, err)
+	}
+
+	err = r.LogForwardedPoop(ctx, repo.ForwardedPoop{
+		ChatID:           pending.ChatID,
+		UserID:           user.UserID,
+		Username:         user.Username,
+		SentAtUnix:       pending.SentAtUnix,
+		ForwardMessageID: pending.ForwardMessageID,
+		OriginChatID:     pending.OriginChatID,
+		OriginMessageID:  pending.OriginMessageID,
+	})
+	if errors.Is(err, repo.ErrPoopAlreadyLogged) {
+		if err := editCallbackMessage(m, query, formatters.FormatBackfillAlreadyLogged(user.DisplayName())); err != nil {
+			return err
+		}
+		return answerCallback(m, query, "Already logged")
+	}
+	if err != nil {
+		return restorePendingBackfill(ctx, m, r, query, pending, err)
+	}
+
+	if err := editCallbackMessage(m, query, formatters.FormatBackfillLogged(user.DisplayName())); err != nil {
+		return err
+	}
+	return answerCallback(m, query, "Logged")
+}
+
+// restorePendingBackfill puts a forward back after failing to log it, so the admin can pick again
+func restorePendingBackfill(ctx context.Context, m messenger.Messenger, r repo.Repository, query *tg_bot.CallbackQuery, pending repo.PendingBackfill, cause error) error {
+	if err := r.SavePendingBackfill(ctx, pending, time.Now().Unix()); err != nil {
+		slog.ErrorContext(ctx, "Failed to restore pending backfill", "forward_message_id", pending.ForwardMessageID, "error", err)
+	}
+	answerErr := answerCallback(m, query, "Sorry, I couldn't log it. Please try again later!")
+	if answerErr != nil {
+		return fmt.Errorf("failed to answer callback: %w", answerErr)
+	}
+	return cause
+}
+
+// HandleSkipBackfill handles the "Skip" button of the sender picker, dropping the forward
+func HandleSkipBackfill(ctx context.Context, m messenger.Messenger, r repo.Repository, cfg *config.Config, query *tg_bot.CallbackQuery, args []string) error {
+	ids, err := parseCallbackIDs(args, 1)
+	if err != nil {
+		return err
+	}
+
+	if query.From.ID != cfg.MyChatID {
+		return answerCallback(m, query, "Only the admin can backfill poops.")
+	}
+
+	_, err = r.TakePendingBackfill(ctx, ids[0])
+	if err != nil && !errors.Is(err, repo.ErrPendingBackfillNotFound) {
+		return err
+	}
+
+	if err := editCallbackMessage(m, query, formatters.FormatBackfillSkipped()); err != nil {
+		return err
+	}
+	return answerCallback(m, query, "Skipped")
+}
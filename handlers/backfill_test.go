@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	repo "src/repository"
+
+	tg_bot "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// forwardedPoop builds a 💩 the admin forwarded to the bot from a sender who hides their account
+func forwardedPoop(messageID int, senderName string, sentAt time.Time) *tg_bot.Message {
+	return &tg_bot.Message{
+		MessageID:         messageID,
+		From:              &tg_bot.User{ID: testAdminID},
+		Chat:              &tg_bot.Chat{ID: testAdminID, Type: "private"},
+		Date:              int(time.Now().Unix()),
+		Text:              "💩",
+		ForwardSenderName: senderName,
+		ForwardDate:       int(sentAt.Unix()),
+	}
+}
+
+func TestHandleForwardedPoop_ResolvesSender(t *testing.T) {
+	r, m, cfg := setupTest(t)
+	ctx := context.Background()
+	sentAt := time.Now().Add(-24 * time.Hour).Truncate(time.Second)
+
+	message := forwardedPoop(30, "", sentAt)
+	message.ForwardFrom = &tg_bot.User{ID: 1001, UserName: "alice"}
+	poop, err := HandleForwardedPoop(ctx, m, r, cfg, message)
+	if err != nil {
+		t.Fatalf("HandleForwardedPoop() error = %v", err)
+	}
+	if poop == nil || poop.UserID != 1001 || poop.ChatID != testChatID || poop.SentAtUnix != sentAt.Unix() {
+		t.Fatalf("HandleForwardedPoop() = %+v, want alice's poop logged in the group at the original time", poop)
+	}
+
+	// Telegram only shows the name of members who hide their account, which is enough when a single member has it
+	if err := r.UpsertUser(ctx, repo.User{UserID: 1001, Username: "alice", FirstName: "Alice", LastName: "Liddell", LastSeenUnix: sentAt.Unix()}); err != nil {
+		t.Fatalf("UpsertUser() error = %v", err)
+	}
+	poop, err = HandleForwardedPoop(ctx, m, r, cfg, forwardedPoop(31, "Alice Liddell", sentAt.Add(time.Hour)))
+	if err != nil || poop == nil || poop.UserID != 1001 {
+		t.Fatalf("HandleForwardedPoop() by name = %+v, %v, want alice's poop", poop, err)
+	}
+
+	// Forwarding it again changes nothing
+	poop, err = HandleForwardedPoop(ctx, m, r, cfg, forwardedPoop(32, "Alice Liddell", sentAt.Add(time.Hour)))
+	if err != nil || poop != nil {
+		t.Fatalf("HandleForwardedPoop() of a duplicate = %+v, %v, want nothing logged", poop, err)
+	}
+	sent := m.CallsTo("SendText")
+	if len(sent) != 1 || !strings.Contains(sent[0].Text, "already logged") || sent[0].ReplyTo != 32 {
+		t.Errorf("A duplicate forward sent %+v, want a reply saying it was already logged", sent)
+	}
+}
+
+func TestHandleForwardedPoop_PicksHiddenSender(t *testing.T) {
+	r, m, cfg := setupTest(t)
+	ctx := context.Background()
+	logPoop(t, r, 1001, "alice", 1, time.Now().Add(-48*time.Hour))
+	logPoop(t, r, 1002, "bob", 2, time.Now().Add(-47*time.Hour))
+	if err := r.UpsertUser(ctx, repo.User{UserID: 1002, Username: "bob", LastSeenUnix: time.Now().Unix()}); err != nil {
+		t.Fatalf("UpsertUser() error = %v", err)
+	}
+	sentAt := time.Now().Add(-24 * time.Hour).Truncate(time.Second)
+
+	poop, err := HandleForwardedPoop(ctx, m, r, cfg, forwardedPoop(30, "Mystery Pooper", sentAt))
+	if err != nil || poop != nil {
+		t.Fatalf("HandleForwardedPoop() of a hidden sender = %+v, %v, want nothing logged yet", poop, err)
+	}
+
+	sent := m.CallsTo("SendText")
+	if len(sent) != 1 || sent[0].Keyboard == nil || !strings.Contains(sent[0].Text, "Mystery Pooper") {
+		t.Fatalf("HandleForwardedPoop() sent %+v, want a sender picker", sent)
+	}
+	rows := sent[0].Keyboard.InlineKeyboard
+	if len(rows) != 2 || len(rows[0]) != 2 || rows[0][0].Text != "bob" || rows[1][0].Text != "Skip" {
+		t.Fatalf("The picker has buttons %+v, want the recent members then Skip", rows)
+	}
+
+	query := &tg_bot.CallbackQuery{
+		ID:      "query",
+		From:    &tg_bot.User{ID: 1002},
+		Message: &tg_bot.Message{MessageID: 31, Chat: &tg_bot.Chat{ID: testAdminID}},
+		Data:    *rows[0][0].CallbackData,
+	}
+	// Only the admin can pick
+	HandleCallbackQuery(ctx, m, r, cfg, query)
+	if count, err := r.GetGlobalPoopCount(ctx, testChatID, 1002); err != nil || count != 1 {
+		t.Fatalf("Bob has %d poops after someone else picked, want 1 (err %v)", count, err)
+	}
+
+	query.From = &tg_bot.User{ID: testAdminID}
+	HandleCallbackQuery(ctx, m, r, cfg, query)
+	if count, err := r.GetGlobalPoopCount(ctx, testChatID, 1002); err != nil || count != 2 {
+		t.Errorf("Bob has %d poops after the admin picked him, want 2 (err %v)", count, err)
+	}
+	edits := m.CallsTo("EditText")
+	if len(edits) != 1 || !strings.Contains(edits[0].Text, "Logged this poop for bob") {
+		t.Errorf("Picking edited %+v, want the picker to say who it was logged for", edits)
+	}
+
+	// Pressing again, or skipping afterwards, doesn't log twice
+	m.Reset()
+	HandleCallbackQuery(ctx, m, r, cfg, query)
+	if count, err := r.GetGlobalPoopCount(ctx, testChatID, 1002); err != nil || count != 2 {
+		t.Errorf("Bob has %d poops after picking twice, want 2 (err %v)", count, err)
+	}
+	if edits := m.CallsTo("EditText"); len(edits) != 1 || !strings.Contains(edits[0].Text, "already handled") {
+		t.Errorf("Picking twice edited %+v, want it to say the poop was already handled", edits)
+	}
+}
+
+func TestHandleForwardedPoop_SameMessageBothWays(t *testing.T) {
+	r, m, cfg := setupTest(t)
+	ctx := context.Background()
+	logPoop(t, r, 1001, "alice", 1, time.Now().Add(-48*time.Hour))
+	if err := r.UpsertUser(ctx, repo.User{UserID: 1001, Username: "alice", LastSeenUnix: time.Now().Unix()}); err != nil {
+		t.Fatalf("UpsertUser() error = %v", err)
+	}
+	sentAt := time.Now().Add(-24 * time.Hour).Truncate(time.Second)
+
+	// First forwarded while alice showed her account
+	message := forwardedPoop(30, "", sentAt)
+	message.ForwardFrom = &tg_bot.User{ID: 1001, UserName: "alice"}
+	if poop, err := HandleForwardedPoop(ctx, m, r, cfg, message); err != nil || poop == nil {
+		t.Fatalf("HandleForwardedPoop() = %+v, %v, want alice's poop logged", poop, err)
+	}
+
+	// Then again after she hid it, so the admin has to pick her
+	m.Reset()
+	if poop, err := HandleForwardedPoop(ctx, m, r, cfg, forwardedPoop(31, "Hidden Alice", sentAt)); err != nil || poop != nil {
+		t.Fatalf("HandleForwardedPoop() of a hidden sender = %+v, %v, want nothing logged yet", poop, err)
+	}
+	sent := m.CallsTo("SendText")
+	if len(sent) != 1 || sent[0].Keyboard == nil {
+		t.Fatalf("HandleForwardedPoop() sent %+v, want a sender picker", sent)
+	}
+	query := &tg_bot.CallbackQuery{
+		ID:      "query",
+		From:    &tg_bot.User{ID: testAdminID},
+		Message: &tg_bot.Message{MessageID: 32, Chat: &tg_bot.Chat{ID: testAdminID}},
+		Data:    *sent[0].Keyboard.InlineKeyboard[0][0].CallbackData,
+	}
+	HandleCallbackQuery(ctx, m, r, cfg, query)
+
+	if count, err := r.GetGlobalPoopCount(ctx, testChatID, 1001); err != nil || count != 2 {
+		t.Errorf("Alice has %d poops after the same forward was picked, want 2 (err %v)", count, err)
+	}
+	if edits := m.CallsTo("EditText"); len(edits) != 1 || !strings.Contains(edits[0].Text, "already logged") {
+		t.Errorf("Picking edited %+v, want the picker to say the poop was already logged", edits)
+	}
+}
+
+func TestHandleForwardedPoop_Skip(t *testing.T) {
+	r, m, cfg := setupTest(t)
+	ctx := context.Background()
+
+	if _, err := HandleForwardedPoop(ctx, m, r, cfg, forwardedPoop(30, "", time.Now().Add(-time.Hour))); err != nil {
+		t.Fatalf("HandleForwardedPoop() error = %v", err)
+	}
+	sent := m.CallsTo("SendText")
+	if len(sent) != 1 || sent[0].Keyboard == nil {
+		t.Fatalf("HandleForwardedPoop() sent %+v, want a sender picker", sent)
+	}
+	rows := sent[0].Keyboard.InlineKeyboard
+	if len(rows) != 1 || rows[0][0].Text != "Skip" {
+		t.Fatalf("The picker of a group without members has buttons %+v, want only Skip", rows)
+	}
+
+	query := &tg_bot.CallbackQuery{
+		ID:      "query",
+		From:    &tg_bot.User{ID: testAdminID},
+		Message: &tg_bot.Message{MessageID: 31, Chat: &tg_bot.Chat{ID: testAdminID}},
+		Data:    *rows[0][0].CallbackData,
+	}
+	HandleCallbackQuery(ctx, m, r, cfg, query)
+	if _, err := r.TakePendingBackfill(ctx, 30); !errors.Is(err, repo.ErrPendingBackfillNotFound) {
+		t.Errorf("TakePendingBackfill() after skipping error = %v, want ErrPendingBackfillNotFound", err)
+	}
+	if edits := m.CallsTo("EditText"); len(edits) != 1 || !strings.Contains(edits[0].Text, "Skipped") {
+		t.Errorf("Skipping edited %+v, want the picker to say it was skipped", edits)
+	}
+}
+
+func TestHandleForwardedPoop_NotForwarded(t *testing.T) {
+	r, m, cfg := setupTest(t)
+
+	message := forwardedPoop(30, "", time.Time{})
+	message.ForwardDate = 0
+	poop, err := HandleForwardedPoop(context.Background(), m, r, cfg, message)
+	if err != nil || poop != nil {
+		t.Fatalf("HandleForwardedPoop() of a message that isn't a forward = %+v, %v, want nothing logged", poop, err)
+	}
+	if sent := m.CallsTo("SendText"); len(sent) != 1 || !strings.Contains(sent[0].Text, "Forward me") {
+		t.Errorf("HandleForwardedPoop() sent %+v, want a hint to forward poops", sent)
+	}
+}
@@ -3,127 +3,204 @@ package handlers
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
+	"strings"
+	"time"
 
+	"src/config"
 	"src/formatters"
+	"src/messenger"
+	"src/metrics"
 	repo "src/repository"
+	"src/utils"
 
 	tg_bot "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
-type CommandHandler func(ctx context.Context, bot *tg_bot.BotAPI, repo repo.Repository, update tg_bot.Update, userId int64, msg tg_bot.MessageConfig) error
+type CommandHandler func(ctx context.Context, m messenger.Messenger, repo repo.Repository, cfg *config.Config, update tg_bot.Update, chatID int64, userId int64, msg tg_bot.MessageConfig) error
 
 // HandleMyPoopLog handles the /my_poop_log command
-func HandleMyPoopLog(ctx context.Context, bot *tg_bot.BotAPI, r repo.Repository, update tg_bot.Update, userId int64, msg tg_bot.MessageConfig) error {
-	globalPoopCount, errGlobal := r.GetGlobalPoopCount(ctx, userId)
-	monthlyPoopCounts, errMonthly := r.GetMonthlyPoopStats(ctx, userId)
-	daysWithoutPoop, errNoPoop := r.GetDaysWithoutPoop(ctx, userId)
-	maxStreak, errStreak := r.GetMaxPoopStreak(ctx, userId)
-	day, poops, mostPoopsErr := r.GetDayWithMostPoops(ctx, userId)
+func HandleMyPoopLog(ctx context.Context, m messenger.Messenger, r repo.Repository, cfg *config.Config, update tg_bot.Update, chatID int64, userId int64, msg tg_bot.MessageConfig) error {
+	globalPoopCount, errGlobal := r.GetGlobalPoopCount(ctx, chatID, userId)
+	monthlyPoopCounts, errMonthly := r.GetMonthlyPoopStats(ctx, chatID, userId)
+	daysWithoutPoop, errNoPoop := r.GetDaysWithoutPoop(ctx, chatID, userId, time.Now())
+	maxStreak, errStreak := r.GetMaxPoopStreak(ctx, chatID, userId)
+	day, poops, mostPoopsErr := r.GetDayWithMostPoops(ctx, chatID, userId)
 
 	if errGlobal != nil || errMonthly != nil || errNoPoop != nil || errStreak != nil || mostPoopsErr != nil {
 		msg.Text = "Sorry, I couldn't retrieve your poop log\\. Please try again later\\!"
-		_, err := bot.Send(msg)
+		_, err := m.SendText(msg)
 		return err
 	}
 
 	username := update.Message.From.UserName
 	msg.Text = formatters.FormatPoopLog(username, globalPoopCount, monthlyPoopCounts, daysWithoutPoop, maxStreak, day, poops)
-	_, err := bot.Send(msg)
+	_, err := m.SendText(msg)
 	return err
 }
 
-// HandleLeaderboard handles the /leaderboard command
-func HandleLeaderboard(ctx context.Context, bot *tg_bot.BotAPI, r repo.Repository, update tg_bot.Update, userId int64, msg tg_bot.MessageConfig) error {
-	monthlyLeaderboard, err := r.GetMonthlyLeaderboard(ctx)
-	if err != nil {
-		msg.Text = "Sorry, I couldn't retrieve the monthly leaderboard\\. Please try again later\\!"
-		_, sendErr := bot.Send(msg)
-		if sendErr != nil {
-			return fmt.Errorf("failed to send error message: %w", sendErr)
+// HandleTimezone handles the /timezone command, showing the group's timezone, or changing it when sent by the admin
+func HandleTimezone(ctx context.Context, m messenger.Messenger, r repo.Repository, cfg *config.Config, update tg_bot.Update, chatID int64, userId int64, msg tg_bot.MessageConfig) error {
+	timezone := strings.TrimSpace(update.Message.CommandArguments())
+	if timezone == "" {
+		current, err := r.GetGroupTimezone(ctx, chatID)
+		if err != nil {
+			msg.Text = "Sorry, I couldn't retrieve the group's timezone\\. Please try again later\\!"
+			_, sendErr := m.SendText(msg)
+			if sendErr != nil {
+				return fmt.Errorf("failed to send error message: %w", sendErr)
+			}
+			return err
 		}
+
+		msg.Text = formatters.FormatGroupTimezone(current)
+		_, err = m.SendText(msg)
 		return err
 	}
 
-	msg.Text = formatters.FormatLeaderboard(monthlyLeaderboard)
-	_, err = bot.Send(msg)
-	return err
-}
+	if userId != cfg.MyChatID {
+		msg.Text = "Only the admin can change the group's timezone\\."
+		_, err := m.SendText(msg)
+		return err
+	}
+
+	if err := utils.ValidateTimezone(timezone); err != nil {
+		msg.Text = formatters.FormatInvalidTimezone(timezone)
+		_, err = m.SendText(msg)
+		return err
+	}
 
-// HandleBottomPoopers handles the /bottom_poopers command
-func HandleBottomPoopers(ctx context.Context, bot *tg_bot.BotAPI, r repo.Repository, update tg_bot.Update, userId int64, msg tg_bot.MessageConfig) error {
-	bottomPoopers, err := r.GetBottomPoopers(ctx)
+	err := r.SetGroupTimezone(ctx, chatID, timezone)
 	if err != nil {
-		msg.Text = "Sorry, I couldn't retrieve the bottom poopers\\. Please try again later\\!"
-		_, sendErr := bot.Send(msg)
+		msg.Text = "Sorry, I couldn't update the group's timezone\\. Please try again later\\!"
+		_, sendErr := m.SendText(msg)
 		if sendErr != nil {
 			return fmt.Errorf("failed to send error message: %w", sendErr)
 		}
 		return err
 	}
 
-	msg.Text = "This month's bottom poopers are:\n" + formatters.BuildPoodiumMessage(bottomPoopers)
-	_, err = bot.Send(msg)
+	msg.Text = formatters.FormatGroupTimezoneUpdated(timezone)
+	_, err = m.SendText(msg)
 	return err
 }
 
-// HandlePoodium handles the /poodium command
-func HandlePoodium(ctx context.Context, bot *tg_bot.BotAPI, r repo.Repository, update tg_bot.Update, userId int64, msg tg_bot.MessageConfig) error {
-	monthlyPoodium, err := r.GetMonthlyPoodium(ctx)
+// HandleMyTimezone handles the /my_timezone command, showing or changing the caller's timezone override
+func HandleMyTimezone(ctx context.Context, m messenger.Messenger, r repo.Repository, cfg *config.Config, update tg_bot.Update, chatID int64, userId int64, msg tg_bot.MessageConfig) error {
+	timezone := strings.TrimSpace(update.Message.CommandArguments())
+	if timezone == "" {
+		current, errUser := r.GetUserTimezone(ctx, userId)
+		groupTimezone, errGroup := r.GetGroupTimezone(ctx, chatID)
+		if errUser != nil || errGroup != nil {
+			msg.Text = "Sorry, I couldn't retrieve your timezone\\. Please try again later\\!"
+			_, err := m.SendText(msg)
+			return err
+		}
+
+		msg.Text = formatters.FormatUserTimezone(current, groupTimezone)
+		_, err := m.SendText(msg)
+		return err
+	}
+
+	if strings.EqualFold(timezone, "reset") {
+		timezone = ""
+	} else if err := utils.ValidateTimezone(timezone); err != nil {
+		msg.Text = formatters.FormatInvalidTimezone(timezone)
+		_, err = m.SendText(msg)
+		return err
+	}
+
+	err := r.SetUserTimezone(ctx, userId, timezone)
 	if err != nil {
-		msg.Text = "Sorry, I couldn't retrieve the monthly poodium\\. Please try again later\\!"
-		_, sendErr := bot.Send(msg)
+		msg.Text = "Sorry, I couldn't update your timezone\\. Please try again later\\!"
+		_, sendErr := m.SendText(msg)
 		if sendErr != nil {
 			return fmt.Errorf("failed to send error message: %w", sendErr)
 		}
 		return err
 	}
 
-	msg.Text = "This month's top poopers are:\n" + formatters.BuildPoodiumMessage(monthlyPoodium)
-	_, err = bot.Send(msg)
+	msg.Text = formatters.FormatUserTimezoneUpdated(timezone)
+	_, err = m.SendText(msg)
 	return err
 }
 
-// HandleYearlyPoodium handles the /poodium_year command
-func HandleYearlyPoodium(ctx context.Context, bot *tg_bot.BotAPI, r repo.Repository, update tg_bot.Update, userId int64, msg tg_bot.MessageConfig) error {
-	yearlyPoodium, err := r.GetYearlyPoodium(ctx)
+// HandleCheckIns handles the /checkins command, showing or changing whether the caller gets inactivity check-ins
+func HandleCheckIns(ctx context.Context, m messenger.Messenger, r repo.Repository, cfg *config.Config, update tg_bot.Update, chatID int64, userId int64, msg tg_bot.MessageConfig) error {
+	var enabled bool
+	switch strings.ToLower(strings.TrimSpace(update.Message.CommandArguments())) {
+	case "":
+		current, err := r.GetCheckInsEnabled(ctx, userId)
+		if err != nil {
+			msg.Text = "Sorry, I couldn't retrieve your check\\-in setting\\. Please try again later\\!"
+			_, sendErr := m.SendText(msg)
+			if sendErr != nil {
+				return fmt.Errorf("failed to send error message: %w", sendErr)
+			}
+			return err
+		}
+
+		msg.Text = formatters.FormatCheckInsStatus(current)
+		_, err = m.SendText(msg)
+		return err
+	case "on":
+		enabled = true
+	case "off":
+		enabled = false
+	default:
+		msg.Text = "Use _/checkins on_ or _/checkins off_\\."
+		_, err := m.SendText(msg)
+		return err
+	}
+
+	err := r.SetCheckInsEnabled(ctx, userId, enabled)
 	if err != nil {
-		msg.Text = "Sorry, I couldn't retrieve the yearly poodium\\. Please try again later\\!"
-		_, sendErr := bot.Send(msg)
+		msg.Text = "Sorry, I couldn't update your check\\-in setting\\. Please try again later\\!"
+		_, sendErr := m.SendText(msg)
 		if sendErr != nil {
 			return fmt.Errorf("failed to send error message: %w", sendErr)
 		}
 		return err
 	}
 
-	msg.Text = "This year's top poopers are:\n" + formatters.BuildPoodiumMessage(yearlyPoodium)
-	_, err = bot.Send(msg)
+	msg.Text = formatters.FormatCheckInsStatus(enabled)
+	_, err = m.SendText(msg)
 	return err
 }
 
 // HandleHelp handles the /help command and unknown commands
-func HandleHelp(ctx context.Context, bot *tg_bot.BotAPI, r repo.Repository, update tg_bot.Update, userId int64, msg tg_bot.MessageConfig) error {
+func HandleHelp(ctx context.Context, m messenger.Messenger, r repo.Repository, cfg *config.Config, update tg_bot.Update, chatID int64, userId int64, msg tg_bot.MessageConfig) error {
 	isUnknownCommand := update.Message.Command() != "help"
 	msg.Text = formatters.FormatHelpMessage(isUnknownCommand)
-	_, err := bot.Send(msg)
+	_, err := m.SendText(msg)
 	return err
 }
 
 func GetCommandHandlers() map[string]CommandHandler {
 	return map[string]CommandHandler{
-		"my_poop_log":    HandleMyPoopLog,
-		"leaderboard":    HandleLeaderboard,
-		"bottom_poopers": HandleBottomPoopers,
-		"poodium":        HandlePoodium,
-		"poodium_year":   HandleYearlyPoodium,
-		"poop_wrapped":   HandlePersonalWrapped,
-		"help":           HandleHelp,
+		"my_poop_log":      HandleMyPoopLog,
+		"leaderboard":      HandleLeaderboard,
+		"leaderboard_week": HandleWeeklyLeaderboard,
+		"bottom_poopers":   HandleBottomPoopers,
+		"poodium":          HandlePoodium,
+		"poodium_year":     HandleYearlyPoodium,
+		"poop_wrapped":     HandlePersonalWrapped,
+		"group_wrapped":    HandleGroupWrapped,
+		"undo":             HandleUndo,
+		"delete_poop":      HandleDeletePoop,
+		"timezone":         HandleTimezone,
+		"my_timezone":      HandleMyTimezone,
+		"checkins":         HandleCheckIns,
+		"register_sticker": HandleRegisterSticker,
+		"stickers":         HandleStickers,
+		"export_my_data":   HandleExportMyData,
+		"help":             HandleHelp,
 	}
 }
 
 // HandleCommand routes commands to their respective handlers
-func HandleCommand(ctx context.Context, bot *tg_bot.BotAPI, r repo.Repository, update tg_bot.Update, userId int64, msg tg_bot.MessageConfig) {
-	log.Println("Command received:", update.Message.Command())
+func HandleCommand(ctx context.Context, m messenger.Messenger, r repo.Repository, cfg *config.Config, update tg_bot.Update, chatID int64, userId int64, msg tg_bot.MessageConfig) {
+	slog.DebugContext(ctx, "Command received")
 
 	handlers := GetCommandHandlers()
 	command := update.Message.Command()
@@ -133,7 +210,15 @@ func HandleCommand(ctx context.Context, bot *tg_bot.BotAPI, r repo.Repository, u
 		handler = HandleHelp
 	}
 
-	if err := handler(ctx, bot, r, update, userId, msg); err != nil {
-		log.Printf("Error handling command %s: %v", command, err)
+	// Unknown commands share a label, so users can't create a series per typo
+	label := command
+	if !exists {
+		label = "unknown"
+	}
+	metrics.Commands.With(label).Inc()
+
+	if err := handler(ctx, m, r, cfg, update, chatID, userId, msg); err != nil {
+		metrics.HandlerErrors.With(label).Inc()
+		slog.ErrorContext(ctx, "Error handling command", "error", err)
 	}
 }
@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"src/config"
+	"src/formatters"
+	"src/messenger"
+	"src/metrics"
+	repo "src/repository"
+
+	tg_bot "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	confirmDeleteAction = "delete_poop"
+	// confirmUndoAction confirms a removal offered by /undo, which is only allowed within the grace period
+	confirmUndoAction  = "undo_poop"
+	cancelDeleteAction = "keep_poop"
+)
+
+type CallbackHandler func(ctx context.Context, m messenger.Messenger, r repo.Repository, cfg *config.Config, query *tg_bot.CallbackQuery, args []string) error
+
+// HandleUndo handles the /undo command, offering to remove the caller's most recent poop within the grace period
+func HandleUndo(ctx context.Context, m messenger.Messenger, r repo.Repository, cfg *config.Config, update tg_bot.Update, chatID int64, userId int64, msg tg_bot.MessageConfig) error {
+	poop, err := r.GetLatestPoop(ctx, chatID, userId)
+	if errors.Is(err, repo.ErrPoopNotFound) {
+		msg.Text = "You don't have any poops to undo\\."
+		_, err = m.SendText(msg)
+		return err
+	}
+	if err != nil {
+		msg.Text = "Sorry, I couldn't find your last poop\\. Please try again later\\!"
+		_, sendErr := m.SendText(msg)
+		if sendErr != nil {
+			return fmt.Errorf("failed to send error message: %w", sendErr)
+		}
+		return err
+	}
+
+	if time.Since(time.Unix(poop.CreatedAtUnix, 0)) > cfg.UndoGracePeriod {
+		msg.Text = formatters.FormatUndoExpired(cfg.UndoGracePeriod)
+		_, err = m.SendText(msg)
+		return err
+	}
+
+	return sendDeleteConfirmation(m, msg, poop, userId, confirmUndoAction)
+}
+
+// HandleDeletePoop handles the /delete_poop command, sent as a reply to the poop message to remove
+func HandleDeletePoop(ctx context.Context, m messenger.Messenger, r repo.Repository, cfg *config.Config, update tg_bot.Update, chatID int64, userId int64, msg tg_bot.MessageConfig) error {
+	reply := update.Message.ReplyToMessage
+	if reply == nil {
+		msg.Text = "Reply to the 💩 you want to remove with _/delete\\_poop_\\."
+		_, err := m.SendText(msg)
+		return err
+	}
+
+	poop, err := r.GetPoopByMessageID(ctx, chatID, int64(reply.MessageID))
+	if errors.Is(err, repo.ErrPoopNotFound) {
+		msg.Text = "That message isn't a logged poop\\."
+		_, err = m.SendText(msg)
+		return err
+	}
+	if err != nil {
+		msg.Text = "Sorry, I couldn't find that poop\\. Please try again later\\!"
+		_, sendErr := m.SendText(msg)
+		if sendErr != nil {
+			return fmt.Errorf("failed to send error message: %w", sendErr)
+		}
+		return err
+	}
+
+	if !canDeletePoop(cfg, poop, userId) {
+		msg.Text = "You can only remove your own poops\\."
+		_, err = m.SendText(msg)
+		return err
+	}
+
+	return sendDeleteConfirmation(m, msg, poop, userId, confirmDeleteAction)
+}
+
+// canDeletePoop reports whether a user may remove a log, which is limited to its owner and the admin
+func canDeletePoop(cfg *config.Config, poop repo.PoopLog, userID int64) bool {
+	return poop.UserID == userID || userID == cfg.MyChatID
+}
+
+// sendDeleteConfirmation asks to confirm a removal, confirmAction tells whether it was offered by /undo or a reply
+func sendDeleteConfirmation(m messenger.Messenger, msg tg_bot.MessageConfig, poop repo.PoopLog, requesterID int64, confirmAction string) error {
+	msg.Text = formatters.FormatDeleteConfirmation(poop.DisplayName, poop.Timestamp)
+	msg.ReplyMarkup = tg_bot.NewInlineKeyboardMarkup(tg_bot.NewInlineKeyboardRow(
+		tg_bot.NewInlineKeyboardButtonData("🗑 Remove it", callbackData(confirmAction, poop.ChatID, poop.MessageID, requesterID)),
+		tg_bot.NewInlineKeyboardButtonData("Keep it", callbackData(cancelDeleteAction, requesterID)),
+	))
+	_, err := m.SendText(msg)
+	return err
+}
+
+// HandleConfirmDelete handles the "Remove it" button of a confirmation offered by /delete_poop
+func HandleConfirmDelete(ctx context.Context, m messenger.Messenger, r repo.Repository, cfg *config.Config, query *tg_bot.CallbackQuery, args []string) error {
+	return confirmDelete(ctx, m, r, cfg, query, args, false)
+}
+
+// HandleConfirmUndo handles the "Remove it" button of a confirmation offered by /undo.
+// The grace period is checked again, the button may be pressed long after it was offered.
+func HandleConfirmUndo(ctx context.Context, m messenger.Messenger, r repo.Repository, cfg *config.Config, query *tg_bot.CallbackQuery, args []string) error {
+	return confirmDelete(ctx, m, r, cfg, query, args, true)
+}
+
+func confirmDelete(ctx context.Context, m messenger.Messenger, r repo.Repository, cfg *config.Config, query *tg_bot.CallbackQuery, args []string, undo bool) error {
+	ids, err := parseCallbackIDs(args, 3)
+	if err != nil {
+		return err
+	}
+	chatID, messageID, requesterID := ids[0], ids[1], ids[2]
+
+	if query.From.ID != requesterID {
+		return answerCallback(m, query, "Only the person who asked can confirm this.")
+	}
+
+	poop, err := r.GetPoopByMessageID(ctx, chatID, messageID)
+	if errors.Is(err, repo.ErrPoopNotFound) {
+		if err := editCallbackMessage(m, query, "This poop was already removed\\."); err != nil {
+			return err
+		}
+		return answerCallback(m, query, "Already removed")
+	}
+	if err != nil {
+		return err
+	}
+
+	if !canDeletePoop(cfg, poop, requesterID) {
+		return answerCallback(m, query, "You can only remove your own poops.")
+	}
+
+	if undo && time.Since(time.Unix(poop.CreatedAtUnix, 0)) > cfg.UndoGracePeriod {
+		if err := editCallbackMessage(m, query, formatters.FormatUndoExpired(cfg.UndoGracePeriod)); err != nil {
+			return err
+		}
+		return answerCallback(m, query, "Too late to undo")
+	}
+
+	err = r.DeletePoop(ctx, chatID, messageID, requesterID, time.Now().Unix())
+	if err != nil && !errors.Is(err, repo.ErrPoopNotFound) {
+		answerErr := answerCallback(m, query, "Sorry, I couldn't remove it. Please try again later!")
+		if answerErr != nil {
+			return fmt.Errorf("failed to answer callback: %w", answerErr)
+		}
+		return err
+	}
+
+	if err := editCallbackMessage(m, query, formatters.FormatPoopDeleted(poop.DisplayName, poop.Timestamp)); err != nil {
+		return err
+	}
+	return answerCallback(m, query, "Removed")
+}
+
+// HandleCancelDelete handles the "Keep it" button of a delete confirmation
+func HandleCancelDelete(ctx context.Context, m messenger.Messenger, r repo.Repository, cfg *config.Config, query *tg_bot.CallbackQuery, args []string) error {
+	ids, err := parseCallbackIDs(args, 1)
+	if err != nil {
+		return err
+	}
+
+	if query.From.ID != ids[0] {
+		return answerCallback(m, query, "Only the person who asked can cancel this.")
+	}
+
+	if err := editCallbackMessage(m, query, "👍 Keeping it, nothing was removed\\."); err != nil {
+		return err
+	}
+	return answerCallback(m, query, "Kept")
+}
+
+func GetCallbackHandlers() map[string]CallbackHandler {
+	return map[string]CallbackHandler{
+		confirmDeleteAction: HandleConfirmDelete,
+		confirmUndoAction:   HandleConfirmUndo,
+		cancelDeleteAction:  HandleCancelDelete,
+
+		pickBackfillSenderAction: HandlePickBackfillSender,
+		skipBackfillAction:       HandleSkipBackfill,
+	}
+}
+
+// HandleCallbackQuery routes inline keyboard presses to their respective handlers
+func HandleCallbackQuery(ctx context.Context, m messenger.Messenger, r repo.Repository, cfg *config.Config, query *tg_bot.CallbackQuery) {
+	action, argStr, _ := strings.Cut(query.Data, ":")
+	slog.DebugContext(ctx, "Callback received", "action", action)
+
+	handler, exists := GetCallbackHandlers()[action]
+	if !exists {
+		slog.WarnContext(ctx, "Unknown callback action", "action", action)
+		if err := answerCallback(m, query, ""); err != nil {
+			slog.ErrorContext(ctx, "Failed to answer callback", "error", err)
+		}
+		return
+	}
+
+	if err := handler(ctx, m, r, cfg, query, strings.Split(argStr, ":")); err != nil {
+		metrics.HandlerErrors.With(action).Inc()
+		slog.ErrorContext(ctx, "Error handling callback", "action", action, "error", err)
+	}
+}
+
+// callbackData encodes an action and its numeric arguments as inline button data
+func callbackData(action string, ids ...int64) string {
+	parts := []string{action}
+	for _, id := range ids {
+		parts = append(parts, strconv.FormatInt(id, 10))
+	}
+	return strings.Join(parts, ":")
+}
+
+func parseCallbackIDs(args []string, expected int) ([]int64, error) {
+	if len(args) != expected {
+		return nil, fmt.Errorf("expected %d callback arguments, got %d", expected, len(args))
+	}
+
+	ids := make([]int64, 0, len(args))
+	for _, arg := range args {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid callback argument %q: %w", arg, err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func answerCallback(m messenger.Messenger, query *tg_bot.CallbackQuery, text string) error {
+	return m.AnswerCallback(query.ID, text)
+}
+
+// editCallbackMessage replaces the confirmation message text, which also removes its buttons
+func editCallbackMessage(m messenger.Messenger, query *tg_bot.CallbackQuery, text string) error {
+	if query.Message == nil {
+		return nil
+	}
+
+	return m.EditText(query.Message.Chat.ID, query.Message.MessageID, text)
+}
@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"src/config"
+	"src/formatters"
+	"src/messenger"
+	repo "src/repository"
+
+	tg_bot "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	exportFormatCSV  = "csv"
+	exportFormatJSON = "json"
+)
+
+// exportedPoop is a log as written to JSON exports
+type exportedPoop struct {
+	MessageID int64   `json:"message_id"`
+	LocalTime string  `json:"local_time"`
+	Timezone  string  `json:"timezone"`
+	Username  string  `json:"username"`
+	DeletedAt *string `json:"deleted_at"`
+}
+
+type exportedMonth struct {
+	Month string `json:"month"`
+	Poops int    `json:"poops"`
+}
+
+// HandleExportMyData handles the /export_my_data command, sending the caller every log they made in the chat as a file in a private chat
+func HandleExportMyData(ctx context.Context, m messenger.Messenger, r repo.Repository, cfg *config.Config, update tg_bot.Update, chatID int64, userId int64, msg tg_bot.MessageConfig) error {
+	format := strings.ToLower(strings.TrimSpace(update.Message.CommandArguments()))
+	if format == "" {
+		format = exportFormatCSV
+	}
+	if format != exportFormatCSV && format != exportFormatJSON {
+		msg.Text = formatters.FormatInvalidExportFormat(format)
+		_, err := m.SendText(msg)
+		return err
+	}
+
+	monthlyStats, err := r.GetMonthlyPoopStats(ctx, chatID, userId)
+	if err != nil {
+		msg.Text = "Sorry, I couldn't export your data\\. Please try again later\\!"
+		_, sendErr := m.SendText(msg)
+		if sendErr != nil {
+			return fmt.Errorf("failed to send error message: %w", sendErr)
+		}
+		return err
+	}
+
+	// Bots can only message users who started a private chat with them, so find out before uploading anything
+	_, err = m.SendText(tg_bot.NewMessage(userId, formatters.FormatExportIntro(format)))
+	if err != nil {
+		msg.Text = formatters.FormatExportNeedsPrivateChat()
+		_, sendErr := m.SendText(msg)
+		if sendErr != nil {
+			return fmt.Errorf("failed to send error message: %w", sendErr)
+		}
+		return err
+	}
+
+	switch format {
+	case exportFormatJSON:
+		err = sendExport(m, userId, "my_poop_data.json", func(w io.Writer) error {
+			return writeJSONExport(ctx, w, r, chatID, userId, monthlyStats)
+		})
+	default:
+		err = sendExport(m, userId, "my_poop_log.csv", func(w io.Writer) error {
+			return writeCSVExport(ctx, w, r, chatID, userId)
+		})
+		if err == nil {
+			err = sendExport(m, userId, "my_monthly_stats.csv", func(w io.Writer) error {
+				return writeMonthlyStatsCSV(w, monthlyStats)
+			})
+		}
+	}
+	if err != nil {
+		msg.ChatID = userId
+		msg.Text = "Sorry, I couldn't export your data\\. Please try again later\\!"
+		_, sendErr := m.SendText(msg)
+		if sendErr != nil {
+			return fmt.Errorf("failed to send error message: %w", sendErr)
+		}
+		return err
+	}
+
+	if update.Message.Chat.IsPrivate() {
+		return nil
+	}
+	msg.Text = formatters.FormatExportSentPrivately()
+	_, err = m.SendText(msg)
+	return err
+}
+
+// sendExport writes the export to a temporary file, then uploads it as a document. The logs are read from
+// the database before the upload starts, so a slow upload never keeps the database from taking new logs.
+func sendExport(m messenger.Messenger, chatID int64, name string, write func(w io.Writer) error) error {
+	file, err := os.CreateTemp("", "export-*-"+name)
+	if err != nil {
+		return fmt.Errorf("failed to create export file: %w", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	buffered := bufio.NewWriter(file)
+	if err := write(buffered); err != nil {
+		return err
+	}
+	if err := buffered.Flush(); err != nil {
+		return err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	_, err = m.SendDocument(chatID, messenger.Document{Name: name, Reader: file})
+	return err
+}
+
+// exportTime renders a local time with its UTC offset, so exports are unambiguous across timezone changes
+func exportTime(t time.Time) string {
+	return t.Format(time.RFC3339)
+}
+
+func writeCSVExport(ctx context.Context, w io.Writer, r repo.Repository, chatID int64, userID int64) error {
+	out := csv.NewWriter(w)
+	if err := out.Write([]string{"message_id", "local_time", "timezone", "username", "deleted_at"}); err != nil {
+		return err
+	}
+
+	err := r.StreamUserPoops(ctx, chatID, userID, func(poop repo.ExportedPoop) error {
+		deletedAt := ""
+		if !poop.DeletedAt.IsZero() {
+			deletedAt = exportTime(poop.DeletedAt)
+		}
+		return out.Write([]string{strconv.FormatInt(poop.MessageID, 10), exportTime(poop.LocalTime), poop.Timezone, poop.Username, deletedAt})
+	})
+	if err != nil {
+		return err
+	}
+
+	out.Flush()
+	return out.Error()
+}
+
+func writeMonthlyStatsCSV(w io.Writer, monthlyStats []repo.MonthlyPoopCount) error {
+	out := csv.NewWriter(w)
+	if err := out.Write([]string{"month", "poops"}); err != nil {
+		return err
+	}
+	for _, month := range monthlyStats {
+		if err := out.Write([]string{month.Month, strconv.Itoa(month.PoopCount)}); err != nil {
+			return err
+		}
+	}
+
+	out.Flush()
+	return out.Error()
+}
+
+// writeJSONExport writes a single JSON object, with the logs written one at a time as they are read
+func writeJSONExport(ctx context.Context, w io.Writer, r repo.Repository, chatID int64, userID int64, monthlyStats []repo.MonthlyPoopCount) error {
+	months := make([]exportedMonth, 0, len(monthlyStats))
+	for _, month := range monthlyStats {
+		months = append(months, exportedMonth{Month: month.Month, Poops: month.PoopCount})
+	}
+	monthsJSON, err := json.Marshal(months)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, `{"chat_id":%d,"user_id":%d,"exported_at":%q,"monthly_stats":%s,"poops":[`, chatID, userID, exportTime(time.Now().UTC()), monthsJSON)
+	if err != nil {
+		return err
+	}
+
+	separator := ""
+	err = r.StreamUserPoops(ctx, chatID, userID, func(poop repo.ExportedPoop) error {
+		record := exportedPoop{
+			MessageID: poop.MessageID,
+			LocalTime: exportTime(poop.LocalTime),
+			Timezone:  poop.Timezone,
+			Username:  poop.Username,
+		}
+		if !poop.DeletedAt.IsZero() {
+			deletedAt := exportTime(poop.DeletedAt)
+			record.DeletedAt = &deletedAt
+		}
+
+		data, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, separator); err != nil {
+			return err
+		}
+		separator = ","
+		_, err = w.Write(data)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "]}")
+	return err
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"src/messenger"
+
+	tg_bot "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestExportMyData_CSV(t *testing.T) {
+	r, m, cfg := setupTest(t)
+	ctx := context.Background()
+	logPoop(t, r, 1001, "alice", 1, time.Date(2025, 1, 31, 23, 0, 0, 0, time.UTC))
+	logPoop(t, r, 1001, "alice", 2, time.Date(2025, 2, 1, 8, 0, 0, 0, time.UTC))
+	logPoop(t, r, 1002, "bob", 3, time.Date(2025, 2, 1, 9, 0, 0, 0, time.UTC))
+	if err := r.SetUserTimezone(ctx, 1001, "Asia/Tokyo"); err != nil {
+		t.Fatalf("SetUserTimezone() error = %v", err)
+	}
+
+	runCommand(t, r, m, cfg, commandUpdate(1001, "alice", "/export_my_data"))
+
+	documents := m.CallsTo("SendDocument")
+	if len(documents) != 2 {
+		t.Fatalf("/export_my_data sent %+v, want the log and the monthly stats", m.Calls())
+	}
+	for _, document := range documents {
+		if document.ChatID != 1001 {
+			t.Errorf("%s was sent to chat %d, want alice's private chat", document.FileName, document.ChatID)
+		}
+	}
+
+	records, err := csv.NewReader(bytes.NewReader(documents[0].FileData)).ReadAll()
+	if err != nil {
+		t.Fatalf("The log isn't valid CSV: %v", err)
+	}
+	want := [][]string{
+		{"message_id", "local_time", "timezone", "username", "deleted_at"},
+		{"1", "2025-02-01T08:00:00+09:00", "Asia/Tokyo", "alice", ""},
+		{"2", "2025-02-01T17:00:00+09:00", "Asia/Tokyo", "alice", ""},
+	}
+	if fmt.Sprint(records) != fmt.Sprint(want) {
+		t.Errorf("exported log = %v, want %v", records, want)
+	}
+
+	if got := string(documents[1].FileData); got != "month,poops\n2025-02,2\n" {
+		t.Errorf("exported monthly stats = %q", got)
+	}
+
+	// The group is told where the data went
+	sent := m.CallsTo("SendText")
+	if len(sent) != 2 || sent[0].ChatID != 1001 || sent[1].ChatID != testChatID {
+		t.Errorf("/export_my_data sent messages %+v, want an intro to alice and a note in the group", sent)
+	}
+}
+
+func TestExportMyData_JSON(t *testing.T) {
+	r, m, cfg := setupTest(t)
+	ctx := context.Background()
+	for i := 1; i <= 3; i++ {
+		logPoop(t, r, 1001, "alice", int64(i), time.Date(2025, 3, i, 8, 0, 0, 0, time.UTC))
+	}
+	if err := r.DeletePoop(ctx, testChatID, 3, 1001, time.Now().Unix()); err != nil {
+		t.Fatalf("DeletePoop() error = %v", err)
+	}
+
+	runCommand(t, r, m, cfg, commandUpdate(1001, "alice", "/export_my_data JSON"))
+
+	documents := m.CallsTo("SendDocument")
+	if len(documents) != 1 || documents[0].FileName != "my_poop_data.json" {
+		t.Fatalf("/export_my_data json sent %+v, want a single JSON document", m.Calls())
+	}
+
+	var export struct {
+		UserID       int64           `json:"user_id"`
+		MonthlyStats []exportedMonth `json:"monthly_stats"`
+		Poops        []exportedPoop  `json:"poops"`
+	}
+	if err := json.Unmarshal(documents[0].FileData, &export); err != nil {
+		t.Fatalf("The export isn't valid JSON: %v\n%s", err, documents[0].FileData)
+	}
+	if export.UserID != 1001 || len(export.Poops) != 3 {
+		t.Errorf("export = %+v, want alice's 3 logs", export)
+	}
+	if len(export.MonthlyStats) != 1 || export.MonthlyStats[0] != (exportedMonth{Month: "2025-03", Poops: 2}) {
+		t.Errorf("monthly stats = %+v, want the 2 logs that weren't deleted in March", export.MonthlyStats)
+	}
+	if export.Poops[0].DeletedAt != nil || export.Poops[2].DeletedAt == nil {
+		t.Errorf("poops = %+v, want only the last one deleted", export.Poops)
+	}
+}
+
+func TestExportMyData_InvalidFormat(t *testing.T) {
+	r, m, cfg := setupTest(t)
+
+	runCommand(t, r, m, cfg, commandUpdate(1001, "alice", "/export_my_data xml"))
+
+	sent := m.CallsTo("SendText")
+	if len(sent) != 1 || sent[0].ChatID != testChatID || !strings.Contains(sent[0].Text, "xml") {
+		t.Errorf("/export_my_data xml sent %+v, want an explanation in the group", m.Calls())
+	}
+	if len(m.CallsTo("SendDocument")) != 0 {
+		t.Error("/export_my_data xml sent a document")
+	}
+}
+
+func TestExportMyData_NoPrivateChat(t *testing.T) {
+	r, m, cfg := setupTest(t)
+	m.Err = errors.New("Forbidden: bot can't initiate conversation with a user")
+
+	runCommand(t, r, m, cfg, commandUpdate(1001, "alice", "/export_my_data"))
+
+	calls := m.Calls()
+	if len(calls) != 2 || calls[0].ChatID != 1001 || calls[1].ChatID != testChatID || !strings.Contains(calls[1].Text, "private chat") {
+		t.Errorf("/export_my_data without a private chat made %+v, want a failed intro then an explanation in the group", calls)
+	}
+}
+
+// slowUploader is a Recorder whose uploads take long enough for a member to log a poop meanwhile
+type slowUploader struct {
+	*messenger.Recorder
+	during func() error
+	errs   []error
+}
+
+// SendDocument starts reading the document, logs a poop, then reads the rest
+func (s *slowUploader) SendDocument(chatID int64, document messenger.Document) (int, error) {
+	start := make([]byte, 1)
+	n, err := document.Reader.Read(start)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return 0, err
+	}
+	s.errs = append(s.errs, s.during())
+	document.Reader = io.MultiReader(bytes.NewReader(start[:n]), document.Reader)
+	return s.Recorder.SendDocument(chatID, document)
+}
+
+func TestExportMyData_DoesNotBlockLogging(t *testing.T) {
+	r, recorder, cfg := setupTest(t)
+	ctx := context.Background()
+	// More logs than fit in the write buffer, so a streamed export would still be reading them during the upload
+	for i := 1; i <= 300; i++ {
+		logPoop(t, r, 1001, "alice", int64(i), time.Date(2025, 3, 1, 8, 0, 0, 0, time.UTC).Add(time.Duration(i)*time.Hour))
+	}
+
+	next := int64(1000)
+	m := &slowUploader{Recorder: recorder, during: func() error {
+		next++
+		at := time.Now().UTC()
+		return r.LogPoop(ctx, testChatID, 1002, "bob", next, at.Format("2006-01-02 15:04:05"), at.Unix())
+	}}
+	update := commandUpdate(1001, "alice", "/export_my_data")
+	if err := HandleExportMyData(ctx, m, r, cfg, update, testChatID, 1001, tg_bot.NewMessage(testChatID, "")); err != nil {
+		t.Fatalf("HandleExportMyData() error = %v", err)
+	}
+
+	if len(m.errs) != 2 {
+		t.Fatalf("uploaded %d documents, want 2", len(m.errs))
+	}
+	for _, err := range m.errs {
+		if err != nil {
+			t.Errorf("LogPoop() during an upload error = %v", err)
+		}
+	}
+}
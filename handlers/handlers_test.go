@@ -0,0 +1,319 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"src/config"
+	"src/messenger"
+	"src/metrics"
+	repo "src/repository"
+
+	tg_bot "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	testChatID  = int64(-100123)
+	testAdminID = int64(1)
+)
+
+func setupTest(t *testing.T) (repo.Repository, *messenger.Recorder, *config.Config) {
+	t.Helper()
+	cfg := &config.Config{
+		DBPath:          filepath.Join(t.TempDir(), "test.db"),
+		GroupChatID:     testChatID,
+		MyChatID:        testAdminID,
+		DefaultTimezone: "UTC",
+		UndoGracePeriod: 15 * time.Minute,
+	}
+
+	db, err := repo.OpenDBConnection(cfg)
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	r := repo.NewRepository(db)
+	if err := r.RegisterGroup(context.Background(), testChatID, "Poopers", "UTC"); err != nil {
+		t.Fatalf("Failed to register test group: %v", err)
+	}
+	return r, messenger.NewRecorder(), cfg
+}
+
+// commandUpdate builds the update Telegram sends for a command typed in the test group
+func commandUpdate(userID int64, username string, text string) tg_bot.Update {
+	command, _, _ := strings.Cut(text, " ")
+	return tg_bot.Update{Message: &tg_bot.Message{
+		MessageID: 500,
+		From:      &tg_bot.User{ID: userID, UserName: username},
+		Chat:      &tg_bot.Chat{ID: testChatID, Type: "supergroup"},
+		Date:      int(time.Now().Unix()),
+		Text:      text,
+		Entities:  []tg_bot.MessageEntity{{Type: "bot_command", Offset: 0, Length: len(command)}},
+	}}
+}
+
+func runCommand(t *testing.T, r repo.Repository, m *messenger.Recorder, cfg *config.Config, update tg_bot.Update) {
+	t.Helper()
+	msg := tg_bot.NewMessage(update.Message.Chat.ID, update.Message.Text)
+	HandleCommand(context.Background(), m, r, cfg, update, update.Message.Chat.ID, update.Message.From.ID, msg)
+}
+
+func logPoop(t *testing.T, r repo.Repository, userID int64, username string, messageID int64, at time.Time) {
+	t.Helper()
+	at = at.UTC()
+	err := r.LogPoop(context.Background(), testChatID, userID, username, messageID, at.Format("2006-01-02 15:04:05"), at.Unix())
+	if err != nil {
+		t.Fatalf("Failed to log poop: %v", err)
+	}
+}
+
+func TestUndo(t *testing.T) {
+	r, m, cfg := setupTest(t)
+	ctx := context.Background()
+	logPoop(t, r, 1001, "alice", 42, time.Now().Add(-time.Minute))
+
+	runCommand(t, r, m, cfg, commandUpdate(1001, "alice", "/undo"))
+
+	sent := m.CallsTo("SendText")
+	if len(sent) != 1 || sent[0].Keyboard == nil {
+		t.Fatalf("/undo sent %+v, want a single confirmation with buttons", sent)
+	}
+	confirm := sent[0].Keyboard.InlineKeyboard[0][0].CallbackData
+	if confirm == nil {
+		t.Fatal("The confirmation has no callback data")
+	}
+
+	// Someone else pressing the button doesn't remove anything
+	query := &tg_bot.CallbackQuery{
+		ID:      "query",
+		From:    &tg_bot.User{ID: 1002},
+		Message: &tg_bot.Message{MessageID: 7, Chat: &tg_bot.Chat{ID: testChatID}},
+		Data:    *confirm,
+	}
+	HandleCallbackQuery(ctx, m, r, cfg, query)
+	if _, err := r.GetPoopByMessageID(ctx, testChatID, 42); err != nil {
+		t.Fatalf("The poop was removed by someone else: %v", err)
+	}
+
+	query.From = &tg_bot.User{ID: 1001}
+	HandleCallbackQuery(ctx, m, r, cfg, query)
+	if _, err := r.GetPoopByMessageID(ctx, testChatID, 42); !errors.Is(err, repo.ErrPoopNotFound) {
+		t.Errorf("GetPoopByMessageID() after confirming error = %v, want ErrPoopNotFound", err)
+	}
+
+	edits := m.CallsTo("EditText")
+	if len(edits) != 1 || edits[0].MessageID != 7 || !strings.Contains(edits[0].Text, "Removed") {
+		t.Errorf("confirming edited %+v, want the confirmation to say it was removed", edits)
+	}
+	if answers := m.CallsTo("AnswerCallback"); len(answers) != 2 {
+		t.Errorf("%d callbacks were answered, want 2", len(answers))
+	}
+}
+
+func TestUndo_Expired(t *testing.T) {
+	r, m, cfg := setupTest(t)
+	logPoop(t, r, 1001, "alice", 42, time.Now().Add(-time.Hour))
+
+	runCommand(t, r, m, cfg, commandUpdate(1001, "alice", "/undo"))
+
+	sent := m.CallsTo("SendText")
+	if len(sent) != 1 || sent[0].Keyboard != nil || !strings.Contains(sent[0].Text, "15 minutes") {
+		t.Errorf("/undo of an old poop sent %+v, want an explanation without buttons", sent)
+	}
+}
+
+func TestUndo_ExpiresBeforeConfirming(t *testing.T) {
+	r, m, cfg := setupTest(t)
+	ctx := context.Background()
+
+	// The log was imported, so it has no username
+	logPoop(t, r, 1001, "", 42, time.Now().Add(-time.Minute))
+	if err := r.UpsertUser(ctx, repo.User{UserID: 1001, FirstName: "Alice"}); err != nil {
+		t.Fatalf("UpsertUser() error = %v", err)
+	}
+
+	runCommand(t, r, m, cfg, commandUpdate(1001, "", "/undo"))
+
+	sent := m.CallsTo("SendText")
+	if len(sent) != 1 || sent[0].Keyboard == nil || !strings.Contains(sent[0].Text, "Alice") {
+		t.Fatalf("/undo sent %+v, want a confirmation naming Alice", sent)
+	}
+
+	// The button is pressed after the grace period ran out
+	cfg.UndoGracePeriod = 30 * time.Second
+	HandleCallbackQuery(ctx, m, r, cfg, &tg_bot.CallbackQuery{
+		ID:      "query",
+		From:    &tg_bot.User{ID: 1001},
+		Message: &tg_bot.Message{MessageID: 7, Chat: &tg_bot.Chat{ID: testChatID}},
+		Data:    *sent[0].Keyboard.InlineKeyboard[0][0].CallbackData,
+	})
+	if _, err := r.GetPoopByMessageID(ctx, testChatID, 42); err != nil {
+		t.Errorf("GetPoopByMessageID() after the grace period error = %v, want the poop kept", err)
+	}
+	if edits := m.CallsTo("EditText"); len(edits) != 1 || !strings.Contains(edits[0].Text, "delete\\_poop") {
+		t.Errorf("confirming late edited %+v, want it to point at /delete_poop", edits)
+	}
+}
+
+func TestTimezone_OnlyAdminCanChange(t *testing.T) {
+	r, m, cfg := setupTest(t)
+	ctx := context.Background()
+
+	runCommand(t, r, m, cfg, commandUpdate(1001, "alice", "/timezone"))
+	if sent := m.CallsTo("SendText"); len(sent) != 1 || !strings.Contains(sent[0].Text, "`UTC`") {
+		t.Errorf("/timezone sent %+v, want the group's timezone", sent)
+	}
+
+	m.Reset()
+	runCommand(t, r, m, cfg, commandUpdate(1001, "alice", "/timezone Europe/Lisbon"))
+	if timezone, _ := r.GetGroupTimezone(ctx, testChatID); timezone != "UTC" {
+		t.Errorf("GetGroupTimezone() after a member changed it = %q, want UTC", timezone)
+	}
+	if sent := m.CallsTo("SendText"); len(sent) != 1 || !strings.Contains(sent[0].Text, "Only the admin") {
+		t.Errorf("/timezone by a member sent %+v, want a refusal", sent)
+	}
+
+	runCommand(t, r, m, cfg, commandUpdate(testAdminID, "admin", "/timezone Europe/Lisbon"))
+	if timezone, _ := r.GetGroupTimezone(ctx, testChatID); timezone != "Europe/Lisbon" {
+		t.Errorf("GetGroupTimezone() after the admin changed it = %q, want Europe/Lisbon", timezone)
+	}
+}
+
+func TestRegisterSticker(t *testing.T) {
+	r, m, cfg := setupTest(t)
+	ctx := context.Background()
+
+	update := commandUpdate(1001, "alice", "/register_sticker 🔥")
+	update.Message.ReplyToMessage = &tg_bot.Message{Sticker: &tg_bot.Sticker{FileUniqueID: "AgADnew", SetName: "Poopers3"}}
+
+	runCommand(t, r, m, cfg, update)
+	if emoji, _ := r.GetStickerEmoji(ctx, "AgADnew"); emoji != "" {
+		t.Errorf("a member registered a sticker reaction %s", emoji)
+	}
+
+	update.Message.From.ID = testAdminID
+	runCommand(t, r, m, cfg, update)
+	if emoji, _ := r.GetStickerEmoji(ctx, "AgADnew"); emoji != "🔥" {
+		t.Errorf("GetStickerEmoji() after the admin registered it = %q, want 🔥", emoji)
+	}
+
+	if sent := m.CallsTo("SendText"); len(sent) != 2 {
+		t.Errorf("/register_sticker sent %d messages, want 2", len(sent))
+	}
+}
+
+func TestPersonalWrapped(t *testing.T) {
+	r, m, cfg := setupTest(t)
+	logPoop(t, r, 1001, "alice", 1, time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC))
+	logPoop(t, r, 1001, "alice", 2, time.Date(2024, 5, 2, 8, 0, 0, 0, time.UTC))
+
+	runCommand(t, r, m, cfg, commandUpdate(1001, "alice", "/poop_wrapped 2024"))
+
+	albums := m.CallsTo("SendAlbum")
+	if len(albums) != 1 || len(albums[0].Photos) != 5 || albums[0].ChatID != testChatID {
+		t.Fatalf("/poop_wrapped sent %+v, want one album of 5 slides", m.Calls())
+	}
+
+	m.Reset()
+	runCommand(t, r, m, cfg, commandUpdate(1001, "alice", "/poop_wrapped 2023"))
+	if sent := m.CallsTo("SendText"); len(sent) != 1 || len(m.CallsTo("SendAlbum")) != 0 {
+		t.Errorf("/poop_wrapped for a year without poops sent %+v, want a single message", m.Calls())
+	}
+}
+
+func TestLeaderboardPeriod(t *testing.T) {
+	today := time.Date(2025, 3, 12, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		args    string
+		want    repo.Period
+		wantErr bool
+	}{
+		{args: "", want: repo.MonthPeriod(2025, time.March)},
+		{args: "week", want: repo.WeekPeriod(today)},
+		{args: "2025-01", want: repo.MonthPeriod(2025, time.January)},
+		{args: "2024", want: repo.YearPeriod(2024)},
+		{args: "2025-01-01..2025-02-15", want: repo.RangePeriod(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 2, 15, 0, 0, 0, 0, time.UTC))},
+		{args: "2025-W11", want: repo.ISOWeekPeriod(2025, 11)},
+		{args: "2026-W53", want: repo.ISOWeekPeriod(2026, 53)},
+		{args: "2025-W53", wantErr: true},
+		{args: "2025-02-15..2025-01-01", wantErr: true},
+		{args: "2025-13", wantErr: true},
+		{args: "yesterday", wantErr: true},
+		{args: "99", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := leaderboardPeriod(tt.args, today)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("leaderboardPeriod(%q) error = %v, wantErr %v", tt.args, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("leaderboardPeriod(%q) = %+v, want %+v", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestLeaderboard_Period(t *testing.T) {
+	r, m, cfg := setupTest(t)
+	logPoop(t, r, 1001, "alice", 1, time.Date(2025, 3, 1, 8, 0, 0, 0, time.UTC))
+	logPoop(t, r, 1002, "bob", 2, time.Date(2025, 4, 1, 8, 0, 0, 0, time.UTC))
+
+	runCommand(t, r, m, cfg, commandUpdate(1001, "alice", "/leaderboard 2025-03"))
+	sent := m.CallsTo("SendText")
+	if len(sent) != 1 || !strings.HasPrefix(sent[0].Text, "Leaderboard for March 2025") || !strings.Contains(sent[0].Text, "alice") || strings.Contains(sent[0].Text, "bob") {
+		t.Errorf("/leaderboard 2025-03 sent %+v, want March's leaderboard with only alice", sent)
+	}
+}
+
+func TestWeeklyLeaderboard(t *testing.T) {
+	r, m, cfg := setupTest(t)
+	logPoop(t, r, 1001, "alice", 1, time.Now())
+	logPoop(t, r, 1002, "bob", 2, time.Now().AddDate(0, 0, -8))
+
+	runCommand(t, r, m, cfg, commandUpdate(1001, "alice", "/leaderboard_week"))
+	sent := m.CallsTo("SendText")
+	if len(sent) != 1 || !strings.HasPrefix(sent[0].Text, "Leaderboard for the week of") || !strings.Contains(sent[0].Text, "alice") || strings.Contains(sent[0].Text, "bob") {
+		t.Errorf("/leaderboard_week sent %+v, want this week's leaderboard with only alice", sent)
+	}
+}
+
+func TestHandleCommand_CountsCommands(t *testing.T) {
+	r, m, cfg := setupTest(t)
+
+	leaderboards := metrics.Commands.With("leaderboard").Value()
+	unknown := metrics.Commands.With("unknown").Value()
+
+	runCommand(t, r, m, cfg, commandUpdate(1001, "alice", "/leaderboard"))
+	runCommand(t, r, m, cfg, commandUpdate(1001, "alice", "/definitely_not_a_command"))
+
+	if got := metrics.Commands.With("leaderboard").Value(); got != leaderboards+1 {
+		t.Errorf("leaderboard commands = %d, want %d", got, leaderboards+1)
+	}
+	if got := metrics.Commands.With("unknown").Value(); got != unknown+1 {
+		t.Errorf("unknown commands = %d, want %d", got, unknown+1)
+	}
+}
+
+func TestHandleCallbackQuery_CountsErrors(t *testing.T) {
+	r, m, cfg := setupTest(t)
+
+	failures := metrics.HandlerErrors.With(pickBackfillSenderAction).Value()
+
+	query := &tg_bot.CallbackQuery{
+		ID:      "query",
+		From:    &tg_bot.User{ID: testAdminID},
+		Message: &tg_bot.Message{MessageID: 31, Chat: &tg_bot.Chat{ID: testAdminID}},
+		Data:    pickBackfillSenderAction + ":not-a-number",
+	}
+	HandleCallbackQuery(context.Background(), m, r, cfg, query)
+
+	if got := metrics.HandlerErrors.With(pickBackfillSenderAction).Value(); got != failures+1 {
+		t.Errorf("%s errors = %d, want %d", pickBackfillSenderAction, got, failures+1)
+	}
+}
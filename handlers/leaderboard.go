@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"src/config"
+	"src/formatters"
+	"src/messenger"
+	repo "src/repository"
+
+	tg_bot "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// groupToday returns the current time in the group's timezone, which decides what "this month" means
+func groupToday(ctx context.Context, r repo.Repository, chatID int64) (time.Time, error) {
+	timezone, err := r.GetGroupTimezone(ctx, chatID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timezone %q: %w", timezone, err)
+	}
+	return time.Now().In(loc), nil
+}
+
+// leaderboardPeriod picks the period asked for in /leaderboard [period], defaulting to the current month.
+// A period is week, month or year for the current one, a year like 2024, a month like 2025-03,
+// an ISO week like 2025-W11 or a range like 2025-01-01..2025-02-15.
+func leaderboardPeriod(args string, today time.Time) (repo.Period, error) {
+	args = strings.ToLower(strings.TrimSpace(args))
+	switch args {
+	case "", "month":
+		return repo.MonthPeriod(today.Year(), today.Month()), nil
+	case "week":
+		return repo.WeekPeriod(today), nil
+	case "year":
+		return repo.YearPeriod(today.Year()), nil
+	}
+
+	if first, last, ok := strings.Cut(args, ".."); ok {
+		from, errFrom := time.Parse("2006-01-02", strings.TrimSpace(first))
+		to, errTo := time.Parse("2006-01-02", strings.TrimSpace(last))
+		if errFrom != nil || errTo != nil {
+			return repo.Period{}, fmt.Errorf("invalid date range %q", args)
+		}
+		if to.Before(from) {
+			return repo.Period{}, fmt.Errorf("date range %q ends before it starts", args)
+		}
+		return repo.RangePeriod(from, to), nil
+	}
+
+	if yearStr, weekStr, ok := strings.Cut(args, "-w"); ok {
+		year, errYear := strconv.Atoi(yearStr)
+		week, errWeek := strconv.Atoi(weekStr)
+		if errYear != nil || errWeek != nil || year < 1 || week < 1 {
+			return repo.Period{}, fmt.Errorf("invalid week %q", args)
+		}
+		period := repo.ISOWeekPeriod(year, week)
+		// Only some years have a 53rd week
+		if isoYear, isoWeek := period.Start.ISOWeek(); isoYear != year || isoWeek != week {
+			return repo.Period{}, fmt.Errorf("%d has no week %d", year, week)
+		}
+		return period, nil
+	}
+
+	if month, err := time.Parse("2006-01", args); err == nil {
+		return repo.MonthPeriod(month.Year(), month.Month()), nil
+	}
+
+	year, err := strconv.Atoi(args)
+	if err != nil || year < 1 || len(args) != 4 {
+		return repo.Period{}, fmt.Errorf("invalid period %q", args)
+	}
+	return repo.YearPeriod(year), nil
+}
+
+// sendLeaderboard sends the full leaderboard of the period described by args, see leaderboardPeriod
+func sendLeaderboard(ctx context.Context, m messenger.Messenger, r repo.Repository, chatID int64, msg tg_bot.MessageConfig, args string) error {
+	today, err := groupToday(ctx, r, chatID)
+	if err != nil {
+		msg.Text = "Sorry, I couldn't retrieve the leaderboard\\. Please try again later\\!"
+		_, sendErr := m.SendText(msg)
+		if sendErr != nil {
+			return fmt.Errorf("failed to send error message: %w", sendErr)
+		}
+		return err
+	}
+
+	period, err := leaderboardPeriod(args, today)
+	if err != nil {
+		msg.Text = formatters.FormatInvalidLeaderboardPeriod(args)
+		_, sendErr := m.SendText(msg)
+		return sendErr
+	}
+
+	leaderboard, err := r.GetLeaderboard(ctx, chatID, period, repo.MostPoopsFirst, 0)
+	if err != nil {
+		msg.Text = "Sorry, I couldn't retrieve the leaderboard\\. Please try again later\\!"
+		_, sendErr := m.SendText(msg)
+		if sendErr != nil {
+			return fmt.Errorf("failed to send error message: %w", sendErr)
+		}
+		return err
+	}
+
+	msg.Text = formatters.FormatLeaderboard(period, leaderboard)
+	_, err = m.SendText(msg)
+	return err
+}
+
+// HandleLeaderboard handles the /leaderboard [period] command
+func HandleLeaderboard(ctx context.Context, m messenger.Messenger, r repo.Repository, cfg *config.Config, update tg_bot.Update, chatID int64, userId int64, msg tg_bot.MessageConfig) error {
+	return sendLeaderboard(ctx, m, r, chatID, msg, update.Message.CommandArguments())
+}
+
+// HandleWeeklyLeaderboard handles the /leaderboard_week command, the leaderboard of the current Monday to Sunday week
+func HandleWeeklyLeaderboard(ctx context.Context, m messenger.Messenger, r repo.Repository, cfg *config.Config, update tg_bot.Update, chatID int64, userId int64, msg tg_bot.MessageConfig) error {
+	return sendLeaderboard(ctx, m, r, chatID, msg, "week")
+}
+
+// sendPoodium sends the top or bottom three of the group's current month or year, prefixed by title
+func sendPoodium(ctx context.Context, m messenger.Messenger, r repo.Repository, chatID int64, msg tg_bot.MessageConfig, period func(today time.Time) repo.Period, order repo.Order, name string, title string) error {
+	today, err := groupToday(ctx, r, chatID)
+	var poodium []repo.UserPoopCount
+	if err == nil {
+		poodium, err = r.GetLeaderboard(ctx, chatID, period(today), order, 3)
+	}
+	if err != nil {
+		msg.Text = fmt.Sprintf("Sorry, I couldn't retrieve the %s\\. Please try again later\\!", name)
+		_, sendErr := m.SendText(msg)
+		if sendErr != nil {
+			return fmt.Errorf("failed to send error message: %w", sendErr)
+		}
+		return err
+	}
+
+	msg.Text = title + formatters.BuildPoodiumMessage(poodium)
+	_, err = m.SendText(msg)
+	return err
+}
+
+func currentMonth(today time.Time) repo.Period {
+	return repo.MonthPeriod(today.Year(), today.Month())
+}
+
+func currentYear(today time.Time) repo.Period {
+	return repo.YearPeriod(today.Year())
+}
+
+// HandleBottomPoopers handles the /bottom_poopers command
+func HandleBottomPoopers(ctx context.Context, m messenger.Messenger, r repo.Repository, cfg *config.Config, update tg_bot.Update, chatID int64, userId int64, msg tg_bot.MessageConfig) error {
+	return sendPoodium(ctx, m, r, chatID, msg, currentMonth, repo.FewestPoopsFirst, "bottom poopers", "This month's bottom poopers are:\n")
+}
+
+// HandlePoodium handles the /poodium command
+func HandlePoodium(ctx context.Context, m messenger.Messenger, r repo.Repository, cfg *config.Config, update tg_bot.Update, chatID int64, userId int64, msg tg_bot.MessageConfig) error {
+	return sendPoodium(ctx, m, r, chatID, msg, currentMonth, repo.MostPoopsFirst, "monthly poodium", "This month's top poopers are:\n")
+}
+
+// HandleYearlyPoodium handles the /poodium_year command
+func HandleYearlyPoodium(ctx context.Context, m messenger.Messenger, r repo.Repository, cfg *config.Config, update tg_bot.Update, chatID int64, userId int64, msg tg_bot.MessageConfig) error {
+	return sendPoodium(ctx, m, r, chatID, msg, currentYear, repo.MostPoopsFirst, "yearly poodium", "This year's top poopers are:\n")
+}
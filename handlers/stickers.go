@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"src/config"
+	"src/formatters"
+	"src/messenger"
+	repo "src/repository"
+
+	tg_bot "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// HandleRegisterSticker handles the /register_sticker command, sent by the admin as a reply to a sticker with the emoji to react with
+func HandleRegisterSticker(ctx context.Context, m messenger.Messenger, r repo.Repository, cfg *config.Config, update tg_bot.Update, chatID int64, userId int64, msg tg_bot.MessageConfig) error {
+	if userId != cfg.MyChatID {
+		msg.Text = "Only the admin can register stickers\\."
+		_, err := m.SendText(msg)
+		return err
+	}
+
+	reply := update.Message.ReplyToMessage
+	emoji := strings.TrimSpace(update.Message.CommandArguments())
+	if reply == nil || reply.Sticker == nil || emoji == "" {
+		msg.Text = "Reply to a sticker with _/register\\_sticker 🎉_ to choose how I react to it\\."
+		_, err := m.SendText(msg)
+		return err
+	}
+
+	sticker := repo.Sticker{
+		FileUniqueID: reply.Sticker.FileUniqueID,
+		SetName:      reply.Sticker.SetName,
+		Emoji:        emoji,
+	}
+	err := r.RegisterSticker(ctx, sticker, userId, time.Now().Unix())
+	if err != nil {
+		msg.Text = "Sorry, I couldn't register that sticker\\. Please try again later\\!"
+		_, sendErr := m.SendText(msg)
+		if sendErr != nil {
+			return fmt.Errorf("failed to send error message: %w", sendErr)
+		}
+		return err
+	}
+
+	msg.Text = formatters.FormatStickerRegistered(sticker)
+	_, err = m.SendText(msg)
+	return err
+}
+
+// HandleStickers handles the /stickers command, listing the registered sticker reactions
+func HandleStickers(ctx context.Context, m messenger.Messenger, r repo.Repository, cfg *config.Config, update tg_bot.Update, chatID int64, userId int64, msg tg_bot.MessageConfig) error {
+	stickers, err := r.GetStickers(ctx)
+	if err != nil {
+		msg.Text = "Sorry, I couldn't retrieve the stickers\\. Please try again later\\!"
+		_, sendErr := m.SendText(msg)
+		if sendErr != nil {
+			return fmt.Errorf("failed to send error message: %w", sendErr)
+		}
+		return err
+	}
+
+	msg.Text = formatters.FormatStickers(stickers)
+	_, err = m.SendText(msg)
+	return err
+}
@@ -2,131 +2,148 @@ package handlers
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"log"
-	"os"
-	"os/exec"
-	"path/filepath"
-	repo "src/repository"
+	"log/slog"
+	"strconv"
+	"strings"
 	"time"
 
+	"src/config"
+	"src/formatters"
+	"src/messenger"
+	repo "src/repository"
+	"src/wrapped"
+
 	tg_bot "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
-type PersonalWrappedStats struct {
-	UserID 			 int64
-	Username 		 string
-	Year 			 int
-	TotalPoops 		 int
-	GroupTotal 		 int
-	GroupRank 		 repo.YearlyRanking
-	MaxStreak 		 int
-	DayWithMostPoops string
-	MostPoopsCount   int
-	DaysWithoutPoop  int
+// wrappedYear picks the year asked for in /poop_wrapped [year], defaulting to the most recent completed year.
+// today is in the group's timezone, the year doesn't complete on New Year's Eve in UTC.
+func wrappedYear(args string, today time.Time) (int, error) {
+	args = strings.TrimSpace(args)
+	if args == "" {
+		return today.Year() - 1, nil
+	}
+
+	year, err := strconv.Atoi(args)
+	if err != nil || year < 1 {
+		return 0, fmt.Errorf("invalid year %q", args)
+	}
+	if year > today.Year() {
+		return 0, fmt.Errorf("year %d hasn't happened yet", year)
+	}
+	return year, nil
 }
 
-func HandlePersonalWrapped(ctx context.Context, bot *tg_bot.BotAPI, r repo.Repository, update tg_bot.Update, userID int64, msg tg_bot.MessageConfig) error {
-	year := 2025
+// HandlePersonalWrapped handles the /poop_wrapped [year] command
+func HandlePersonalWrapped(ctx context.Context, m messenger.Messenger, r repo.Repository, cfg *config.Config, update tg_bot.Update, chatID int64, userID int64, msg tg_bot.MessageConfig) error {
+	today, err := groupToday(ctx, r, chatID)
+	if err != nil {
+		msg.Text = "Sorry, I couldn't retrieve your year\\. Please try again later\\!"
+		_, sendErr := m.SendText(msg)
+		if sendErr != nil {
+			return fmt.Errorf("failed to send error message: %w", sendErr)
+		}
+		return err
+	}
 
-	yearlyCount, err := r.GetYearlyPoopCount(ctx, userID, year)
+	year, err := wrappedYear(update.Message.CommandArguments(), today)
 	if err != nil {
-		return fmt.Errorf("failed to get yearly count: %w", err)
+		msg.Text = formatters.FormatInvalidWrappedYear(update.Message.CommandArguments())
+		_, sendErr := m.SendText(msg)
+		return sendErr
 	}
 
-	stats := PersonalWrappedStats {
-		UserID: userID,
-		Username: update.Message.From.UserName,
-		Year: year,
-		TotalPoops: yearlyCount,
+	yearlyCount, err := r.GetYearlyPoopCount(ctx, chatID, userID, year)
+	if err != nil {
+		return fmt.Errorf("failed to get yearly count: %w", err)
 	}
 
-	groupStats, err := r.GetGroupYearlyStats(ctx, year)
-	if err == nil && len(groupStats) > 0 {
-		stats.GroupTotal = len(groupStats)
-		for i, user := range groupStats {
-			if user.Username == stats.Username {
-				stats.GroupRank = repo.YearlyRanking{
-					Rank: i + 1,
-					TotalUsers: len(groupStats),
-					Percentage: float64(len(groupStats) - i - 1) / float64(len(groupStats)) * 100.0,
-				}
-				break
-			}
-		}
+	if yearlyCount == 0 {
+		msg.Text = formatters.FormatNoWrapped(year)
+		_, err = m.SendText(msg)
+		return err
 	}
 
-	stats.MaxStreak, err = r.GetMaxPoopStreak(ctx, userID)
-	if err != nil {
-		log.Printf("Failed to get streak: %v", err)
+	stats := wrapped.PersonalWrappedStats{
+		UserID:     userID,
+		Username:   update.Message.From.UserName,
+		Year:       year,
+		TotalPoops: yearlyCount,
 	}
 
-	stats.DayWithMostPoops, stats.MostPoopsCount, err = r.GetDayWithMostPoops(ctx, userID)
+	stats.GroupRank, err = r.GetYearlyRanking(ctx, chatID, userID, year)
 	if err != nil {
-		log.Printf("Failed to get day with most poops: %v", err)
+		slog.ErrorContext(ctx, "Failed to get yearly ranking", "error", err)
 	}
+	stats.GroupTotal = stats.GroupRank.TotalUsers
 
-	stats.DaysWithoutPoop, err = r.GetDaysWithoutPoop(ctx, userID)
+	stats.MaxStreak, err = r.GetYearlyLongestStreak(ctx, chatID, userID, year)
 	if err != nil {
-		log.Printf("Failed to get days without poop: %v", err)
+		slog.ErrorContext(ctx, "Failed to get streak", "error", err)
 	}
 
-	tempDir := filepath.Join("main", "wrapped", "temp")
-	os.MkdirAll(tempDir, 0755)
-
-	statsFile := filepath.Join(tempDir, fmt.Sprintf("user_%d_stats.json", userID))
-	statsJSON, err := json.MarshalIndent(stats, "", "  ")
+	stats.DayWithMostPoops, stats.MostPoopsCount, err = r.GetYearlyDayWithMostPoops(ctx, chatID, userID, year)
 	if err != nil {
-		return fmt.Errorf("failed to marshal stats: %w", err)
+		slog.ErrorContext(ctx, "Failed to get day with most poops", "error", err)
 	}
 
-	err = os.WriteFile(statsFile, statsJSON, 0644)
+	stats.DaysWithoutPoop, err = r.GetYearlyDaysWithoutPoop(ctx, chatID, userID, year, today)
 	if err != nil {
-		return fmt.Errorf("failed to write stats file: %w", err)
+		slog.ErrorContext(ctx, "Failed to get days without poop", "error", err)
 	}
 
-	pythonScript := filepath.Join("main", "wrapped", "generate_personal_wrapped.py")
-	cmd := exec.Command("python3", pythonScript, statsFile)
-	cmd.Dir = "."
-	output, err := cmd.CombinedOutput()
+	slides, err := wrapped.RenderPersonalWrapped(stats)
 	if err != nil {
-		log.Printf("Python script error: %v, output: %s", err, string(output))
 		return fmt.Errorf("failed to generate slides: %w", err)
 	}
 
-	imagesFile := filepath.Join(tempDir, fmt.Sprintf("user_%d_images.json", userID))
-	imagesJSON, err := os.ReadFile(imagesFile)
+	photos := make([]messenger.Photo, 0, len(slides))
+	for _, slide := range slides {
+		photos = append(photos, messenger.Photo{Name: slide.Name, Data: slide.PNG})
+	}
+	if err := m.SendAlbum(update.Message.Chat.ID, photos); err != nil {
+		return fmt.Errorf("failed to send slides: %w", err)
+	}
+
+	return nil
+}
+
+// HandleGroupWrapped handles the /group_wrapped [year] command
+func HandleGroupWrapped(ctx context.Context, m messenger.Messenger, r repo.Repository, cfg *config.Config, update tg_bot.Update, chatID int64, userID int64, msg tg_bot.MessageConfig) error {
+	today, err := groupToday(ctx, r, chatID)
 	if err != nil {
-		return fmt.Errorf("failed to read images file: %w", err)
+		msg.Text = "Sorry, I couldn't retrieve the group's year\\. Please try again later\\!"
+		_, sendErr := m.SendText(msg)
+		if sendErr != nil {
+			return fmt.Errorf("failed to send error message: %w", sendErr)
+		}
+		return err
 	}
 
-	var imagePaths []string
-	err = json.Unmarshal(imagesJSON, &imagePaths)
+	year, err := wrappedYear(update.Message.CommandArguments(), today)
 	if err != nil {
-		return fmt.Errorf("failed to unmarshal image paths: %w", err)
+		msg.Text = formatters.FormatInvalidWrappedYear(update.Message.CommandArguments())
+		_, sendErr := m.SendText(msg)
+		return sendErr
 	}
 
-	for i, imagePath := range imagePaths {
-		photo := tg_bot.NewPhoto(update.Message.Chat.ID, tg_bot.FilePath(imagePath))
-		_, err := bot.Send(photo)
-		if err != nil {
-			log.Printf("Failed to send slide %d: %v", i+1, err)
-			continue
-		}
-		
-		if i < len(imagePaths)-1 {
-			time.Sleep(500 * time.Millisecond)
+	leaderboard, err := r.GetGroupYearlyStats(ctx, chatID, year)
+	if err != nil {
+		msg.Text = "Sorry, I couldn't retrieve the group's year\\. Please try again later\\!"
+		_, sendErr := m.SendText(msg)
+		if sendErr != nil {
+			return fmt.Errorf("failed to send error message: %w", sendErr)
 		}
+		return err
 	}
 
-	defer func() {
-		os.Remove(statsFile)
-		os.Remove(imagesFile)
-		for _, imgPath := range imagePaths {
-			os.Remove(imgPath)
-		}
-	}()
+	awards, err := r.GetGroupAwards(ctx, chatID, year)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to get group awards", "error", err)
+	}
 
-	return nil
-}
\ No newline at end of file
+	msg.Text = formatters.FormatGroupWrapped(year, leaderboard, awards)
+	_, err = m.SendText(msg)
+	return err
+}
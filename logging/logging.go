@@ -0,0 +1,93 @@
+// Package logging sets up the bot's structured logs: JSON records carrying the chat, user, command and update
+// they're about, with the Telegram token scrubbed from everything written.
+package logging
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// redacted replaces the Telegram token wherever it shows up, e.g. in the URL of a failed Bot API request
+const redacted = "[REDACTED]"
+
+// Attribute keys of what a record is about
+const (
+	ChatIDKey   = "chat_id"
+	UserIDKey   = "user_id"
+	CommandKey  = "command"
+	UpdateIDKey = "update_id"
+)
+
+type attrsKey struct{}
+
+// With returns a context whose log records carry attrs, along with the ones ctx already carries
+func With(ctx context.Context, attrs ...slog.Attr) context.Context {
+	existing, _ := ctx.Value(attrsKey{}).([]slog.Attr)
+	combined := make([]slog.Attr, 0, len(existing)+len(attrs))
+	combined = append(combined, existing...)
+	combined = append(combined, attrs...)
+	return context.WithValue(ctx, attrsKey{}, combined)
+}
+
+// contextHandler adds the attributes stored in the context by With to every record
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if attrs, ok := ctx.Value(attrsKey{}).([]slog.Attr); ok {
+		record.AddAttrs(attrs...)
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// redactingWriter scrubs a secret from everything written through it. The JSON handler writes a whole record
+// per call, so the secret is never split across writes.
+type redactingWriter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	secret []byte
+}
+
+func (w *redactingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, err := w.w.Write(bytes.ReplaceAll(p, w.secret, []byte(redacted))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// NewLogger writes JSON records at level and above to w, with token redacted
+func NewLogger(w io.Writer, level slog.Level, token string) *slog.Logger {
+	if token != "" {
+		w = &redactingWriter{w: w, secret: []byte(token)}
+	}
+	return slog.New(contextHandler{slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level})})
+}
+
+// BotLogger passes the Telegram library's own messages, mostly failed polls, on to a logger as warnings
+type BotLogger struct {
+	Logger *slog.Logger
+}
+
+func (l BotLogger) Println(v ...interface{}) {
+	l.Logger.Warn(strings.TrimSuffix(fmt.Sprintln(v...), "\n"), "source", "telegram-bot-api")
+}
+
+func (l BotLogger) Printf(format string, v ...interface{}) {
+	l.Logger.Warn(fmt.Sprintf(format, v...), "source", "telegram-bot-api")
+}
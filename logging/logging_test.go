@@ -0,0 +1,89 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+const testToken = "123456:ABC-secret_token"
+
+// records decodes the JSON records written to out
+func records(t *testing.T, out *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("record %q isn't JSON: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestNewLogger_RedactsToken(t *testing.T) {
+	var out bytes.Buffer
+	logger := NewLogger(&out, slog.LevelInfo, testToken)
+
+	err := errors.New(`Post "https://api.telegram.org/bot` + testToken + `/getUpdates": dial tcp: i/o timeout`)
+	logger.Error("Failed to get updates", "error", err)
+	logger.Info("token is "+testToken, "url", "https://api.telegram.org/bot"+testToken+"/getMe")
+	BotLogger{Logger: logger}.Println(err)
+
+	if strings.Contains(out.String(), testToken) || strings.Contains(out.String(), "secret_token") {
+		t.Fatalf("output contains the token:\n%s", out.String())
+	}
+	if got := strings.Count(out.String(), redacted); got != 4 {
+		t.Errorf("output has %d redactions, want 4:\n%s", got, out.String())
+	}
+	if got := len(records(t, &out)); got != 3 {
+		t.Errorf("wrote %d records, want 3", got)
+	}
+}
+
+func TestNewLogger_Level(t *testing.T) {
+	var out bytes.Buffer
+	logger := NewLogger(&out, slog.LevelWarn, testToken)
+
+	logger.Debug("debug")
+	logger.Info("info")
+	logger.Warn("warn")
+	logger.Error("error")
+
+	got := records(t, &out)
+	if len(got) != 2 || got[0]["msg"] != "warn" || got[1]["msg"] != "error" {
+		t.Errorf("records = %v, want only warn and error", got)
+	}
+}
+
+func TestWith(t *testing.T) {
+	var out bytes.Buffer
+	logger := NewLogger(&out, slog.LevelInfo, testToken)
+
+	ctx := With(context.Background(), slog.Int(UpdateIDKey, 7), slog.Int64(ChatIDKey, -100123))
+	ctx = With(ctx, slog.Int64(UserIDKey, 1001), slog.String(CommandKey, "leaderboard"))
+	logger.With("job", "weekly_recap").InfoContext(ctx, "handled")
+	logger.Info("no context")
+
+	got := records(t, &out)
+	if len(got) != 2 {
+		t.Fatalf("records = %v, want 2", got)
+	}
+	want := map[string]any{UpdateIDKey: 7.0, ChatIDKey: -100123.0, UserIDKey: 1001.0, CommandKey: "leaderboard", "job": "weekly_recap"}
+	for key, value := range want {
+		if got[0][key] != value {
+			t.Errorf("record[%s] = %v, want %v", key, got[0][key], value)
+		}
+	}
+	if _, ok := got[1][ChatIDKey]; ok {
+		t.Errorf("record without context = %v, want no chat", got[1])
+	}
+}
@@ -1,256 +1,449 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
+	_ "time/tzdata"
 
 	_ "modernc.org/sqlite"
 
 	"src/config"
 	"src/formatters"
 	"src/handlers"
+	"src/logging"
+	"src/messenger"
+	"src/metrics"
+	"src/reactions"
 	repo "src/repository"
+	"src/scheduler"
+	"src/utils"
 
 	tg_bot "github.com/go-telegram-bot-api/telegram-bot-api/v5"
-	"github.com/robfig/cron/v3"
 )
 
-type AddReactionRequest struct {
-	ChatID    int64          `json:"chat_id"`
-	MessageID int64          `json:"message_id"`
-	Reaction  []ReactionType `json:"reaction"`
-	IsBig     bool           `json:"is_big"`
+func sendMessage(ctx context.Context, m messenger.Messenger, msg tg_bot.MessageConfig) {
+	_, err := m.SendText(msg)
+	if err != nil {
+		slog.ErrorContext(ctx, "Bot failed to send message", "error", err)
+	}
 }
 
-type ReactionType struct {
-	Type          string `json:"type"`
-	Emoji         string `json:"emoji,omitempty"`
-	CustomEmojiID string `json:"custom_emoji_id,omitempty"`
+func isPoopMessage(message *tg_bot.Message) bool {
+	stickerEmoji := ""
+	if message.Sticker != nil {
+		stickerEmoji = message.Sticker.Emoji
+	}
+	return utils.IsPoop(message.Text, stickerEmoji)
 }
 
-func sendMessage(bot *tg_bot.BotAPI, msg tg_bot.MessageConfig) {
-	_, err := bot.Send(msg)
+func handleNewPoop(ctx context.Context, r repo.Repository, chatID int64, userId int64, username string, msgId int64, timestamp int64) error {
+	t := time.Unix(timestamp, 0).UTC()
+	sqliteTimestamp := t.Format("2006-01-02 15:04:05")
+
+	err := r.LogPoop(ctx, chatID, userId, username, msgId, sqliteTimestamp, t.Unix())
+	if errors.Is(err, repo.ErrPoopAlreadyLogged) {
+		slog.InfoContext(ctx, "Message was already logged", "message_id", msgId)
+		return err
+	}
 	if err != nil {
-		log.Printf("Bot failed to send message: %v", err)
+		slog.ErrorContext(ctx, "Failed to log poop", "error", err)
+		return err
 	}
+	metrics.PoopsLogged.Inc()
+	slog.InfoContext(ctx, "Poop logged", "message_id", msgId)
+	return nil
 }
 
-func handleNewPoop(ctx context.Context, r repo.Repository, userId int64, username string, msgId int64, timestamp int64) {
-	t := time.Unix(timestamp, 0).UTC()
-	sqliteTimestamp := t.Format("2006-01-02 15:04:05")
+// checkWellness replies to a poop that takes the user's local day over the wellness thresholds.
+// Each alert level is sent at most once per day, which is recorded before sending so restarts don't repeat it.
+func checkWellness(ctx context.Context, m messenger.Messenger, r repo.Repository, cfg *config.Config, chatID int64, userID int64, username string, msgID int, at time.Time) {
+	if cfg.WellnessThreshold <= 0 {
+		return
+	}
 
-	err := r.LogPoop(ctx, userId, username, msgId, sqliteTimestamp, t.Unix())
+	day, count, err := r.GetLocalDayPoopCount(ctx, chatID, userID, at)
 	if err != nil {
-		log.Printf("Failed to log poop: %v", err)
+		slog.ErrorContext(ctx, "Failed to count today's poops for the wellness alert", "error", err)
+		return
+	}
+
+	level, text := 0, ""
+	switch {
+	case cfg.WellnessEscalationThreshold > 0 && count > cfg.WellnessEscalationThreshold:
+		level, text = 2, formatters.FormatWellnessEscalation(userID, username, count)
+	case count > cfg.WellnessThreshold:
+		level, text = 1, formatters.FormatWellnessAlert(userID, username, count)
+	default:
 		return
 	}
-	log.Println("Poop logged successfully!")
-}
 
-func sendMonthlyPoodium(ctx context.Context, bot *tg_bot.BotAPI, r repo.Repository, chatID int64) {
-	topPoopers, err := r.GetPastMonthPoodium(ctx)
+	claimed, err := r.ClaimWellnessAlert(ctx, chatID, userID, day, level, at.Unix())
 	if err != nil {
-		log.Printf("Failed to get top poopers for monthly poodium: %v", err)
+		slog.ErrorContext(ctx, "Failed to record wellness alert", "level", level, "error", err)
 		return
 	}
+	if !claimed {
+		return
+	}
+
+	msg := tg_bot.NewMessage(chatID, text)
+	msg.ReplyToMessageID = msgID
+	sendMessage(ctx, m, msg)
+}
 
-	now := time.Now()
-	pastMonth := now.AddDate(0, -1, 0)
-	_, month, _ := pastMonth.Date()
-	monthStr := fmt.Sprintf("%02d", month)
-	monthName := formatters.GetMonthName(monthStr)
+// sendMonthlyPoodium sends and pins the poodium of a completed month. Failing to pin isn't an error, the poodium was posted.
+func sendMonthlyPoodium(ctx context.Context, m messenger.Messenger, r repo.Repository, chatID int64, pastMonth repo.Period) error {
+	topPoopers, err := r.GetLeaderboard(ctx, chatID, pastMonth, repo.MostPoopsFirst, 3)
+	if err != nil {
+		return fmt.Errorf("failed to get top poopers for monthly poodium: %w", err)
+	}
 
-	messageText := formatters.FormatPoodiumTitle(monthName) + formatters.BuildPoodiumMessage(topPoopers)
+	messageText := formatters.FormatPoodiumTitle(formatters.FormatPeriod(pastMonth)) + formatters.BuildPoodiumMessage(topPoopers)
 	msg := tg_bot.NewMessage(chatID, messageText)
-	sentMsg, err := bot.Send(msg)
+	messageID, err := m.SendText(msg)
 	if err != nil {
-		log.Printf("Failed to send monthly poodium message: %v", err)
-		return
+		return fmt.Errorf("failed to send monthly poodium message: %w", err)
 	}
 
-	_, err = bot.Send(tg_bot.PinChatMessageConfig{
-		ChatID:              chatID,
-		MessageID:           sentMsg.MessageID,
-		DisableNotification: true,
-	})
+	err = m.Pin(chatID, messageID)
 	if err != nil {
-		log.Printf("Failed to pin monthly poodium message: %v", err)
+		slog.ErrorContext(ctx, "Failed to pin monthly poodium message", "error", err)
 	}
+	return nil
 }
 
-func sendYearlyPoodium(ctx context.Context, bot *tg_bot.BotAPI, r repo.Repository, chatID int64) {
-	topPoopers, err := r.GetYearlyPoodium(ctx)
+// sendYearlyPoodium sends the poodium of a completed year
+func sendYearlyPoodium(ctx context.Context, m messenger.Messenger, r repo.Repository, chatID int64, year int) error {
+	topPoopers, err := r.GetLeaderboard(ctx, chatID, repo.YearPeriod(year), repo.MostPoopsFirst, 3)
 	if err != nil {
-		log.Printf("Failed to get top poopers for yearly poodium: %v", err)
-		return
+		return fmt.Errorf("failed to get top poopers for yearly poodium: %w", err)
 	}
 
-	year, _, _ := time.Now().Date()
 	messageText := formatters.FormatYearlyPoodiumTitle(year) + formatters.BuildPoodiumMessage(topPoopers)
-	msg := tg_bot.NewMessage(chatID, messageText)
-	sendMessage(bot, msg)
+	if _, err := m.SendText(tg_bot.NewMessage(chatID, messageText)); err != nil {
+		return fmt.Errorf("failed to send yearly poodium message: %w", err)
+	}
+	return nil
 }
 
-func handleReactions(cfg *config.Config, chatID int64, messageID int64, sticker *tg_bot.Sticker) {
-	var reactEmoji = "💩"
-
-	if sticker != nil && sticker.Emoji == "💩" {
-		if sticker.SetName == "Poopers2" {
-			switch sticker.FileUniqueID {
-			case cfg.StickerIDs["struggle"]:
-				reactEmoji = "😢"
-			case cfg.StickerIDs["esnoopi"]:
-				reactEmoji = "🎉"
-			case cfg.StickerIDs["jurassic"]:
-				reactEmoji = "🏆"
-			case cfg.StickerIDs["girly"]:
-				reactEmoji = "💅"
-			case cfg.StickerIDs["scared"]:
-				reactEmoji = "🫡"
-			case cfg.StickerIDs["sus"]:
-				reactEmoji = "🤨"
-			}
-		}
+// sendGroupWrapped sends the group's year in review and awards ceremony for a completed year
+func sendGroupWrapped(ctx context.Context, m messenger.Messenger, r repo.Repository, chatID int64, year int) error {
+	leaderboard, err := r.GetGroupYearlyStats(ctx, chatID, year)
+	if err != nil {
+		return fmt.Errorf("failed to get group yearly stats for group wrapped: %w", err)
+	}
+	if len(leaderboard) == 0 {
+		return nil
 	}
 
-	err := addReaction(cfg, chatID, messageID, reactEmoji)
+	awards, err := r.GetGroupAwards(ctx, chatID, year)
 	if err != nil {
-		log.Printf("Failed to add reaction: %v", err)
-	} else {
-		log.Println("Reaction added successfully.")
+		slog.ErrorContext(ctx, "Failed to get group awards for group wrapped", "error", err)
 	}
-}
 
-func addReaction(cfg *config.Config, chatID int64, messageID int64, emoji string) error {
-	url := fmt.Sprintf("%s%s/setMessageReaction", cfg.APIBaseURL, cfg.TelegramToken)
-
-	reactionRequest := AddReactionRequest{
-		ChatID:    chatID,
-		MessageID: messageID,
-		Reaction:  []ReactionType{{Type: "emoji", Emoji: emoji}},
-		IsBig:     false,
+	if _, err := m.SendText(tg_bot.NewMessage(chatID, formatters.FormatGroupWrapped(year, leaderboard, awards))); err != nil {
+		return fmt.Errorf("failed to send group wrapped message: %w", err)
 	}
+	return nil
+}
 
-	jsonBody, err := json.Marshal(reactionRequest)
+// sendWeeklyRecap sends the recap of a completed week, groups that didn't log that week or the week before get nothing
+func sendWeeklyRecap(ctx context.Context, m messenger.Messenger, r repo.Repository, chatID int64, week repo.Period) error {
+	changes, err := r.GetPeriodChanges(ctx, chatID, week, week.Previous())
 	if err != nil {
-		return fmt.Errorf("failed to marshal reaction request: %w", err)
+		return fmt.Errorf("failed to get week over week changes for weekly recap: %w", err)
+	}
+	if len(changes) == 0 {
+		return nil
 	}
 
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonBody))
+	podium, err := r.GetLeaderboard(ctx, chatID, week, repo.MostPoopsFirst, 3)
 	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
+		return fmt.Errorf("failed to get top poopers for weekly recap: %w", err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to add reaction, status code: %d", resp.StatusCode)
+	if _, err := m.SendText(tg_bot.NewMessage(chatID, formatters.FormatWeeklyRecap(week, podium, changes))); err != nil {
+		return fmt.Errorf("failed to send weekly recap message: %w", err)
 	}
-
 	return nil
 }
 
-func main() {
-	fmt.Print("Starting bot...\n")
+// inactivityLookback limits check-ins to members who logged recently, so people who left long ago aren't pinged
+const inactivityLookback = 30 * 24 * time.Hour
 
-	cfg, err := config.LoadConfig()
+// checkInactiveMembers asks members who haven't logged in cfg.InactivityThreshold whether everything is ok.
+// Each member is asked once per silence, they're only asked again after logging another poop.
+func checkInactiveMembers(ctx context.Context, m messenger.Messenger, r repo.Repository, cfg *config.Config, now time.Time) {
+	if cfg.InactivityThreshold <= 0 {
+		return
+	}
+
+	groups, err := r.GetGroups(ctx)
 	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
+		slog.ErrorContext(ctx, "Failed to get registered groups", "error", err)
+		return
 	}
 
-	bot, err := tg_bot.NewBotAPI(cfg.TelegramToken)
+	inactiveSince := now.Add(-cfg.InactivityThreshold)
+	activeSince := inactiveSince.Add(-inactivityLookback)
+	for _, group := range groups {
+		groupCtx := logging.With(ctx, slog.Int64(logging.ChatIDKey, group.ChatID))
+		users, err := r.GetInactiveUsers(groupCtx, group.ChatID, inactiveSince.Unix(), activeSince.Unix())
+		if err != nil {
+			slog.ErrorContext(groupCtx, "Failed to get inactive users", "error", err)
+			continue
+		}
+
+		for _, user := range users {
+			ctx := logging.With(groupCtx, slog.Int64(logging.UserIDKey, user.UserID))
+			silence := now.Sub(time.Unix(user.LastPoopUnix, 0))
+			msg := tg_bot.NewMessage(group.ChatID, formatters.FormatInactivityCheckIn(user.UserID, user.Username, silence))
+
+			sent := false
+			if cfg.InactivityCheckInDM {
+				// Users who never started a private chat with the bot can't be messaged, so fall back to the group
+				dm := msg
+				dm.ChatID = user.UserID
+				if _, err := m.SendText(dm); err != nil {
+					slog.WarnContext(ctx, "Failed to send check-in privately, mentioning them in the group", "error", err)
+				} else {
+					sent = true
+				}
+			}
+			if !sent {
+				if _, err := m.SendText(msg); err != nil {
+					slog.ErrorContext(ctx, "Failed to send check-in", "error", err)
+					continue
+				}
+			}
+
+			err := r.RecordCheckIn(ctx, group.ChatID, user.UserID, user.LastPoopUnix, now.Unix())
+			if err != nil {
+				slog.ErrorContext(ctx, "Failed to record check-in", "error", err)
+			}
+		}
+	}
+}
+
+func registerGroup(ctx context.Context, m messenger.Messenger, r repo.Repository, cfg *config.Config, chat *tg_bot.Chat, msg tg_bot.MessageConfig) {
+	err := r.RegisterGroup(ctx, chat.ID, chat.Title, cfg.DefaultTimezone)
 	if err != nil {
-		log.Fatalf("Failed to create new bot instance: %v", err)
+		slog.ErrorContext(ctx, "Failed to register group", "error", err)
+		msg.Text = "Sorry, I couldn't register this group\\. Please try again later\\!"
+		sendMessage(ctx, m, msg)
+		return
 	}
 
-	bot.Debug = true
+	slog.InfoContext(ctx, "Registered group", "title", chat.Title)
+	msg.Text = "This group is now registered\\. Start logging your 💩\\!"
+	sendMessage(ctx, m, msg)
+}
 
-	updateConfig := tg_bot.NewUpdate(0)
-	updateConfig.Timeout = 30
-	updateConfig.AllowedUpdates = []string{"message", "message_reaction"}
-	updates := bot.GetUpdatesChan(updateConfig)
+// recordUser keeps the names a user goes by up to date, so statistics show their current name
+func recordUser(ctx context.Context, r repo.Repository, user *tg_bot.User, seenAt int) {
+	err := r.UpsertUser(ctx, repo.User{
+		UserID:       user.ID,
+		Username:     user.UserName,
+		FirstName:    user.FirstName,
+		LastName:     user.LastName,
+		LastSeenUnix: int64(seenAt),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to record user", "recorded_user_id", user.ID, "error", err)
+	}
+}
 
-	db, err := repo.OpenDBConnection(cfg)
+// userLocation returns the timezone a user's poops are bucketed in, their override or else the group's
+func userLocation(ctx context.Context, r repo.Repository, chatID int64, userID int64) *time.Location {
+	timezone, err := r.GetUserTimezone(ctx, userID)
+	if err == nil && timezone == "" {
+		timezone, err = r.GetGroupTimezone(ctx, chatID)
+	}
 	if err != nil {
-		log.Fatalf("Failed to open database connection: %v", err)
+		slog.ErrorContext(ctx, "Failed to get user timezone, using UTC", "error", err)
+		return time.UTC
 	}
-	defer db.Close()
 
-	db.SetMaxOpenConns(25)
-	db.SetMaxIdleConns(5)
-	db.SetConnMaxLifetime(5 * time.Minute)
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		slog.WarnContext(ctx, "Invalid user timezone, using UTC", "timezone", timezone, "error", err)
+		return time.UTC
+	}
+	return loc
+}
 
-	repository := repo.NewRepository(db)
+// poopEvent gathers what reaction rules match on for a poop logged in chatID
+func poopEvent(ctx context.Context, r repo.Repository, chatID int64, userID int64, sticker *tg_bot.Sticker, at time.Time) reactions.Event {
+	event := reactions.Event{LocalTime: at.In(userLocation(ctx, r, chatID, userID))}
+	var err error
+	if sticker != nil {
+		event.StickerID = sticker.FileUniqueID
+		event.StickerSet = sticker.SetName
+		event.StickerEmoji, err = r.GetStickerEmoji(ctx, sticker.FileUniqueID)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to get sticker reaction", "error", err)
+		}
+	}
 
-	ctx := context.Background()
+	_, event.DailyCount, err = r.GetLocalDayPoopCount(ctx, chatID, userID, at)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to count today's poops for reactions", "error", err)
+	}
+	event.TotalCount, err = r.GetGlobalPoopCount(ctx, chatID, userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to count poops for reactions", "error", err)
+	}
+	return event
+}
 
-	// Schedule the monthly poodium message
-	monthlyCron := cron.New()
-	_, err = monthlyCron.AddFunc("0 0 1 * *", func() {
-		sendMonthlyPoodium(ctx, bot, repository, cfg.GroupChatID)
-	})
+func handleReactions(ctx context.Context, m messenger.Messenger, engine *reactions.Engine, chatID int64, messageID int, event reactions.Event) {
+	emoji := engine.Pick(event)
+	err := m.React(chatID, messageID, emoji)
 	if err != nil {
-		log.Fatalf("Failed to schedule monthly poodium message: %v", err)
+		slog.ErrorContext(ctx, "Failed to add reaction", "emoji", emoji, "error", err)
+	} else {
+		slog.DebugContext(ctx, "Reaction added", "emoji", emoji)
 	}
-	monthlyCron.Start()
+}
 
-	// Schedule the yearly poodium message
-	yearlyCron := cron.New()
-	_, err = yearlyCron.AddFunc("0 0 1 1 *", func() {
-		sendYearlyPoodium(ctx, bot, repository, cfg.GroupChatID)
-	})
+// updateContext tags every log of an update with its ID and the chat, user and command it's about
+func updateContext(ctx context.Context, update tg_bot.Update) context.Context {
+	attrs := []slog.Attr{slog.Int(logging.UpdateIDKey, update.UpdateID)}
+	if chat := update.FromChat(); chat != nil {
+		attrs = append(attrs, slog.Int64(logging.ChatIDKey, chat.ID))
+	}
+	if user := update.SentFrom(); user != nil {
+		attrs = append(attrs, slog.Int64(logging.UserIDKey, user.ID))
+	}
+	if update.Message != nil && update.Message.IsCommand() {
+		attrs = append(attrs, slog.String(logging.CommandKey, update.Message.Command()))
+	}
+	return logging.With(ctx, attrs...)
+}
+
+// handleUpdate logs poops and answers commands, depending on which chat the update comes from
+func handleUpdate(ctx context.Context, m messenger.Messenger, r repo.Repository, cfg *config.Config, engine *reactions.Engine, jobs *scheduler.Scheduler, update tg_bot.Update) {
+	metrics.UpdatesProcessed.Inc()
+	ctx = updateContext(ctx, update)
+
+	if update.CallbackQuery != nil {
+		handlers.HandleCallbackQuery(ctx, m, r, cfg, update.CallbackQuery)
+		return
+	}
+
+	if update.Message == nil {
+		return
+	}
+
+	recordUser(ctx, r, update.Message.From, update.Message.Date)
+
+	msg := tg_bot.NewMessage(update.Message.Chat.ID, update.Message.Text)
+	userID := update.Message.From.ID
+	username := update.Message.From.UserName
+	messageID := update.Message.MessageID
+	chatID := update.Message.Chat.ID
+
+	isGroup, err := r.IsRegisteredGroup(ctx, chatID)
 	if err != nil {
-		log.Fatalf("Failed to schedule yearly poodium message: %v", err)
+		slog.ErrorContext(ctx, "Failed to check whether the chat is registered", "error", err)
+		return
 	}
-	yearlyCron.Start()
 
-	for update := range updates {
-		if update.Message == nil {
-			continue
+	switch {
+	case isGroup:
+		if isPoopMessage(update.Message) {
+			slog.DebugContext(ctx, "New poop detected")
+			postedAt := time.Unix(int64(update.Message.Date), 0)
+			if err := handleNewPoop(ctx, r, chatID, userID, username, int64(messageID), int64(update.Message.Date)); err == nil {
+				checkWellness(ctx, m, r, cfg, chatID, userID, username, messageID, postedAt)
+			}
+			event := poopEvent(ctx, r, chatID, userID, update.Message.Sticker, postedAt)
+			handleReactions(ctx, m, engine, chatID, messageID, event)
 		}
 
-		msg := tg_bot.NewMessage(update.Message.Chat.ID, update.Message.Text)
-		msg.ParseMode = tg_bot.ModeMarkdownV2
-		userID := update.Message.From.ID
-		username := update.Message.From.UserName
-		messageID := update.Message.MessageID
-		chatID := update.Message.Chat.ID
-
-		switch chatID {
-		case cfg.GroupChatID:
-			if update.Message.Text == "💩" || (update.Message.Sticker != nil && update.Message.Sticker.Emoji == "💩") {
-				log.Println("New poop detected!")
-				handleNewPoop(ctx, repository, userID, username, int64(messageID), int64(update.Message.Date))
-				handleReactions(cfg, chatID, int64(messageID), update.Message.Sticker)
+		if update.Message.Command() != "" {
+			handlers.HandleCommand(ctx, m, r, cfg, update, chatID, userID, msg)
+		}
+	case chatID == cfg.MyChatID:
+		// Forwarded poops are backfilled into the main group
+		if isPoopMessage(update.Message) {
+			if update.Message.ForwardFrom != nil {
+				recordUser(ctx, r, update.Message.ForwardFrom, update.Message.ForwardDate)
 			}
-
-			if update.Message.Command() != "" {
-				if update.Message.Command() != "poop_wrapped" {
-					handlers.HandleCommand(ctx, bot, repository, update, userID, msg)
-				}
+			poop, err := handlers.HandleForwardedPoop(ctx, m, r, cfg, update.Message)
+			if err != nil {
+				slog.ErrorContext(ctx, "Failed to backfill forwarded poop", "error", err)
 			}
-		case cfg.MyChatID:
-			if update.Message.Text == "💩" || (update.Message.Sticker != nil && update.Message.Sticker.Emoji == "💩") {
-				userID = update.Message.ForwardFrom.ID
-				username = update.Message.ForwardFrom.UserName
-				messageID = -update.Message.MessageID
-				handleNewPoop(ctx, repository, userID, username, int64(messageID), int64(update.Message.ForwardDate))
-				handleReactions(cfg, chatID, int64(update.Message.MessageID), update.Message.Sticker)
+			if poop != nil {
+				metrics.PoopsLogged.Inc()
+				event := poopEvent(ctx, r, poop.ChatID, poop.UserID, update.Message.Sticker, time.Unix(poop.SentAtUnix, 0))
+				handleReactions(ctx, m, engine, chatID, messageID, event)
 			}
+		}
 
-			if update.Message.Command() != "" {
-				handlers.HandleCommand(ctx, bot, repository, update, userID, msg)
-			}
-		default:
-			if update.Message.Command() != "" {
-				msg.Text = "Sorry, I only respond to commands in the group chat\\."
-				sendMessage(bot, msg)
-			}
+		if update.Message.Command() == "jobs" {
+			handleJobsCommand(ctx, m, jobs, msg, update.Message.CommandArguments())
+		} else if update.Message.Command() != "" {
+			handlers.HandleCommand(ctx, m, r, cfg, update, cfg.GroupChatID, userID, msg)
+		}
+	default:
+		if update.Message.Command() == "register_group" && userID == cfg.MyChatID && !update.Message.Chat.IsPrivate() {
+			registerGroup(ctx, m, r, cfg, update.Message.Chat, msg)
+		} else if update.Message.Command() != "" {
+			msg.Text = "Sorry, I only respond to commands in registered group chats\\."
+			sendMessage(ctx, m, msg)
+		}
+	}
+}
+
+// newBot connects to the Bot API at cfg.APIBaseURL
+func newBot(cfg *config.Config) (*tg_bot.BotAPI, error) {
+	client := forwardOriginClient{client: &http.Client{}}
+	return tg_bot.NewBotAPIWithClient(cfg.TelegramToken, cfg.APIBaseURL+"%s/%s", client)
+}
+
+// fatal logs err and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+func main() {
+	slog.SetDefault(logging.NewLogger(os.Stderr, slog.LevelInfo, ""))
+	slog.Info("Starting bot...")
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		fatal("Failed to load configuration", err)
+	}
+
+	// The standard log package and the Telegram library log through the same handler, so the token is redacted everywhere
+	logger := logging.NewLogger(os.Stderr, cfg.LogLevel, cfg.TelegramToken)
+	slog.SetDefault(logger)
+	if err := tg_bot.SetLogger(logging.BotLogger{Logger: logger}); err != nil {
+		fatal("Failed to set the Telegram library's logger", err)
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		if err := runImport(cfg, os.Args[2:]); err != nil {
+			fatal("Import failed", err)
 		}
+		return
 	}
 
+	// SIGTERM is how the bot is stopped on deploys, it gets to finish what it's doing before exiting
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, cfg); err != nil {
+		stop()
+		fatal("Bot failed", err)
+	}
 }
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"src/config"
+	"src/logging"
+	"src/messenger"
+	"src/reactions"
+	repo "src/repository"
+	"src/scheduler"
+
+	tg_bot "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const testChatID = int64(-100123)
+
+func setupTestRepository(t *testing.T) repo.Repository {
+	t.Helper()
+	db, err := repo.OpenDBConnection(&config.Config{DBPath: filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	r := repo.NewRepository(db)
+	if err := r.RegisterGroup(context.Background(), testChatID, "Poopers", "UTC"); err != nil {
+		t.Fatalf("Failed to register test group: %v", err)
+	}
+	return r
+}
+
+func TestSendMonthlyPoodium_PinsTheMessage(t *testing.T) {
+	r := setupTestRepository(t)
+	m := messenger.NewRecorder()
+
+	if err := sendMonthlyPoodium(context.Background(), m, r, testChatID, repo.MonthPeriod(2025, time.March)); err != nil {
+		t.Fatalf("sendMonthlyPoodium() error = %v", err)
+	}
+
+	sent := m.CallsTo("SendText")
+	pins := m.CallsTo("Pin")
+	if len(sent) != 1 || len(pins) != 1 {
+		t.Fatalf("sendMonthlyPoodium() made %+v, want a message and a pin", m.Calls())
+	}
+	// The recorder numbers messages from 1
+	if pins[0].ChatID != testChatID || pins[0].MessageID != 1 {
+		t.Errorf("sendMonthlyPoodium() pinned %+v, want the poodium message", pins[0])
+	}
+}
+
+func TestSendMonthlyPoodium_CallsOutTies(t *testing.T) {
+	ctx := context.Background()
+	r := setupTestRepository(t)
+	m := messenger.NewRecorder()
+
+	// bob logged after alice, the tie still isn't broken in alice's favour
+	for i, poop := range []struct {
+		userID   int64
+		username string
+		day      int
+	}{{1001, "alice", 1}, {1002, "bob", 2}, {1003, "charlie", 3}, {1003, "charlie", 4}} {
+		at := time.Date(2025, 3, poop.day, 8, 0, 0, 0, time.UTC)
+		if err := r.LogPoop(ctx, testChatID, poop.userID, poop.username, int64(i+1), at.Format("2006-01-02 15:04:05"), at.Unix()); err != nil {
+			t.Fatalf("Failed to log poop: %v", err)
+		}
+	}
+
+	if err := sendMonthlyPoodium(ctx, m, r, testChatID, repo.MonthPeriod(2025, time.March)); err != nil {
+		t.Fatalf("sendMonthlyPoodium() error = %v", err)
+	}
+
+	sent := m.CallsTo("SendText")
+	if len(sent) != 1 {
+		t.Fatalf("sendMonthlyPoodium() sent %+v, want the poodium", sent)
+	}
+	want := "🥇 charlie \\- 2💩\n🥈 alice \\- 1💩\n🥈 bob \\- 1💩\n\n🤝 alice and bob are tied for 🥈 with 1💩 each\\."
+	if !strings.HasSuffix(sent[0].Text, want) {
+		t.Errorf("poodium = %q, want it to end with %q", sent[0].Text, want)
+	}
+}
+
+// runJob runs one of the bot's scheduled jobs directly
+func runJob(t *testing.T, m messenger.Messenger, r repo.Repository, name string, run scheduler.Run) {
+	t.Helper()
+	for _, job := range scheduledJobs(m, r, &config.Config{}) {
+		if job.Name == name {
+			if err := job.Run(context.Background(), run); err != nil {
+				t.Fatalf("job %s error = %v", name, err)
+			}
+			return
+		}
+	}
+	t.Fatalf("no job called %s", name)
+}
+
+func TestWeeklyRecapJob_MondayMorning(t *testing.T) {
+	r := setupTestRepository(t)
+	m := messenger.NewRecorder()
+	ctx := context.Background()
+
+	at := time.Date(2025, 3, 12, 8, 0, 0, 0, time.UTC)
+	if err := r.LogPoop(ctx, testChatID, 1001, "alice", 1, at.Format("2006-01-02 15:04:05"), at.Unix()); err != nil {
+		t.Fatalf("Failed to log poop: %v", err)
+	}
+
+	// Sunday night and Monday before the recap hour are too early
+	runJob(t, m, r, weeklyRecapJob, scheduler.Run{ScheduledAt: time.Date(2025, 3, 16, 23, 0, 0, 0, time.UTC)})
+	runJob(t, m, r, weeklyRecapJob, scheduler.Run{ScheduledAt: time.Date(2025, 3, 17, 8, 0, 0, 0, time.UTC)})
+	if calls := m.Calls(); len(calls) != 0 {
+		t.Fatalf("weekly recap before Monday morning made %+v, want nothing", calls)
+	}
+
+	runJob(t, m, r, weeklyRecapJob, scheduler.Run{ScheduledAt: time.Date(2025, 3, 17, 9, 0, 0, 0, time.UTC)})
+	sent := m.CallsTo("SendText")
+	if len(sent) != 1 || !strings.Contains(sent[0].Text, "10 March 2025") || !strings.Contains(sent[0].Text, "alice") {
+		t.Errorf("weekly recap on Monday morning sent %+v, want the recap of the week of March 10th", sent)
+	}
+
+	// A caught up run for the same week doesn't post it again
+	m.Reset()
+	runJob(t, m, r, weeklyRecapJob, scheduler.Run{ScheduledAt: time.Date(2025, 3, 17, 9, 0, 0, 0, time.UTC)})
+	if calls := m.Calls(); len(calls) != 0 {
+		t.Errorf("weekly recap caught up for the same week made %+v, want nothing", calls)
+	}
+
+	// But the admin can post it again by hand
+	runJob(t, m, r, weeklyRecapJob, scheduler.Run{ScheduledAt: time.Date(2025, 3, 19, 15, 0, 0, 0, time.UTC), Manual: true})
+	if sent := m.CallsTo("SendText"); len(sent) != 1 || !strings.Contains(sent[0].Text, "10 March 2025") {
+		t.Errorf("manual weekly recap for a posted week sent %+v, want the recap again", sent)
+	}
+}
+
+func TestMonthlyPoodiumJob_ManualRun(t *testing.T) {
+	r := setupTestRepository(t)
+	m := messenger.NewRecorder()
+
+	// Mid-month, a scheduled run does nothing but a manual one posts last month's poodium
+	runJob(t, m, r, monthlyPoodiumJob, scheduler.Run{ScheduledAt: time.Date(2025, 4, 15, 12, 0, 0, 0, time.UTC)})
+	if calls := m.Calls(); len(calls) != 0 {
+		t.Fatalf("monthly poodium mid-month made %+v, want nothing", calls)
+	}
+
+	runJob(t, m, r, monthlyPoodiumJob, scheduler.Run{ScheduledAt: time.Date(2025, 4, 15, 12, 0, 0, 0, time.UTC), Manual: true})
+	sent := m.CallsTo("SendText")
+	if len(sent) != 1 || !strings.Contains(sent[0].Text, "March 2025") {
+		t.Errorf("manual monthly poodium sent %+v, want March's poodium", sent)
+	}
+
+	// The scheduled run on the 1st finds March already posted
+	m.Reset()
+	runJob(t, m, r, monthlyPoodiumJob, scheduler.Run{ScheduledAt: time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)})
+	if calls := m.Calls(); len(calls) != 0 {
+		t.Errorf("monthly poodium after a manual run made %+v, want nothing", calls)
+	}
+}
+
+func TestMonthlyPoodiumJob_RetriesFailedPost(t *testing.T) {
+	r := setupTestRepository(t)
+	m := messenger.NewRecorder()
+	run := scheduler.Run{ScheduledAt: time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)}
+
+	var job scheduler.Job
+	for _, j := range scheduledJobs(m, r, &config.Config{}) {
+		if j.Name == monthlyPoodiumJob {
+			job = j
+		}
+	}
+
+	// Telegram is down, so the run fails instead of passing for a posted poodium
+	m.Err = errors.New("telegram is down")
+	if err := job.Run(context.Background(), run); err == nil {
+		t.Fatal("monthly poodium job with Telegram down succeeded, want an error")
+	}
+
+	// Catching up on the run posts it
+	m.Err = nil
+	m.Reset()
+	runJob(t, m, r, monthlyPoodiumJob, run)
+	if sent := m.CallsTo("SendText"); len(sent) != 1 || !strings.Contains(sent[0].Text, "March 2025") {
+		t.Errorf("monthly poodium retried sent %+v, want March's poodium", sent)
+	}
+}
+
+func TestCheckWellness_AlertsOncePerDay(t *testing.T) {
+	r := setupTestRepository(t)
+	m := messenger.NewRecorder()
+	ctx := context.Background()
+	cfg := &config.Config{WellnessThreshold: 2}
+
+	day := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		at := day.Add(time.Duration(i) * time.Hour)
+		if err := handleNewPoop(ctx, r, testChatID, 1001, "alice", int64(100+i), at.Unix()); err != nil {
+			t.Fatalf("handleNewPoop() error = %v", err)
+		}
+		checkWellness(ctx, m, r, cfg, testChatID, 1001, "alice", 100+i, at)
+	}
+
+	sent := m.CallsTo("SendText")
+	if len(sent) != 1 {
+		t.Fatalf("checkWellness() sent %d alerts, want 1", len(sent))
+	}
+	if sent[0].ReplyTo != 102 {
+		t.Errorf("the alert replies to message %d, want the third poop 102", sent[0].ReplyTo)
+	}
+}
+
+func TestHandleReactions_UsesRegisteredSticker(t *testing.T) {
+	r := setupTestRepository(t)
+	m := messenger.NewRecorder()
+	ctx := context.Background()
+
+	err := r.RegisterSticker(ctx, repo.Sticker{FileUniqueID: "AgADnew", SetName: "Poopers3", Emoji: "🔥"}, 1, time.Now().Unix())
+	if err != nil {
+		t.Fatalf("RegisterSticker() error = %v", err)
+	}
+	engine, err := reactions.NewEngine(nil, reactions.DefaultEmoji, nil)
+	if err != nil {
+		t.Fatalf("NewEngine() error = %v", err)
+	}
+
+	at := time.Now()
+	sticker := &tg_bot.Sticker{FileUniqueID: "AgADnew", SetName: "Poopers3", Emoji: "💩"}
+	handleReactions(ctx, m, engine, testChatID, 7, poopEvent(ctx, r, testChatID, 1001, sticker, at))
+	handleReactions(ctx, m, engine, testChatID, 8, poopEvent(ctx, r, testChatID, 1001, nil, at))
+
+	reacted := m.CallsTo("React")
+	if len(reacted) != 2 {
+		t.Fatalf("handleReactions() made %d reactions, want 2", len(reacted))
+	}
+	if reacted[0].MessageID != 7 || reacted[0].Emoji != "🔥" {
+		t.Errorf("reaction to the registered sticker = %+v, want 🔥 on message 7", reacted[0])
+	}
+	if reacted[1].Emoji != reactions.DefaultEmoji {
+		t.Errorf("reaction to a text poop = %q, want %q", reacted[1].Emoji, reactions.DefaultEmoji)
+	}
+}
+
+func TestHandleUpdate_LogsCarryTheUpdate(t *testing.T) {
+	r := setupTestRepository(t)
+	m := messenger.NewRecorder()
+	engine, err := reactions.NewEngine(nil, reactions.DefaultEmoji, nil)
+	if err != nil {
+		t.Fatalf("NewEngine() error = %v", err)
+	}
+
+	var out bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(logging.NewLogger(&out, slog.LevelDebug, ""))
+	defer slog.SetDefault(defaultLogger)
+
+	message := &tg_bot.Message{
+		MessageID: 10,
+		From:      &tg_bot.User{ID: 1001, UserName: "alice"},
+		Chat:      &tg_bot.Chat{ID: testChatID, Type: "supergroup"},
+		Date:      int(time.Now().Unix()),
+		Text:      "/leaderboard",
+		Entities:  []tg_bot.MessageEntity{{Type: "bot_command", Offset: 0, Length: len("/leaderboard")}},
+	}
+	handleUpdate(context.Background(), m, r, &config.Config{}, engine, nil, tg_bot.Update{UpdateID: 77, Message: message})
+
+	var record map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		if strings.Contains(line, "Command received") {
+			if err := json.Unmarshal([]byte(line), &record); err != nil {
+				t.Fatalf("record %q isn't JSON: %v", line, err)
+			}
+		}
+	}
+	if record == nil {
+		t.Fatalf("no record of the command in:\n%s", out.String())
+	}
+	want := map[string]any{"update_id": 77.0, "chat_id": float64(testChatID), "user_id": 1001.0, "command": "leaderboard"}
+	for key, value := range want {
+		if record[key] != value {
+			t.Errorf("record[%s] = %v, want %v", key, record[key], value)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"src/config"
+	"src/formatters"
+	"src/messenger"
+	"src/reactions"
+	repo "src/repository"
+	"src/scheduler"
+	"src/telegramtest"
+
+	tg_bot "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	e2eAdminID = int64(1)
+	e2eAliceID = int64(1001)
+)
+
+// e2eBot is the whole bot polling a fake Bot API, with a real database behind it
+type e2eBot struct {
+	fake       *telegramtest.Server
+	repository repo.Repository
+}
+
+func startE2EBot(t *testing.T) *e2eBot {
+	t.Helper()
+	fake := telegramtest.NewServer()
+	t.Cleanup(fake.Close)
+
+	cfg := &config.Config{
+		TelegramToken:   telegramtest.Token,
+		APIBaseURL:      fake.APIBaseURL(),
+		DBPath:          filepath.Join(t.TempDir(), "test.db"),
+		GroupChatID:     testChatID,
+		MyChatID:        e2eAdminID,
+		DefaultTimezone: "UTC",
+		UpdateMode:      config.UpdateModePolling,
+		UndoGracePeriod: 15 * time.Minute,
+	}
+
+	db, err := repo.OpenDBConnection(cfg)
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	repository := repo.NewRepository(db)
+	if err := repository.RegisterGroup(context.Background(), testChatID, "Poopers", "UTC"); err != nil {
+		t.Fatalf("Failed to register test group: %v", err)
+	}
+
+	engine, err := reactions.NewEngine(nil, reactions.DefaultEmoji, nil)
+	if err != nil {
+		t.Fatalf("NewEngine() error = %v", err)
+	}
+
+	bot, err := newBot(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create bot: %v", err)
+	}
+	m := messenger.NewTelegram(bot)
+	jobs, err := scheduler.New(repository, scheduledJobs(m, repository, cfg))
+	if err != nil {
+		t.Fatalf("Failed to create scheduler: %v", err)
+	}
+	updates, _ := receiveUpdates(bot, cfg, []string{"message", "callback_query"})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for update := range updates {
+			handleUpdate(context.Background(), m, repository, cfg, engine, jobs, update)
+		}
+	}()
+	// Stop polling and wait for the last update to be handled before the database is closed
+	t.Cleanup(func() {
+		bot.StopReceivingUpdates()
+		<-done
+	})
+
+	return &e2eBot{fake: fake, repository: repository}
+}
+
+// send delivers a message to the bot and returns the requests it made in response
+func (b *e2eBot) send(t *testing.T, message *tg_bot.Message, wantRequests int) []telegramtest.Request {
+	t.Helper()
+	b.fake.Reset()
+	b.fake.Push(tg_bot.Update{Message: message})
+
+	if err := b.fake.WaitForUpdatesConsumed(2 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.fake.WaitForRequests(wantRequests, 2*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	// Give stray requests a moment to show up, so tests catch the bot saying more than it should
+	time.Sleep(50 * time.Millisecond)
+	return b.fake.Requests()
+}
+
+func groupMessage(messageID int, userID int64, username string, text string) *tg_bot.Message {
+	return &tg_bot.Message{
+		MessageID: messageID,
+		From:      &tg_bot.User{ID: userID, UserName: username},
+		Chat:      &tg_bot.Chat{ID: testChatID, Type: "supergroup", Title: "Poopers"},
+		Date:      int(time.Now().Unix()),
+		Text:      text,
+	}
+}
+
+func commandMessage(messageID int, userID int64, username string, chat *tg_bot.Chat, command string) *tg_bot.Message {
+	message := groupMessage(messageID, userID, username, command)
+	message.Chat = chat
+	message.Entities = []tg_bot.MessageEntity{{Type: "bot_command", Offset: 0, Length: len(command)}}
+	return message
+}
+
+func assertRequests(t *testing.T, got []telegramtest.Request, want []telegramtest.Request) {
+	t.Helper()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("requests = %+v\nwant %+v", got, want)
+	}
+}
+
+func TestE2E_LogsPoopsAndReacts(t *testing.T) {
+	bot := startE2EBot(t)
+
+	requests := bot.send(t, groupMessage(10, e2eAliceID, "alice", "💩"), 1)
+	assertRequests(t, requests, []telegramtest.Request{{
+		Method: "setMessageReaction",
+		Params: map[string]string{"chat_id": "-100123", "message_id": "10", "reaction": `[{"type":"emoji","emoji":"💩"}]`},
+	}})
+
+	sticker := groupMessage(11, e2eAliceID, "alice", "")
+	sticker.Sticker = &tg_bot.Sticker{FileUniqueID: "AgADRhoAAhq7WVE", SetName: "Poopers2", Emoji: "💩"}
+	requests = bot.send(t, sticker, 1)
+	assertRequests(t, requests, []telegramtest.Request{{
+		Method: "setMessageReaction",
+		Params: map[string]string{"chat_id": "-100123", "message_id": "11", "reaction": `[{"type":"emoji","emoji":"🎉"}]`},
+	}})
+
+	// Chatter isn't logged or reacted to
+	requests = bot.send(t, groupMessage(12, e2eAliceID, "alice", "good morning"), 0)
+	assertRequests(t, requests, []telegramtest.Request{})
+
+	count, err := bot.repository.GetGlobalPoopCount(context.Background(), testChatID, e2eAliceID)
+	if err != nil {
+		t.Fatalf("GetGlobalPoopCount() error = %v", err)
+	}
+	if count != 2 {
+		t.Errorf("GetGlobalPoopCount() = %d, want 2", count)
+	}
+
+	user, err := bot.repository.GetUser(context.Background(), e2eAliceID)
+	if err != nil || user.Username != "alice" {
+		t.Errorf("GetUser() = %+v, %v, want alice recorded from her messages", user, err)
+	}
+}
+
+func TestE2E_Commands(t *testing.T) {
+	bot := startE2EBot(t)
+	group := &tg_bot.Chat{ID: testChatID, Type: "supergroup", Title: "Poopers"}
+
+	requests := bot.send(t, commandMessage(20, e2eAliceID, "alice", group, "/timezone"), 1)
+	assertRequests(t, requests, []telegramtest.Request{{
+		Method: "sendMessage",
+		Params: map[string]string{"chat_id": "-100123", "text": formatters.FormatGroupTimezone("UTC"), "parse_mode": "MarkdownV2", "entities": "null"},
+	}})
+
+	stranger := &tg_bot.Chat{ID: -100999, Type: "group", Title: "Strangers"}
+	requests = bot.send(t, commandMessage(21, e2eAliceID, "alice", stranger, "/leaderboard"), 1)
+	assertRequests(t, requests, []telegramtest.Request{{
+		Method: "sendMessage",
+		Params: map[string]string{"chat_id": "-100999", "text": "Sorry, I only respond to commands in registered group chats\\.", "parse_mode": "MarkdownV2", "entities": "null"},
+	}})
+
+	// Only the admin can register a group
+	requests = bot.send(t, commandMessage(22, e2eAdminID, "admin", stranger, "/register_group"), 1)
+	assertRequests(t, requests, []telegramtest.Request{{
+		Method: "sendMessage",
+		Params: map[string]string{"chat_id": "-100999", "text": "This group is now registered\\. Start logging your 💩\\!", "parse_mode": "MarkdownV2", "entities": "null"},
+	}})
+
+	registered, err := bot.repository.IsRegisteredGroup(context.Background(), -100999)
+	if err != nil || !registered {
+		t.Errorf("IsRegisteredGroup() = %v, %v, want the group registered", registered, err)
+	}
+}
+
+func TestE2E_BackfillsHiddenForwards(t *testing.T) {
+	bot := startE2EBot(t)
+	adminChat := &tg_bot.Chat{ID: e2eAdminID, Type: "private"}
+
+	// A sender who hides their account used to crash the bot, now the admin is asked who it was
+	forward := groupMessage(40, e2eAdminID, "admin", "💩")
+	forward.Chat = adminChat
+	forward.ForwardSenderName = "Alice Liddell"
+	forward.ForwardDate = int(time.Now().Add(-time.Hour).Unix())
+	requests := bot.send(t, forward, 1)
+	if len(requests) != 1 || requests[0].Method != "sendMessage" || requests[0].Params["reply_markup"] == "" {
+		t.Fatalf("A hidden forward made requests %+v, want a sender picker", requests)
+	}
+
+	// Once the sender is known, forwards log right away and get a reaction
+	forward = groupMessage(41, e2eAdminID, "admin", "💩")
+	forward.Chat = adminChat
+	forward.ForwardFrom = &tg_bot.User{ID: e2eAliceID, UserName: "alice", FirstName: "Alice"}
+	forward.ForwardDate = int(time.Now().Add(-2 * time.Hour).Unix())
+	requests = bot.send(t, forward, 1)
+	if len(requests) != 1 || requests[0].Method != "setMessageReaction" || requests[0].Params["message_id"] != "41" {
+		t.Fatalf("A forward from alice made requests %+v, want a reaction", requests)
+	}
+	count, err := bot.repository.GetGlobalPoopCount(context.Background(), testChatID, e2eAliceID)
+	if err != nil || count != 1 {
+		t.Errorf("Alice has %d poops after the forward, want 1 (err %v)", count, err)
+	}
+}
+
+func TestE2E_Jobs(t *testing.T) {
+	bot := startE2EBot(t)
+	adminChat := &tg_bot.Chat{ID: e2eAdminID, Type: "private"}
+
+	requests := bot.send(t, commandMessage(50, e2eAdminID, "admin", adminChat, "/jobs"), 1)
+	if len(requests) != 1 || !strings.Contains(requests[0].Params["text"], monthlyPoodiumJob) || !strings.Contains(requests[0].Params["text"], "Next run") {
+		t.Fatalf("/jobs made requests %+v, want the list of jobs", requests)
+	}
+
+	// Running last month's poodium by hand posts and pins it in the group, then confirms to the admin
+	run := commandMessage(51, e2eAdminID, "admin", adminChat, "/jobs run "+monthlyPoodiumJob)
+	run.Entities[0].Length = len("/jobs")
+	requests = bot.send(t, run, 3)
+	methods := make([]string, len(requests))
+	for i, request := range requests {
+		methods[i] = request.Method
+	}
+	if !reflect.DeepEqual(methods, []string{"sendMessage", "pinChatMessage", "sendMessage"}) || requests[2].Params["chat_id"] != "1" {
+		t.Errorf("/jobs run made requests %+v, want the poodium posted and pinned, then a confirmation", requests)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	tg_bot "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// forwardOrigin is where a forwarded message came from. Bot API 7.0 replaced the forward_* fields of messages with it,
+// but the library predates that and only decodes the old fields.
+type forwardOrigin struct {
+	Type            string          `json:"type"`
+	Date            int             `json:"date"`
+	SenderUser      json.RawMessage `json:"sender_user"`
+	SenderUserName  string          `json:"sender_user_name"`
+	SenderChat      json.RawMessage `json:"sender_chat"`
+	Chat            json.RawMessage `json:"chat"`
+	MessageID       int             `json:"message_id"`
+	AuthorSignature string          `json:"author_signature"`
+}
+
+// legacyForwardFields returns the pre-7.0 fields describing the same origin
+func (o forwardOrigin) legacyForwardFields() map[string]interface{} {
+	fields := map[string]interface{}{"forward_date": o.Date}
+	switch o.Type {
+	case "user":
+		fields["forward_from"] = o.SenderUser
+	case "hidden_user":
+		fields["forward_sender_name"] = o.SenderUserName
+	case "chat":
+		fields["forward_from_chat"] = o.SenderChat
+	case "channel":
+		fields["forward_from_chat"] = o.Chat
+		fields["forward_from_message_id"] = o.MessageID
+	}
+	if o.AuthorSignature != "" {
+		fields["forward_signature"] = o.AuthorSignature
+	}
+	return fields
+}
+
+// withLegacyForwardFields adds the old forward fields to a message that only has forward_origin, including the message a callback's message replies to
+func withLegacyForwardFields(message json.RawMessage) json.RawMessage {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(message, &fields); err != nil {
+		return message
+	}
+
+	changed := false
+	if reply, ok := fields["reply_to_message"]; ok {
+		fields["reply_to_message"] = withLegacyForwardFields(reply)
+		changed = true
+	}
+
+	_, hasLegacyFields := fields["forward_date"]
+	if rawOrigin, ok := fields["forward_origin"]; ok && !hasLegacyFields {
+		var origin forwardOrigin
+		if err := json.Unmarshal(rawOrigin, &origin); err == nil {
+			for key, value := range origin.legacyForwardFields() {
+				encoded, err := json.Marshal(value)
+				if err != nil {
+					continue
+				}
+				fields[key] = encoded
+			}
+			changed = true
+		}
+	}
+
+	if !changed {
+		return message
+	}
+	normalized, err := json.Marshal(fields)
+	if err != nil {
+		return message
+	}
+	return normalized
+}
+
+// normalizeUpdate rewrites the messages of a raw update so the library sees where forwards came from
+func normalizeUpdate(update json.RawMessage) json.RawMessage {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(update, &fields); err != nil {
+		return update
+	}
+
+	for _, key := range []string{"message", "edited_message", "channel_post", "edited_channel_post"} {
+		if message, ok := fields[key]; ok {
+			fields[key] = withLegacyForwardFields(message)
+		}
+	}
+	if rawQuery, ok := fields["callback_query"]; ok {
+		var query map[string]json.RawMessage
+		if err := json.Unmarshal(rawQuery, &query); err == nil {
+			if message, ok := query["message"]; ok {
+				query["message"] = withLegacyForwardFields(message)
+				if encoded, err := json.Marshal(query); err == nil {
+					fields["callback_query"] = encoded
+				}
+			}
+		}
+	}
+
+	normalized, err := json.Marshal(fields)
+	if err != nil {
+		return update
+	}
+	return normalized
+}
+
+// forwardOriginClient normalizes the updates returned by getUpdates before the library decodes them
+type forwardOriginClient struct {
+	client tg_bot.HTTPClient
+}
+
+func (c forwardOriginClient) Do(req *http.Request) (*http.Response, error) {
+	resp, err := c.client.Do(req)
+	if err != nil || !strings.HasSuffix(req.URL.Path, "/getUpdates") {
+		return resp, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var apiResp struct {
+		Result []json.RawMessage `json:"result"`
+	}
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(body, &apiResp) == nil && json.Unmarshal(body, &fields) == nil && apiResp.Result != nil {
+		for i, update := range apiResp.Result {
+			apiResp.Result[i] = normalizeUpdate(update)
+		}
+		if result, err := json.Marshal(apiResp.Result); err == nil {
+			fields["result"] = result
+			if normalized, err := json.Marshal(fields); err == nil {
+				body = normalized
+			}
+		}
+	}
+
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	return resp, nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	tg_bot "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestNormalizeUpdate(t *testing.T) {
+	tests := []struct {
+		name   string
+		origin string
+		check  func(t *testing.T, message *tg_bot.Message)
+	}{
+		{
+			name:   "user",
+			origin: `{"type":"user","date":1740821400,"sender_user":{"id":1001,"is_bot":false,"first_name":"Alice","username":"alice"}}`,
+			check: func(t *testing.T, message *tg_bot.Message) {
+				if message.ForwardFrom == nil || message.ForwardFrom.ID != 1001 {
+					t.Errorf("ForwardFrom = %+v, want alice", message.ForwardFrom)
+				}
+			},
+		},
+		{
+			name:   "hidden user",
+			origin: `{"type":"hidden_user","date":1740821400,"sender_user_name":"Alice Liddell"}`,
+			check: func(t *testing.T, message *tg_bot.Message) {
+				if message.ForwardFrom != nil || message.ForwardSenderName != "Alice Liddell" {
+					t.Errorf("ForwardFrom = %+v, ForwardSenderName = %q, want only the name", message.ForwardFrom, message.ForwardSenderName)
+				}
+			},
+		},
+		{
+			name:   "channel",
+			origin: `{"type":"channel","date":1740821400,"chat":{"id":-100999,"type":"channel"},"message_id":77}`,
+			check: func(t *testing.T, message *tg_bot.Message) {
+				if message.ForwardFromChat == nil || message.ForwardFromChat.ID != -100999 || message.ForwardFromMessageID != 77 {
+					t.Errorf("ForwardFromChat = %+v, ForwardFromMessageID = %d, want the channel post", message.ForwardFromChat, message.ForwardFromMessageID)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := `{"update_id":1,"message":{"message_id":5,"date":1740900000,"chat":{"id":1,"type":"private"},"text":"💩","forward_origin":` + tt.origin + `}}`
+
+			var update tg_bot.Update
+			if err := json.Unmarshal(normalizeUpdate(json.RawMessage(raw)), &update); err != nil {
+				t.Fatalf("Failed to decode normalized update: %v", err)
+			}
+			if update.Message == nil || update.Message.ForwardDate != 1740821400 {
+				t.Fatalf("Message = %+v, want the forward date of the origin", update.Message)
+			}
+			tt.check(t, update.Message)
+		})
+	}
+}
+
+func TestNormalizeUpdate_KeepsLegacyFields(t *testing.T) {
+	raw := `{"update_id":1,"message":{"message_id":5,"date":1740900000,"chat":{"id":1,"type":"private"},"forward_date":1740800000,"forward_sender_name":"Old"}}`
+
+	var update tg_bot.Update
+	if err := json.Unmarshal(normalizeUpdate(json.RawMessage(raw)), &update); err != nil {
+		t.Fatalf("Failed to decode normalized update: %v", err)
+	}
+	if update.Message.ForwardDate != 1740800000 || update.Message.ForwardSenderName != "Old" {
+		t.Errorf("Message = %+v, want the legacy forward fields untouched", update.Message)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"src/backfill"
+	"src/config"
+	repo "src/repository"
+)
+
+// runImport backfills poops from a Telegram Desktop export: bot import [-dry-run] [-chat id] [-tz zone] result.json
+func runImport(cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "report what would be added without writing anything")
+	chatID := flags.Int64("chat", 0, "chat to log the poops in, defaults to the exported chat")
+	timezone := flags.String("tz", "UTC", "timezone of the dates in exports without unix timestamps")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("usage: import [-dry-run] [-chat id] [-tz zone] result.json")
+	}
+
+	loc, err := time.LoadLocation(*timezone)
+	if err != nil {
+		return fmt.Errorf("invalid -tz: %w", err)
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	export, err := backfill.ParseExport(file)
+	if err != nil {
+		return err
+	}
+	if *chatID == 0 {
+		*chatID, err = export.ChatID()
+		if err != nil {
+			return err
+		}
+	}
+
+	db, err := repo.OpenDBConnection(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to open database connection: %w", err)
+	}
+	defer db.Close()
+	r := repo.NewRepository(db)
+
+	ctx := context.Background()
+	registered, err := r.IsRegisteredGroup(ctx, *chatID)
+	if err != nil {
+		return err
+	}
+	if !registered {
+		return fmt.Errorf("chat %d (%s) isn't a registered group, register it or pass -chat", *chatID, export.Name)
+	}
+
+	report, err := backfill.Import(ctx, r, *chatID, export, loc, *dryRun)
+	if err != nil {
+		return err
+	}
+	return report.Write(os.Stdout)
+}
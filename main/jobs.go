@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"src/config"
+	"src/formatters"
+	"src/logging"
+	"src/messenger"
+	repo "src/repository"
+	"src/scheduler"
+
+	tg_bot "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	monthlyPoodiumJob     = "monthly_poodium"
+	yearlyPoodiumJob      = "yearly_poodium"
+	groupWrappedJob       = "group_wrapped"
+	weeklyRecapJob        = "weekly_recap"
+	inactivityCheckInsJob = "inactivity_checkins"
+)
+
+// weeklyRecapHour is the local hour on Monday mornings when groups get last week's recap
+const weeklyRecapHour = 9
+
+// groupAnnouncement is a post every group gets once per period, when its own local time reaches the announcement hour
+type groupAnnouncement struct {
+	job string
+	// due reports whether a group whose local time is local should get the announcement
+	due func(local time.Time) bool
+	// period names the period the announcement covers, posts are claimed per group and period
+	period func(local time.Time) string
+	// send posts the announcement in a group, an error means it wasn't posted
+	send func(ctx context.Context, chatID int64, local time.Time) error
+}
+
+// run posts the announcement in every group it's due in and hasn't been posted in yet.
+// Announcement jobs run at the top of every hour, so they're due when a group's local time is in the announcement hour.
+// Manual runs post to every group straight away, even where the announcement for the period was already posted.
+// A group it fails in doesn't stop the others, but fails the run so it's retried.
+func (a groupAnnouncement) run(ctx context.Context, r repo.Repository, run scheduler.Run) error {
+	groups, err := r.GetGroups(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get registered groups: %w", err)
+	}
+
+	var errs []error
+	for _, group := range groups {
+		ctx := logging.With(ctx, slog.Int64(logging.ChatIDKey, group.ChatID))
+		loc, err := time.LoadLocation(group.Timezone)
+		if err != nil {
+			slog.WarnContext(ctx, "Invalid group timezone, using UTC", "timezone", group.Timezone, "error", err)
+			loc = time.UTC
+		}
+
+		local := run.ScheduledAt.In(loc)
+		if !run.Manual && !a.due(local) {
+			continue
+		}
+
+		// Claimed before sending, so a run that's caught up doesn't post twice. A manual run claims the period too,
+		// so the scheduled run doesn't repeat it, but posts even when it was already claimed.
+		period := a.period(local)
+		claimed, err := r.ClaimScheduledPost(ctx, a.job, group.ChatID, period, time.Now().Unix())
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to claim the announcement in group %d: %w", group.ChatID, err))
+			continue
+		}
+		if !claimed && !run.Manual {
+			continue
+		}
+
+		if err := a.send(ctx, group.ChatID, local); err != nil {
+			errs = append(errs, fmt.Errorf("failed to post in group %d: %w", group.ChatID, err))
+			// The claim is released so the next run posts it, a repeated manual post leaves the original's alone
+			if claimed {
+				if err := r.ReleaseScheduledPost(ctx, a.job, group.ChatID, period); err != nil {
+					errs = append(errs, fmt.Errorf("failed to release the announcement in group %d: %w", group.ChatID, err))
+				}
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// isNewYear reports whether local is in the first hour of the year
+func isNewYear(local time.Time) bool {
+	return local.YearDay() == 1 && local.Hour() == 0
+}
+
+func pastYear(local time.Time) string {
+	return fmt.Sprint(local.Year() - 1)
+}
+
+// scheduledJobs are the jobs the bot runs. The announcements catch up after downtime, missed check-ins are just asked in the next run.
+func scheduledJobs(m messenger.Messenger, r repo.Repository, cfg *config.Config) []scheduler.Job {
+	announcements := []groupAnnouncement{
+		{
+			job:    monthlyPoodiumJob,
+			due:    func(local time.Time) bool { return local.Day() == 1 && local.Hour() == 0 },
+			period: func(local time.Time) string { return local.AddDate(0, 0, -local.Day()).Format("2006-01") },
+			send: func(ctx context.Context, chatID int64, local time.Time) error {
+				return sendMonthlyPoodium(ctx, m, r, chatID, repo.MonthPeriod(local.Year(), local.Month()-1))
+			},
+		},
+		{
+			job:    yearlyPoodiumJob,
+			due:    isNewYear,
+			period: pastYear,
+			send: func(ctx context.Context, chatID int64, local time.Time) error {
+				return sendYearlyPoodium(ctx, m, r, chatID, local.Year()-1)
+			},
+		},
+		{
+			job:    groupWrappedJob,
+			due:    isNewYear,
+			period: pastYear,
+			send: func(ctx context.Context, chatID int64, local time.Time) error {
+				return sendGroupWrapped(ctx, m, r, chatID, local.Year()-1)
+			},
+		},
+		{
+			job: weeklyRecapJob,
+			due: func(local time.Time) bool { return local.Weekday() == time.Monday && local.Hour() == weeklyRecapHour },
+			period: func(local time.Time) string {
+				year, week := repo.WeekPeriod(local).Previous().Start.ISOWeek()
+				return fmt.Sprintf("%d-W%02d", year, week)
+			},
+			send: func(ctx context.Context, chatID int64, local time.Time) error {
+				return sendWeeklyRecap(ctx, m, r, chatID, repo.WeekPeriod(local).Previous())
+			},
+		},
+	}
+
+	var jobs []scheduler.Job
+	for _, a := range announcements {
+		a := a
+		jobs = append(jobs, scheduler.Job{
+			Name:    a.job,
+			Spec:    "0 * * * *",
+			CatchUp: true,
+			Run: func(ctx context.Context, run scheduler.Run) error {
+				return a.run(ctx, r, run)
+			},
+		})
+	}
+
+	jobs = append(jobs, scheduler.Job{
+		Name: inactivityCheckInsJob,
+		Spec: "30 * * * *",
+		Run: func(ctx context.Context, run scheduler.Run) error {
+			checkInactiveMembers(ctx, m, r, cfg, run.ScheduledAt)
+			return nil
+		},
+	})
+	return jobs
+}
+
+// handleJobsCommand handles the admin's /jobs [run <job>] command, listing the scheduled jobs or running one right away
+func handleJobsCommand(ctx context.Context, m messenger.Messenger, jobs *scheduler.Scheduler, msg tg_bot.MessageConfig, args string) {
+	fields := strings.Fields(args)
+	switch {
+	case len(fields) == 0:
+		statuses, err := jobs.Jobs(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to list scheduled jobs", "error", err)
+			msg.Text = "Sorry, I couldn't list the scheduled jobs\\. Please try again later\\!"
+			sendMessage(ctx, m, msg)
+			return
+		}
+		msg.Text = formatters.FormatJobs(statuses)
+	case len(fields) == 2 && fields[0] == "run":
+		err := jobs.Trigger(ctx, fields[1])
+		switch {
+		case errors.Is(err, scheduler.ErrUnknownJob):
+			msg.Text = formatters.FormatUnknownJob(fields[1])
+		case err != nil:
+			slog.ErrorContext(ctx, "Manual run of job failed", "job", fields[1], "error", err)
+			msg.Text = formatters.FormatJobFailed(fields[1])
+		default:
+			msg.Text = formatters.FormatJobTriggered(fields[1])
+		}
+	default:
+		msg.Text = "Use _/jobs_ to list the scheduled jobs or _/jobs run \\<job\\>_ to run one now\\."
+	}
+	sendMessage(ctx, m, msg)
+}
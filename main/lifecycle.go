@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"src/config"
+	"src/logging"
+	"src/messenger"
+	"src/reactions"
+	repo "src/repository"
+	"src/scheduler"
+
+	tg_bot "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// shutdownTimeout is how long in-flight updates and jobs get to finish once the bot is asked to stop
+	shutdownTimeout = 20 * time.Second
+	// cancelTimeout is how long cancelled updates and jobs get to return before the database is closed under them
+	cancelTimeout = 5 * time.Second
+)
+
+// run runs the bot until ctx is cancelled, then shuts it down gracefully:
+// it stops receiving updates, lets the handlers and jobs that are running finish within shutdownTimeout
+// and only then closes the database.
+func run(ctx context.Context, cfg *config.Config) error {
+	bot, err := newBot(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create new bot instance: %w", err)
+	}
+
+	m := messenger.NewTelegram(bot)
+
+	db, err := repo.OpenDBConnection(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to open database connection: %w", err)
+	}
+	defer func() {
+		if err := repo.CloseDBConnection(db); err != nil {
+			slog.Error("Failed to close the database", "error", err)
+		}
+	}()
+
+	db.SetMaxOpenConns(25)
+	db.SetMaxIdleConns(5)
+	db.SetConnMaxLifetime(5 * time.Minute)
+
+	repository := repo.NewRepository(db)
+
+	var reactionRules []reactions.Rule
+	if cfg.ReactionRulesPath != "" {
+		reactionRules, err = reactions.LoadRules(cfg.ReactionRulesPath)
+		if err != nil {
+			return fmt.Errorf("failed to load reaction rules: %w", err)
+		}
+	}
+	reactionEngine, err := reactions.NewEngine(reactionRules, reactions.DefaultEmoji, nil)
+	if err != nil {
+		return fmt.Errorf("invalid reaction rules: %w", err)
+	}
+
+	// Register the configured groups and hand logs from before chats were tracked to the main group
+	for _, groupChatID := range cfg.GroupChatIDs {
+		err = repository.RegisterGroup(ctx, groupChatID, "", cfg.DefaultTimezone)
+		if err != nil {
+			return fmt.Errorf("failed to register group %d: %w", groupChatID, err)
+		}
+	}
+
+	claimed, err := repository.ClaimUnscopedLogs(ctx, cfg.GroupChatID)
+	if err != nil {
+		return fmt.Errorf("failed to assign existing logs to group %d: %w", cfg.GroupChatID, err)
+	}
+	if claimed > 0 {
+		slog.Info("Assigned existing logs to the main group", logging.ChatIDKey, cfg.GroupChatID, "count", claimed)
+	}
+
+	// Announcements and check-ins run in a single scheduler, which catches up on runs missed while the bot was stopped
+	jobs, err := scheduler.New(repository, scheduledJobs(m, repository, cfg))
+	if err != nil {
+		return fmt.Errorf("failed to schedule jobs: %w", err)
+	}
+
+	// Handlers and jobs outlive ctx so they can finish what they started, they're only cancelled when shutting down takes too long
+	workCtx, cancelWork := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelWork()
+
+	loop := &heartbeat{}
+	if cfg.MonitoringListenAddr != "" {
+		listener, err := net.Listen("tcp", cfg.MonitoringListenAddr)
+		if err != nil {
+			return fmt.Errorf("failed to listen on MONITORING_LISTEN_ADDR: %w", err)
+		}
+		// Deferred after the database is, so it's closed before it
+		defer startMonitoring(listener, repository, loop).Close()
+	}
+
+	updates, webhookServer := receiveUpdates(bot, cfg, []string{"message", "callback_query"})
+
+	stopHandling := make(chan struct{})
+	handled := make(chan struct{})
+	go func() {
+		defer close(handled)
+		handleUpdates(updates, stopHandling, loop, func(update tg_bot.Update) {
+			handleUpdate(workCtx, m, repository, cfg, reactionEngine, jobs, update)
+		})
+	}()
+
+	// Catching up on missed runs happens in the background, so updates are handled and /healthz is up meanwhile
+	jobs.Start(workCtx)
+
+	<-ctx.Done()
+	slog.Info("Shutting down...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	stopReceiving(shutdownCtx, bot, webhookServer)
+	close(stopHandling)
+	jobsStopped := jobs.Stop()
+
+	if !waitUntilDone(shutdownCtx, handled, jobsStopped.Done()) {
+		slog.Warn("Updates and jobs didn't finish in time, cancelling them", "timeout", shutdownTimeout)
+		cancelWork()
+
+		// Queries return soon after their context is cancelled, give them that before closing the database
+		cancelCtx, cancel := context.WithTimeout(context.Background(), cancelTimeout)
+		defer cancel()
+		if !waitUntilDone(cancelCtx, handled, jobsStopped.Done()) {
+			slog.Error("Updates and jobs didn't stop after being cancelled, closing the database anyway", "timeout", cancelTimeout)
+		}
+	}
+
+	slog.Info("Bot stopped.")
+	return nil
+}
+
+// waitUntilDone waits for every channel to close, it returns false if ctx ends first
+func waitUntilDone(ctx context.Context, channels ...<-chan struct{}) bool {
+	for _, done := range channels {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return false
+		}
+	}
+	return true
+}
+
+// handleUpdates handles updates until stop is closed, then handles the ones already received before returning.
+// The loop beats every time it goes round, and at least every heartbeatInterval while it's waiting.
+func handleUpdates(updates tg_bot.UpdatesChannel, stop <-chan struct{}, loop *heartbeat, handle func(tg_bot.Update)) {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		loop.beat(time.Now())
+		select {
+		case <-ticker.C:
+		case update, ok := <-updates:
+			if !ok {
+				return
+			}
+			handle(update)
+		case <-stop:
+			for {
+				select {
+				case update, ok := <-updates:
+					if !ok {
+						return
+					}
+					handle(update)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// stopReceiving stops taking new updates. A webhook finishes the requests it's serving, updates that were
+// still being long polled aren't confirmed and Telegram delivers them again on the next start.
+func stopReceiving(ctx context.Context, bot *tg_bot.BotAPI, webhookServer *http.Server) {
+	if webhookServer == nil {
+		bot.StopReceivingUpdates()
+		return
+	}
+	if err := webhookServer.Shutdown(ctx); err != nil {
+		slog.Error("Failed to shut down the webhook server", "error", err)
+		webhookServer.Close()
+	}
+}
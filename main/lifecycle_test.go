@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"src/config"
+	repo "src/repository"
+	"src/telegramtest"
+
+	tg_bot "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestRun_StopsGracefullyOnSIGTERM(t *testing.T) {
+	fake := telegramtest.NewServer()
+	defer fake.Close()
+
+	cfg := &config.Config{
+		TelegramToken:   telegramtest.Token,
+		APIBaseURL:      fake.APIBaseURL(),
+		DBPath:          filepath.Join(t.TempDir(), "test.db"),
+		GroupChatID:     testChatID,
+		GroupChatIDs:    []int64{testChatID},
+		MyChatID:        e2eAdminID,
+		DefaultTimezone: "UTC",
+		UpdateMode:      config.UpdateModePolling,
+		UndoGracePeriod: 15 * time.Minute,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM)
+	defer stop()
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- run(ctx, cfg) }()
+
+	// The poop is received but may still be waiting to be handled when the signal arrives
+	fake.Push(tg_bot.Update{Message: groupMessage(10, e2eAliceID, "alice", "💩")})
+	if err := fake.WaitForUpdatesConsumed(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatalf("Failed to send SIGTERM: %v", err)
+	}
+
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Fatalf("run() error = %v", err)
+		}
+	case <-time.After(shutdownTimeout):
+		t.Fatal("run() didn't return after SIGTERM")
+	}
+
+	// The database was closed cleanly with the poop in it
+	db, err := repo.OpenDBConnection(cfg)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Now().UTC()
+	leaderboard, err := repo.GetLeaderboard(context.Background(), db, testChatID, repo.YearPeriod(now.Year()), repo.MostPoopsFirst, 0)
+	if err != nil {
+		t.Fatalf("GetLeaderboard() error = %v", err)
+	}
+	if len(leaderboard) != 1 || leaderboard[0].PoopCount != 1 {
+		t.Errorf("leaderboard after shutdown = %+v, want alice's poop", leaderboard)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"src/metrics"
+	repo "src/repository"
+)
+
+const (
+	// heartbeatInterval is how often the update loop reports it's alive while there are no updates
+	heartbeatInterval = 30 * time.Second
+	// maxHeartbeatAge is how long the update loop can go quiet before /healthz reports it stuck
+	maxHeartbeatAge = 2 * time.Minute
+)
+
+// heartbeat records when the update loop last went round, a handler that hangs stops it
+type heartbeat struct {
+	lastUnixNano atomic.Int64
+}
+
+func (h *heartbeat) beat(now time.Time) {
+	h.lastUnixNano.Store(now.UnixNano())
+}
+
+// age is how long ago the loop last went round, or ok false if it never did
+func (h *heartbeat) age(now time.Time) (time.Duration, bool) {
+	last := h.lastUnixNano.Load()
+	if last == 0 {
+		return 0, false
+	}
+	return now.Sub(time.Unix(0, last)), true
+}
+
+// healthHandler answers Fly's health checks: the database must answer a ping and the update loop must have gone round recently
+func healthHandler(r repo.Repository, loop *heartbeat) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if err := r.HealthCheck(req.Context()); err != nil {
+			slog.Error("Health check failed", "error", err)
+			http.Error(w, "database unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		age, ok := loop.age(time.Now())
+		if !ok {
+			http.Error(w, "update loop not started", http.StatusServiceUnavailable)
+			return
+		}
+		if age > maxHeartbeatAge {
+			slog.Error("Health check failed, the update loop is stuck", "last_seen_ago", age.Round(time.Second))
+			http.Error(w, fmt.Sprintf("update loop last seen %s ago", age.Round(time.Second)), http.StatusServiceUnavailable)
+			return
+		}
+
+		fmt.Fprintln(w, "ok")
+	}
+}
+
+// startMonitoring serves /healthz and /metrics on listener in the background
+func startMonitoring(listener net.Listener, r repo.Repository, loop *heartbeat) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", healthHandler(r, loop))
+	mux.Handle("/metrics", metrics.Default)
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		err := server.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Monitoring server stopped", "error", err)
+		}
+	}()
+
+	slog.Info("Serving /healthz and /metrics", "addr", listener.Addr().String())
+	return server
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	repo "src/repository"
+)
+
+// unhealthyRepository fails its health check
+type unhealthyRepository struct {
+	repo.Repository
+}
+
+func (unhealthyRepository) HealthCheck(ctx context.Context) error {
+	return errors.New("database is locked")
+}
+
+func TestHealthHandler(t *testing.T) {
+	r := setupTestRepository(t)
+
+	tests := []struct {
+		name       string
+		repository repo.Repository
+		lastBeat   time.Time
+		wantStatus int
+	}{
+		{"healthy", r, time.Now(), http.StatusOK},
+		{"update loop never started", r, time.Time{}, http.StatusServiceUnavailable},
+		{"update loop stuck", r, time.Now().Add(-maxHeartbeatAge - time.Second), http.StatusServiceUnavailable},
+		{"database down", unhealthyRepository{r}, time.Now(), http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loop := &heartbeat{}
+			if !tt.lastBeat.IsZero() {
+				loop.beat(tt.lastBeat)
+			}
+
+			recorder := httptest.NewRecorder()
+			healthHandler(tt.repository, loop)(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d (body %q)", recorder.Code, tt.wantStatus, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestMonitoringServer(t *testing.T) {
+	r := setupTestRepository(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	loop := &heartbeat{}
+	loop.beat(time.Now())
+	server := startMonitoring(listener, r, loop)
+	defer server.Close()
+
+	// A query shows up in the latency histogram of its Repository method
+	if _, err := r.GetGroups(context.Background()); err != nil {
+		t.Fatalf("GetGroups() error = %v", err)
+	}
+
+	get := func(path string) (int, string) {
+		resp, err := http.Get("http://" + listener.Addr().String() + path)
+		if err != nil {
+			t.Fatalf("GET %s error = %v", path, err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	if status, body := get("/healthz"); status != http.StatusOK || body != "ok\n" {
+		t.Errorf("GET /healthz = %d %q, want 200 ok", status, body)
+	}
+
+	status, body := get("/metrics")
+	if status != http.StatusOK {
+		t.Fatalf("GET /metrics = %d", status)
+	}
+	for _, want := range []string{
+		"# TYPE bot_updates_processed_total counter",
+		"# TYPE bot_poops_logged_total counter",
+		`bot_repository_query_duration_seconds_count{method="GetGroups"}`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("GET /metrics is missing %q", want)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+
+	"src/config"
+
+	tg_bot "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// secretTokenHeader carries the secret_token given to setWebhook on every update Telegram posts
+const secretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// webhookHandler accepts updates posted by Telegram and passes them on, rejecting requests without the secret
+func webhookHandler(secret string, updates chan<- tg_bot.Update) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		token := r.Header.Get(secretTokenHeader)
+		if subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+			slog.Warn("Rejected webhook request with an invalid secret token", "remote_addr", r.RemoteAddr)
+			http.Error(w, "invalid secret token", http.StatusUnauthorized)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			slog.Error("Failed to read webhook update", "error", err)
+			http.Error(w, "invalid update", http.StatusBadRequest)
+			return
+		}
+
+		var update tg_bot.Update
+		if err := json.Unmarshal(normalizeUpdate(body), &update); err != nil {
+			slog.Error("Failed to decode webhook update", "error", err)
+			http.Error(w, "invalid update", http.StatusBadRequest)
+			return
+		}
+
+		select {
+		case updates <- update:
+			w.WriteHeader(http.StatusOK)
+		case <-r.Context().Done():
+			// Telegram gave up waiting and will deliver the update again
+		}
+	}
+}
+
+// listenForWebhook serves the webhook endpoint on listener in the background
+func listenForWebhook(listener net.Listener, path string, secret string, buffer int) (tg_bot.UpdatesChannel, *http.Server) {
+	updates := make(chan tg_bot.Update, buffer)
+
+	mux := http.NewServeMux()
+	mux.Handle(path, webhookHandler(secret, updates))
+	server := &http.Server{Handler: mux}
+
+	go func() {
+		err := server.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Webhook server stopped", "error", err)
+		}
+	}()
+
+	return updates, server
+}
+
+// setWebhook registers the webhook with Telegram, the library's WebhookConfig can't send a secret_token so the request is built by hand
+func setWebhook(bot *tg_bot.BotAPI, webhookURL string, secret string, allowedUpdates []string) error {
+	params := tg_bot.Params{"url": webhookURL}
+	params.AddNonEmpty("secret_token", secret)
+	if err := params.AddInterface("allowed_updates", allowedUpdates); err != nil {
+		return err
+	}
+
+	_, err := bot.MakeRequest("setWebhook", params)
+	return err
+}
+
+// startWebhook serves the webhook endpoint on listener and points Telegram at it
+func startWebhook(bot *tg_bot.BotAPI, cfg *config.Config, listener net.Listener, allowedUpdates []string) (tg_bot.UpdatesChannel, *http.Server, error) {
+	webhookURL, err := url.Parse(cfg.WebhookURL)
+	if err != nil {
+		listener.Close()
+		return nil, nil, fmt.Errorf("invalid WEBHOOK_URL: %w", err)
+	}
+	path := webhookURL.Path
+	if path == "" {
+		path = "/"
+	}
+
+	updates, server := listenForWebhook(listener, path, cfg.WebhookSecret, bot.Buffer)
+
+	err = setWebhook(bot, cfg.WebhookURL, cfg.WebhookSecret, allowedUpdates)
+	if err != nil {
+		server.Close()
+		return nil, nil, fmt.Errorf("failed to set webhook: %w", err)
+	}
+
+	slog.Info("Receiving updates through the webhook", "addr", listener.Addr().String(), "path", path)
+	return updates, server, nil
+}
+
+// receiveUpdates delivers updates in the configured mode, falling back to long polling if the webhook can't be set up.
+// The returned server is nil when polling.
+func receiveUpdates(bot *tg_bot.BotAPI, cfg *config.Config, allowedUpdates []string) (tg_bot.UpdatesChannel, *http.Server) {
+	if cfg.UpdateMode == config.UpdateModeWebhook {
+		listener, err := net.Listen("tcp", cfg.WebhookListenAddr)
+		if err == nil {
+			var updates tg_bot.UpdatesChannel
+			var server *http.Server
+			updates, server, err = startWebhook(bot, cfg, listener, allowedUpdates)
+			if err == nil {
+				return updates, server
+			}
+		}
+		slog.Warn("Webhook unavailable, falling back to long polling", "error", err)
+
+		// Telegram refuses getUpdates while a webhook is registered
+		if _, err := bot.Request(tg_bot.DeleteWebhookConfig{}); err != nil {
+			slog.Error("Failed to remove the webhook", "error", err)
+		}
+	}
+
+	updateConfig := tg_bot.NewUpdate(0)
+	updateConfig.Timeout = 30
+	updateConfig.AllowedUpdates = allowedUpdates
+	return bot.GetUpdatesChan(updateConfig), nil
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"src/config"
+	"src/telegramtest"
+
+	tg_bot "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const testSecret = "s3cret-token"
+
+// newTestBot connects a bot to a fresh fake Bot API
+func newTestBot(t *testing.T) (*telegramtest.Server, *tg_bot.BotAPI) {
+	t.Helper()
+	fake := telegramtest.NewServer()
+	t.Cleanup(fake.Close)
+
+	bot, err := newBot(&config.Config{TelegramToken: telegramtest.Token, APIBaseURL: fake.APIBaseURL()})
+	if err != nil {
+		t.Fatalf("Failed to create bot: %v", err)
+	}
+	return fake, bot
+}
+
+func TestWebhookEndToEnd(t *testing.T) {
+	fake, bot := newTestBot(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	cfg := &config.Config{
+		UpdateMode:    config.UpdateModeWebhook,
+		WebhookURL:    "https://poop.example.com/telegram/webhook",
+		WebhookSecret: testSecret,
+	}
+
+	updates, server, err := startWebhook(bot, cfg, listener, []string{"message", "callback_query"})
+	if err != nil {
+		t.Fatalf("startWebhook() error = %v", err)
+	}
+	defer server.Close()
+
+	setWebhookCalls := fake.RequestsTo("setWebhook")
+	if len(setWebhookCalls) != 1 {
+		t.Fatalf("setWebhook was called %d times, want 1", len(setWebhookCalls))
+	}
+	params := setWebhookCalls[0].Params
+	if params["url"] != cfg.WebhookURL || params["secret_token"] != testSecret || params["allowed_updates"] != `["message","callback_query"]` {
+		t.Errorf("setWebhook params = %v", params)
+	}
+
+	recorded, err := os.ReadFile("testdata/update_poop.json")
+	if err != nil {
+		t.Fatalf("Failed to read recorded update: %v", err)
+	}
+	endpoint := "http://" + listener.Addr().String() + "/telegram/webhook"
+
+	post := func(secret string, body []byte) int {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("Failed to build request: %v", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if secret != "" {
+			req.Header.Set(secretTokenHeader, secret)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to post update: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	tests := []struct {
+		name       string
+		secret     string
+		body       []byte
+		wantStatus int
+	}{
+		{name: "missing secret", body: recorded, wantStatus: http.StatusUnauthorized},
+		{name: "wrong secret", secret: "guess", body: recorded, wantStatus: http.StatusUnauthorized},
+		{name: "malformed update", secret: testSecret, body: []byte("{"), wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status := post(tt.secret, tt.body); status != tt.wantStatus {
+				t.Errorf("POST status = %d, want %d", status, tt.wantStatus)
+			}
+		})
+	}
+
+	resp, err := http.Get(endpoint)
+	if err != nil {
+		t.Fatalf("Failed to GET the webhook: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET status = %d, want %d", resp.StatusCode, http.StatusMethodNotAllowed)
+	}
+
+	if status := post(testSecret, recorded); status != http.StatusOK {
+		t.Fatalf("POST status = %d, want %d", status, http.StatusOK)
+	}
+
+	select {
+	case update := <-updates:
+		if update.UpdateID != 512345678 || update.Message == nil || update.Message.Text != "💩" || update.Message.From.UserName != "alice" {
+			t.Errorf("received update = %+v, want the recorded poop from alice", update)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("The recorded update was never delivered")
+	}
+
+	// Rejected requests must not have produced updates
+	select {
+	case update := <-updates:
+		t.Errorf("unexpected update delivered: %+v", update)
+	default:
+	}
+}
+
+func TestReceiveUpdates_FallsBackToPolling(t *testing.T) {
+	fake, bot := newTestBot(t)
+	fake.Fail("setWebhook", "bad webhook")
+
+	cfg := &config.Config{
+		UpdateMode:        config.UpdateModeWebhook,
+		WebhookURL:        "https://poop.example.com/webhook",
+		WebhookSecret:     testSecret,
+		WebhookListenAddr: "127.0.0.1:0",
+	}
+
+	updates, server := receiveUpdates(bot, cfg, []string{"message"})
+	defer bot.StopReceivingUpdates()
+	if server != nil {
+		server.Close()
+		t.Fatal("receiveUpdates() started a webhook server although setWebhook failed")
+	}
+
+	if len(fake.RequestsTo("deleteWebhook")) != 1 {
+		t.Error("receiveUpdates() didn't remove the webhook before polling")
+	}
+
+	fake.Push(tg_bot.Update{Message: &tg_bot.Message{MessageID: 1, Text: "💩"}})
+	select {
+	case update := <-updates:
+		if update.Message == nil || update.Message.Text != "💩" {
+			t.Errorf("polled update = %+v, want the pushed poop", update)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("receiveUpdates() never polled for updates")
+	}
+}
@@ -0,0 +1,150 @@
+// Package messenger abstracts everything the bot sends to Telegram, so handlers and jobs can be tested without it.
+package messenger
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"src/metrics"
+
+	tg_bot "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Photo is an in-memory image to upload
+type Photo struct {
+	Name string
+	Data []byte
+}
+
+// Document is a file to upload, read as it is sent so it never has to fit in memory
+type Document struct {
+	Name   string
+	Reader io.Reader
+	// Caption is MarkdownV2, it may be empty
+	Caption string
+}
+
+// Messenger sends, edits and decorates messages. Text is always MarkdownV2.
+type Messenger interface {
+	// SendText sends a message and returns its ID
+	SendText(msg tg_bot.MessageConfig) (int, error)
+	SendPhoto(chatID int64, photo Photo) (int, error)
+	// SendAlbum sends up to ten photos as a single album
+	SendAlbum(chatID int64, photos []Photo) error
+	SendDocument(chatID int64, document Document) (int, error)
+	Pin(chatID int64, messageID int) error
+	Unpin(chatID int64, messageID int) error
+	React(chatID int64, messageID int, emoji string) error
+	EditText(chatID int64, messageID int, text string) error
+	// AnswerCallback acknowledges an inline keyboard press, showing text as a notification when it isn't empty
+	AnswerCallback(callbackID string, text string) error
+}
+
+// Telegram is the Messenger backed by the Bot API
+type Telegram struct {
+	bot *tg_bot.BotAPI
+}
+
+func NewTelegram(bot *tg_bot.BotAPI) *Telegram {
+	return &Telegram{bot: bot}
+}
+
+// countFailure counts a failed Bot API request by method and passes the error on
+func countFailure(method string, err error) error {
+	if err != nil {
+		metrics.TelegramSendFailures.With(method).Inc()
+	}
+	return err
+}
+
+func (t *Telegram) SendText(msg tg_bot.MessageConfig) (int, error) {
+	msg.ParseMode = tg_bot.ModeMarkdownV2
+	sent, err := t.bot.Send(msg)
+	if err := countFailure("sendMessage", err); err != nil {
+		return 0, err
+	}
+	return sent.MessageID, nil
+}
+
+func (t *Telegram) SendPhoto(chatID int64, photo Photo) (int, error) {
+	sent, err := t.bot.Send(tg_bot.NewPhoto(chatID, tg_bot.FileBytes{Name: photo.Name, Bytes: photo.Data}))
+	if err := countFailure("sendPhoto", err); err != nil {
+		return 0, err
+	}
+	return sent.MessageID, nil
+}
+
+func (t *Telegram) SendAlbum(chatID int64, photos []Photo) error {
+	if len(photos) == 0 || len(photos) > 10 {
+		return fmt.Errorf("an album needs between 1 and 10 photos, got %d", len(photos))
+	}
+
+	media := make([]interface{}, 0, len(photos))
+	for _, photo := range photos {
+		media = append(media, tg_bot.NewInputMediaPhoto(tg_bot.FileBytes{Name: photo.Name, Bytes: photo.Data}))
+	}
+	_, err := t.bot.SendMediaGroup(tg_bot.NewMediaGroup(chatID, media))
+	return countFailure("sendMediaGroup", err)
+}
+
+func (t *Telegram) SendDocument(chatID int64, document Document) (int, error) {
+	upload := tg_bot.NewDocument(chatID, tg_bot.FileReader{Name: document.Name, Reader: document.Reader})
+	if document.Caption != "" {
+		upload.Caption = document.Caption
+		upload.ParseMode = tg_bot.ModeMarkdownV2
+	}
+	sent, err := t.bot.Send(upload)
+	if err := countFailure("sendDocument", err); err != nil {
+		return 0, err
+	}
+	return sent.MessageID, nil
+}
+
+func (t *Telegram) Pin(chatID int64, messageID int) error {
+	_, err := t.bot.Request(tg_bot.PinChatMessageConfig{
+		ChatID:              chatID,
+		MessageID:           messageID,
+		DisableNotification: true,
+	})
+	return countFailure("pinChatMessage", err)
+}
+
+func (t *Telegram) Unpin(chatID int64, messageID int) error {
+	_, err := t.bot.Request(tg_bot.UnpinChatMessageConfig{
+		ChatID:    chatID,
+		MessageID: messageID,
+	})
+	return countFailure("unpinChatMessage", err)
+}
+
+type reactionType struct {
+	Type  string `json:"type"`
+	Emoji string `json:"emoji"`
+}
+
+// React sets the bot's reaction to a message, the library doesn't support setMessageReaction yet
+func (t *Telegram) React(chatID int64, messageID int, emoji string) error {
+	reaction, err := json.Marshal([]reactionType{{Type: "emoji", Emoji: emoji}})
+	if err != nil {
+		return fmt.Errorf("failed to marshal reaction: %w", err)
+	}
+
+	params := tg_bot.Params{"reaction": string(reaction)}
+	params.AddNonZero64("chat_id", chatID)
+	params.AddNonZero("message_id", messageID)
+	_, err = t.bot.MakeRequest("setMessageReaction", params)
+	return countFailure("setMessageReaction", err)
+}
+
+func (t *Telegram) EditText(chatID int64, messageID int, text string) error {
+	edit := tg_bot.NewEditMessageText(chatID, messageID, text)
+	edit.ParseMode = tg_bot.ModeMarkdownV2
+	_, err := t.bot.Send(edit)
+	return countFailure("editMessageText", err)
+}
+
+func (t *Telegram) AnswerCallback(callbackID string, text string) error {
+	_, err := t.bot.Request(tg_bot.NewCallback(callbackID, text))
+	return countFailure("answerCallbackQuery", err)
+}
@@ -0,0 +1,127 @@
+package messenger
+
+import (
+	"io"
+	"sync"
+
+	tg_bot "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Call is a single request made to a Recorder
+type Call struct {
+	Method    string
+	ChatID    int64
+	MessageID int
+	Text      string
+	Emoji     string
+	Photos    []Photo
+	// FileName and FileData are the uploaded document, read in full
+	FileName string
+	FileData []byte
+	ReplyTo  int
+	Keyboard *tg_bot.InlineKeyboardMarkup
+}
+
+// Recorder is a Messenger that records every call instead of talking to Telegram, for tests
+type Recorder struct {
+	mu     sync.Mutex
+	calls  []Call
+	nextID int
+
+	// Err, when set, is returned by every call, which is still recorded
+	Err error
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{nextID: 1}
+}
+
+// Calls returns the recorded calls in order
+func (r *Recorder) Calls() []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	calls := make([]Call, len(r.calls))
+	copy(calls, r.calls)
+	return calls
+}
+
+// CallsTo returns the recorded calls of a single method
+func (r *Recorder) CallsTo(method string) []Call {
+	var calls []Call
+	for _, call := range r.Calls() {
+		if call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// Reset forgets the recorded calls
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = nil
+}
+
+// record stores a call and returns the ID the recorded message would have
+func (r *Recorder) record(call Call) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, call)
+	if r.Err != nil {
+		return 0, r.Err
+	}
+	id := r.nextID
+	r.nextID++
+	return id, nil
+}
+
+func (r *Recorder) SendText(msg tg_bot.MessageConfig) (int, error) {
+	call := Call{Method: "SendText", ChatID: msg.ChatID, Text: msg.Text, ReplyTo: msg.ReplyToMessageID}
+	if keyboard, ok := msg.ReplyMarkup.(tg_bot.InlineKeyboardMarkup); ok {
+		call.Keyboard = &keyboard
+	}
+	return r.record(call)
+}
+
+func (r *Recorder) SendPhoto(chatID int64, photo Photo) (int, error) {
+	return r.record(Call{Method: "SendPhoto", ChatID: chatID, Photos: []Photo{photo}})
+}
+
+func (r *Recorder) SendAlbum(chatID int64, photos []Photo) error {
+	_, err := r.record(Call{Method: "SendAlbum", ChatID: chatID, Photos: photos})
+	return err
+}
+
+func (r *Recorder) SendDocument(chatID int64, document Document) (int, error) {
+	data, err := io.ReadAll(document.Reader)
+	if err != nil {
+		return 0, err
+	}
+	return r.record(Call{Method: "SendDocument", ChatID: chatID, Text: document.Caption, FileName: document.Name, FileData: data})
+}
+
+func (r *Recorder) Pin(chatID int64, messageID int) error {
+	_, err := r.record(Call{Method: "Pin", ChatID: chatID, MessageID: messageID})
+	return err
+}
+
+func (r *Recorder) Unpin(chatID int64, messageID int) error {
+	_, err := r.record(Call{Method: "Unpin", ChatID: chatID, MessageID: messageID})
+	return err
+}
+
+func (r *Recorder) React(chatID int64, messageID int, emoji string) error {
+	_, err := r.record(Call{Method: "React", ChatID: chatID, MessageID: messageID, Emoji: emoji})
+	return err
+}
+
+func (r *Recorder) EditText(chatID int64, messageID int, text string) error {
+	_, err := r.record(Call{Method: "EditText", ChatID: chatID, MessageID: messageID, Text: text})
+	return err
+}
+
+func (r *Recorder) AnswerCallback(callbackID string, text string) error {
+	_, err := r.record(Call{Method: "AnswerCallback", Text: text})
+	return err
+}
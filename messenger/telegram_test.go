@@ -0,0 +1,101 @@
+package messenger
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"src/metrics"
+	"src/telegramtest"
+
+	tg_bot "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func newTestTelegram(t *testing.T) (*telegramtest.Server, *Telegram) {
+	t.Helper()
+	fake := telegramtest.NewServer()
+	t.Cleanup(fake.Close)
+
+	bot, err := tg_bot.NewBotAPIWithAPIEndpoint(telegramtest.Token, fake.APIBaseURL()+"%s/%s")
+	if err != nil {
+		t.Fatalf("Failed to create bot: %v", err)
+	}
+	return fake, NewTelegram(bot)
+}
+
+func TestTelegram_Requests(t *testing.T) {
+	fake, m := newTestTelegram(t)
+
+	messageID, err := m.SendText(tg_bot.NewMessage(-100123, "Hello\\!"))
+	if err != nil {
+		t.Fatalf("SendText() error = %v", err)
+	}
+	if err := m.Pin(-100123, messageID); err != nil {
+		t.Fatalf("Pin() error = %v", err)
+	}
+	if err := m.React(-100123, 42, "🔥"); err != nil {
+		t.Fatalf("React() error = %v", err)
+	}
+	if _, err := m.SendPhoto(-100123, Photo{Name: "slide.png", Data: []byte("png")}); err != nil {
+		t.Fatalf("SendPhoto() error = %v", err)
+	}
+
+	want := []telegramtest.Request{
+		{Method: "sendMessage", Params: map[string]string{"chat_id": "-100123", "text": "Hello\\!", "parse_mode": "MarkdownV2", "entities": "null"}},
+		{Method: "pinChatMessage", Params: map[string]string{"chat_id": "-100123", "message_id": "1000", "disable_notification": "true"}},
+		{Method: "setMessageReaction", Params: map[string]string{"chat_id": "-100123", "message_id": "42", "reaction": `[{"type":"emoji","emoji":"🔥"}]`}},
+		{Method: "sendPhoto", Params: map[string]string{"chat_id": "-100123", "caption_entities": "null"}, Files: map[string]string{"photo": "slide.png"}},
+	}
+	if got := fake.Requests(); !reflect.DeepEqual(got, want) {
+		t.Errorf("requests = %+v\nwant %+v", got, want)
+	}
+}
+
+func TestTelegram_SendAlbum(t *testing.T) {
+	fake, m := newTestTelegram(t)
+
+	if err := m.SendAlbum(-100123, nil); err == nil {
+		t.Error("SendAlbum() of no photos succeeded")
+	}
+
+	photos := []Photo{{Name: "1.png", Data: []byte("1")}, {Name: "2.png", Data: []byte("2")}}
+	if err := m.SendAlbum(-100123, photos); err != nil {
+		t.Fatalf("SendAlbum() error = %v", err)
+	}
+
+	requests := fake.RequestsTo("sendMediaGroup")
+	if len(requests) != 1 || len(requests[0].Files) != 2 {
+		t.Errorf("SendAlbum() made %+v, want a single media group with both photos", fake.Requests())
+	}
+}
+
+func TestTelegram_SendDocument(t *testing.T) {
+	fake, m := newTestTelegram(t)
+
+	document := Document{Name: "my_poop_log.csv", Reader: strings.NewReader("message_id\n1\n"), Caption: "Your data"}
+	if _, err := m.SendDocument(1001, document); err != nil {
+		t.Fatalf("SendDocument() error = %v", err)
+	}
+
+	want := []telegramtest.Request{{
+		Method: "sendDocument",
+		Params: map[string]string{"chat_id": "1001", "caption": "Your data", "parse_mode": "MarkdownV2"},
+		Files:  map[string]string{"document": "my_poop_log.csv"},
+	}}
+	if got := fake.Requests(); !reflect.DeepEqual(got, want) {
+		t.Errorf("requests = %+v\nwant %+v", got, want)
+	}
+}
+
+func TestTelegram_Errors(t *testing.T) {
+	fake, m := newTestTelegram(t)
+	fake.Fail("setMessageReaction", "REACTION_INVALID")
+
+	failures := metrics.TelegramSendFailures.With("setMessageReaction").Value()
+	if err := m.React(-100123, 42, "🦄"); err == nil {
+		t.Error("React() succeeded although Telegram rejected the reaction")
+	}
+	if got := metrics.TelegramSendFailures.With("setMessageReaction").Value(); got != failures+1 {
+		t.Errorf("send failures = %d, want %d", got, failures+1)
+	}
+}
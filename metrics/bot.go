@@ -0,0 +1,19 @@
+package metrics
+
+// Default holds the bot's metrics, served on /metrics
+var Default = NewRegistry()
+
+// queryBuckets suit SQLite queries on a small database, from half a millisecond to a few seconds
+var queryBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5}
+
+var (
+	UpdatesProcessed = Default.Counter("bot_updates_processed_total", "Updates received from Telegram and handled.")
+	PoopsLogged      = Default.Counter("bot_poops_logged_total", "Poops logged, including forwarded ones backfilled by the admin.")
+	// Commands is labelled with the command name, commands the bot doesn't know count as "unknown"
+	Commands = Default.CounterVec("bot_commands_total", "Commands handled, by command.", "command")
+	// HandlerErrors is labelled with the command name, or the action of an inline button
+	HandlerErrors = Default.CounterVec("bot_handler_errors_total", "Commands and inline button presses whose handler returned an error, by command or button action.", "handler")
+	// TelegramSendFailures is labelled with the Bot API method that failed
+	TelegramSendFailures = Default.CounterVec("bot_telegram_send_failures_total", "Failed requests to send or change something in Telegram, by Bot API method.", "method")
+	QueryDuration        = Default.HistogramVec("bot_repository_query_duration_seconds", "How long repository calls take, by Repository method.", "method", queryBuckets)
+)
@@ -0,0 +1,213 @@
+// Package metrics keeps counters and latency histograms and serves them in the Prometheus text format.
+// It covers only what the bot needs, so it doesn't pull in the Prometheus client.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Counter only goes up
+type Counter struct {
+	value atomic.Uint64
+}
+
+func (c *Counter) Inc() {
+	c.value.Add(1)
+}
+
+func (c *Counter) Value() uint64 {
+	return c.value.Load()
+}
+
+// CounterVec is a counter per value of a single label
+type CounterVec struct {
+	label  string
+	mu     sync.Mutex
+	series map[string]*Counter
+}
+
+// With returns the counter for a label value, creating it on first use
+func (v *CounterVec) With(value string) *Counter {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	counter, ok := v.series[value]
+	if !ok {
+		counter = &Counter{}
+		v.series[value] = counter
+	}
+	return counter
+}
+
+// Histogram counts observations in cumulative buckets
+type Histogram struct {
+	bounds []float64
+	mu     sync.Mutex
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+func newHistogram(bounds []float64) *Histogram {
+	return &Histogram{bounds: bounds, counts: make([]uint64, len(bounds))}
+}
+
+func (h *Histogram) Observe(value float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.count++
+	h.sum += value
+	if i := sort.SearchFloat64s(h.bounds, value); i < len(h.bounds) {
+		h.counts[i]++
+	}
+}
+
+// Count is how many values were observed
+func (h *Histogram) Count() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.count
+}
+
+// HistogramVec is a histogram per value of a single label
+type HistogramVec struct {
+	label  string
+	bounds []float64
+	mu     sync.Mutex
+	series map[string]*Histogram
+}
+
+// With returns the histogram for a label value, creating it on first use
+func (v *HistogramVec) With(value string) *Histogram {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	histogram, ok := v.series[value]
+	if !ok {
+		histogram = newHistogram(v.bounds)
+		v.series[value] = histogram
+	}
+	return histogram
+}
+
+// family is a registered metric with everything it needs to write itself out
+type family struct {
+	name  string
+	help  string
+	kind  string
+	write func(w io.Writer, name string)
+}
+
+// Registry is the set of metrics served together
+type Registry struct {
+	mu       sync.Mutex
+	families []family
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(f family) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, registered := range r.families {
+		if registered.name == f.name {
+			panic(fmt.Sprintf("metric %s is registered twice", f.name))
+		}
+	}
+	r.families = append(r.families, f)
+}
+
+func (r *Registry) Counter(name string, help string) *Counter {
+	counter := &Counter{}
+	r.register(family{name: name, help: help, kind: "counter", write: func(w io.Writer, name string) {
+		fmt.Fprintf(w, "%s %d\n", name, counter.Value())
+	}})
+	return counter
+}
+
+func (r *Registry) CounterVec(name string, help string, label string) *CounterVec {
+	vec := &CounterVec{label: label, series: make(map[string]*Counter)}
+	r.register(family{name: name, help: help, kind: "counter", write: func(w io.Writer, name string) {
+		vec.mu.Lock()
+		defer vec.mu.Unlock()
+		for _, value := range sortedKeys(vec.series) {
+			fmt.Fprintf(w, "%s{%s} %d\n", name, labelPair(label, value), vec.series[value].Value())
+		}
+	}})
+	return vec
+}
+
+// HistogramVec registers a histogram per label value, bounds are the bucket upper bounds in increasing order
+func (r *Registry) HistogramVec(name string, help string, label string, bounds []float64) *HistogramVec {
+	vec := &HistogramVec{label: label, bounds: bounds, series: make(map[string]*Histogram)}
+	r.register(family{name: name, help: help, kind: "histogram", write: func(w io.Writer, name string) {
+		vec.mu.Lock()
+		defer vec.mu.Unlock()
+		for _, value := range sortedKeys(vec.series) {
+			vec.series[value].write(w, name, labelPair(label, value))
+		}
+	}})
+	return vec
+}
+
+func (h *Histogram) write(w io.Writer, name string, labels string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var cumulative uint64
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i]
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", name, labels, formatFloat(bound), cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, h.count)
+	fmt.Fprintf(w, "%s_sum{%s} %s\n", name, labels, formatFloat(h.sum))
+	fmt.Fprintf(w, "%s_count{%s} %d\n", name, labels, h.count)
+}
+
+// WriteText writes every metric in the Prometheus text exposition format
+func (r *Registry) WriteText(w io.Writer) {
+	r.mu.Lock()
+	families := append([]family(nil), r.families...)
+	r.mu.Unlock()
+
+	for _, f := range families {
+		fmt.Fprintf(w, "# HELP %s %s\n", f.name, f.help)
+		fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.kind)
+		f.write(w, f.name)
+	}
+}
+
+// ServeHTTP serves the metrics for Prometheus to scrape
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteText(w)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func labelPair(label string, value string) string {
+	return fmt.Sprintf("%s=\"%s\"", label, labelEscaper.Replace(value))
+}
+
+func formatFloat(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func sortedKeys[V any](series map[string]V) []string {
+	keys := make([]string, 0, len(series))
+	for key := range series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
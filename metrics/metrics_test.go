@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistry_WriteText(t *testing.T) {
+	r := NewRegistry()
+	updates := r.Counter("updates_total", "Updates handled.")
+	commands := r.CounterVec("commands_total", "Commands handled.", "command")
+	queries := r.HistogramVec("query_seconds", "Query latency.", "method", []float64{0.01, 0.1})
+
+	updates.Inc()
+	updates.Inc()
+	commands.With("poodium").Inc()
+	commands.With("leaderboard").Inc()
+	commands.With(`we"ird`).Inc()
+	queries.With("LogPoop").Observe(0.005)
+	queries.With("LogPoop").Observe(0.1)
+	queries.With("LogPoop").Observe(3)
+
+	var out strings.Builder
+	r.WriteText(&out)
+
+	want := `# HELP updates_total Updates handled.
+# TYPE updates_total counter
+updates_total 2
+# HELP commands_total Commands handled.
+# TYPE commands_total counter
+commands_total{command="leaderboard"} 1
+commands_total{command="poodium"} 1
+commands_total{command="we\"ird"} 1
+# HELP query_seconds Query latency.
+# TYPE query_seconds histogram
+query_seconds_bucket{method="LogPoop",le="0.01"} 1
+query_seconds_bucket{method="LogPoop",le="0.1"} 2
+query_seconds_bucket{method="LogPoop",le="+Inf"} 3
+query_seconds_sum{method="LogPoop"} 3.105
+query_seconds_count{method="LogPoop"} 3
+`
+	if got := out.String(); got != want {
+		t.Errorf("WriteText() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRegistry_ServeHTTP(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("updates_total", "Updates handled.").Inc()
+
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	if contentType := recorder.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q, want the Prometheus text format", contentType)
+	}
+	if !strings.Contains(recorder.Body.String(), "updates_total 1\n") {
+		t.Errorf("body = %q, want the counter", recorder.Body.String())
+	}
+}
+
+func TestRegistry_RejectsDuplicateNames(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("updates_total", "Updates handled.")
+
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a metric twice didn't panic")
+		}
+	}()
+	r.CounterVec("updates_total", "Updates handled.", "chat")
+}
@@ -0,0 +1,222 @@
+// Package reactions picks the emoji the bot reacts to a logged poop with.
+package reactions
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultEmoji is used when no rule matches
+const DefaultEmoji = "💩"
+
+// Event describes a logged poop, with everything rules can match on
+type Event struct {
+	StickerID  string // file_unique_id, empty for text messages
+	StickerSet string
+	LocalTime  time.Time // in the poster's timezone
+	DailyCount int       // poops logged on the local day, including this one
+	TotalCount int       // poops the user ever logged in the chat, including this one
+
+	// StickerEmoji is the reaction registered for the sticker, if any
+	StickerEmoji string
+}
+
+// WeightedEmoji is an entry of a random pool, picked with probability weight / total weight
+type WeightedEmoji struct {
+	Emoji  string `json:"emoji"`
+	Weight int    `json:"weight"`
+}
+
+// Rule reacts with Emoji, or a random pick from Pool, when every condition that is set matches.
+// Telegram only accepts a fixed set of reaction emoji, so rules should stick to those.
+type Rule struct {
+	Name     string `json:"name"`
+	Priority int    `json:"priority"`
+
+	StickerIDs    []string `json:"sticker_ids,omitempty"`
+	StickerSets   []string `json:"sticker_sets,omitempty"`
+	Hours         []int    `json:"hours,omitempty"`
+	Weekdays      []string `json:"weekdays,omitempty"`
+	MinDailyCount int      `json:"min_daily_count,omitempty"`
+	MaxDailyCount int      `json:"max_daily_count,omitempty"`
+	Milestones    []int    `json:"milestones,omitempty"`
+
+	Emoji string          `json:"emoji,omitempty"`
+	Pool  []WeightedEmoji `json:"pool,omitempty"`
+}
+
+func (rule Rule) validate() error {
+	if rule.Emoji == "" && len(rule.Pool) == 0 {
+		return fmt.Errorf("rule %q has neither an emoji nor a pool", rule.Name)
+	}
+	if rule.Emoji != "" && len(rule.Pool) > 0 {
+		return fmt.Errorf("rule %q has both an emoji and a pool", rule.Name)
+	}
+	for _, entry := range rule.Pool {
+		if entry.Emoji == "" || entry.Weight <= 0 {
+			return fmt.Errorf("rule %q has a pool entry without an emoji or a positive weight", rule.Name)
+		}
+	}
+	for _, hour := range rule.Hours {
+		if hour < 0 || hour > 23 {
+			return fmt.Errorf("rule %q has invalid hour %d", rule.Name, hour)
+		}
+	}
+	for _, weekday := range rule.Weekdays {
+		if _, ok := parseWeekday(weekday); !ok {
+			return fmt.Errorf("rule %q has invalid weekday %q", rule.Name, weekday)
+		}
+	}
+	if rule.MaxDailyCount > 0 && rule.MaxDailyCount < rule.MinDailyCount {
+		return fmt.Errorf("rule %q has max_daily_count below min_daily_count", rule.Name)
+	}
+	return nil
+}
+
+func (rule Rule) matches(event Event) bool {
+	if len(rule.StickerIDs) > 0 && !contains(rule.StickerIDs, event.StickerID) {
+		return false
+	}
+	if len(rule.StickerSets) > 0 && !contains(rule.StickerSets, event.StickerSet) {
+		return false
+	}
+	if len(rule.Hours) > 0 && !contains(rule.Hours, event.LocalTime.Hour()) {
+		return false
+	}
+	if len(rule.Weekdays) > 0 && !rule.matchesWeekday(event.LocalTime.Weekday()) {
+		return false
+	}
+	if rule.MinDailyCount > 0 && event.DailyCount < rule.MinDailyCount {
+		return false
+	}
+	if rule.MaxDailyCount > 0 && event.DailyCount > rule.MaxDailyCount {
+		return false
+	}
+	if len(rule.Milestones) > 0 && !contains(rule.Milestones, event.TotalCount) {
+		return false
+	}
+	return true
+}
+
+func (rule Rule) matchesWeekday(day time.Weekday) bool {
+	for _, name := range rule.Weekdays {
+		if weekday, _ := parseWeekday(name); weekday == day {
+			return true
+		}
+	}
+	return false
+}
+
+func contains[T comparable](values []T, value T) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// parseWeekday accepts full or three letter English weekday names in any case
+func parseWeekday(name string) (time.Weekday, bool) {
+	name = strings.ToLower(name)
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		full := strings.ToLower(day.String())
+		if name == full || name == full[:3] {
+			return day, true
+		}
+	}
+	return time.Sunday, false
+}
+
+// Engine evaluates rules from the highest priority down and reacts with the first match
+type Engine struct {
+	rules    []Rule
+	fallback string
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+// NewEngine validates the rules and orders them by priority, rules with the same priority keep their order
+func NewEngine(rules []Rule, fallback string, rng *rand.Rand) (*Engine, error) {
+	for _, rule := range rules {
+		if err := rule.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	sorted := make([]Rule, len(rules))
+	copy(sorted, rules)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Priority > sorted[j].Priority
+	})
+
+	if fallback == "" {
+		fallback = DefaultEmoji
+	}
+	if rng == nil {
+		rng = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return &Engine{rules: sorted, fallback: fallback, rng: rng}, nil
+}
+
+// Pick returns the emoji to react to an event with.
+// A registered sticker reaction ranks between the rules with a positive priority, which override it,
+// and the rest, which it overrides whether they match or not, as if it were a rule with priority 0.5.
+func (e *Engine) Pick(event Event) string {
+	for _, rule := range e.rules {
+		if rule.Priority <= 0 && event.StickerEmoji != "" {
+			break
+		}
+		if !rule.matches(event) {
+			continue
+		}
+		if rule.Emoji != "" {
+			return rule.Emoji
+		}
+		return e.pickFromPool(rule.Pool)
+	}
+	if event.StickerEmoji != "" {
+		return event.StickerEmoji
+	}
+	return e.fallback
+}
+
+func (e *Engine) pickFromPool(pool []WeightedEmoji) string {
+	total := 0
+	for _, entry := range pool {
+		total += entry.Weight
+	}
+
+	e.mu.Lock()
+	n := e.rng.Intn(total)
+	e.mu.Unlock()
+
+	for _, entry := range pool {
+		if n < entry.Weight {
+			return entry.Emoji
+		}
+		n -= entry.Weight
+	}
+	return pool[len(pool)-1].Emoji
+}
+
+// LoadRules reads a JSON array of rules from a file
+func LoadRules(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read reaction rules: %w", err)
+	}
+
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse reaction rules: %w", err)
+	}
+	return rules, nil
+}
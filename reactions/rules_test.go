@@ -0,0 +1,181 @@
+package reactions
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// wednesdayNoon is a time no time-based rule in testdata matches
+var wednesdayNoon = time.Date(2025, 3, 5, 12, 0, 0, 0, time.UTC)
+
+func testEngine(t *testing.T) *Engine {
+	t.Helper()
+	rules, err := LoadRules("testdata/rules.json")
+	if err != nil {
+		t.Fatalf("LoadRules() error = %v", err)
+	}
+	engine, err := NewEngine(rules, DefaultEmoji, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatalf("NewEngine() error = %v", err)
+	}
+	return engine
+}
+
+func TestPick(t *testing.T) {
+	engine := testEngine(t)
+
+	tests := []struct {
+		name  string
+		event Event
+		want  string
+	}{
+		{
+			name:  "no rule matches",
+			event: Event{LocalTime: wednesdayNoon, DailyCount: 1, TotalCount: 7},
+			want:  DefaultEmoji,
+		},
+		{
+			name:  "sticker",
+			event: Event{StickerID: "AgADOxkAAgTYWVE", StickerSet: "Poopers2", LocalTime: wednesdayNoon, DailyCount: 1},
+			want:  "😢",
+		},
+		{
+			name:  "sticker from another set",
+			event: Event{StickerID: "AgADOxkAAgTYWVE", StickerSet: "Knockoffs", LocalTime: wednesdayNoon, DailyCount: 1},
+			want:  DefaultEmoji,
+		},
+		{
+			name:  "milestone",
+			event: Event{LocalTime: wednesdayNoon, DailyCount: 1, TotalCount: 500},
+			want:  "🏆",
+		},
+		{
+			name:  "daily count",
+			event: Event{LocalTime: wednesdayNoon, DailyCount: 4},
+			want:  "😱",
+		},
+		{
+			name:  "hour of day",
+			event: Event{LocalTime: time.Date(2025, 3, 5, 3, 0, 0, 0, time.UTC), DailyCount: 1},
+			want:  "🥱",
+		},
+		{
+			name:  "higher priority wins",
+			event: Event{StickerID: "AgADOxkAAgTYWVE", StickerSet: "Poopers2", LocalTime: time.Date(2025, 3, 5, 3, 0, 0, 0, time.UTC), DailyCount: 5, TotalCount: 100},
+			want:  "😢",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := engine.Pick(tt.event); got != tt.want {
+				t.Errorf("Pick() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPick_WeightedPool(t *testing.T) {
+	engine := testEngine(t)
+	saturday := Event{LocalTime: time.Date(2025, 3, 8, 12, 0, 0, 0, time.UTC), DailyCount: 1}
+
+	counts := map[string]int{}
+	for i := 0; i < 4000; i++ {
+		counts[engine.Pick(saturday)]++
+	}
+
+	if len(counts) != 2 {
+		t.Fatalf("Pick() from the weekend pool returned %v, want only 🎉 and 💩", counts)
+	}
+	// 🎉 has a quarter of the weight, allow for some randomness
+	if counts["🎉"] < 850 || counts["🎉"] > 1150 {
+		t.Errorf("Pick() returned 🎉 %d times out of 4000, want about 1000", counts["🎉"])
+	}
+}
+
+func TestNewEngine_InvalidRules(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+	}{
+		{name: "no emoji", rule: Rule{Name: "empty"}},
+		{name: "emoji and pool", rule: Rule{Name: "both", Emoji: "💩", Pool: []WeightedEmoji{{Emoji: "🎉", Weight: 1}}}},
+		{name: "zero weight", rule: Rule{Name: "weightless", Pool: []WeightedEmoji{{Emoji: "🎉"}}}},
+		{name: "invalid hour", rule: Rule{Name: "late", Hours: []int{24}, Emoji: "💩"}},
+		{name: "invalid weekday", rule: Rule{Name: "funday", Weekdays: []string{"Funday"}, Emoji: "💩"}},
+		{name: "inverted daily count", rule: Rule{Name: "never", MinDailyCount: 5, MaxDailyCount: 2, Emoji: "💩"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewEngine([]Rule{tt.rule}, "", nil); err == nil {
+				t.Error("NewEngine() accepted an invalid rule")
+			}
+		})
+	}
+}
+
+func TestPick_StickerEmoji(t *testing.T) {
+	engine := testEngine(t)
+
+	tests := []struct {
+		name  string
+		event Event
+		want  string
+	}{
+		{
+			name:  "registered sticker",
+			event: Event{StickerID: "AgADcxgAAvVG0FE", StickerSet: "Poopers2", StickerEmoji: "🤨", LocalTime: wednesdayNoon, DailyCount: 1},
+			want:  "🤨",
+		},
+		{
+			name:  "beats rules with a negative priority",
+			event: Event{StickerID: "AgADcxgAAvVG0FE", StickerEmoji: "🤨", LocalTime: time.Date(2025, 3, 8, 12, 0, 0, 0, time.UTC), DailyCount: 1},
+			want:  "🤨",
+		},
+		{
+			name:  "loses to rules with a positive priority",
+			event: Event{StickerID: "AgADcxgAAvVG0FE", StickerEmoji: "🤨", LocalTime: wednesdayNoon, DailyCount: 1, TotalCount: 100},
+			want:  "🏆",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := engine.Pick(tt.event); got != tt.want {
+				t.Errorf("Pick() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	noRules, err := NewEngine(nil, "", nil)
+	if err != nil {
+		t.Fatalf("NewEngine() error = %v", err)
+	}
+	if got := noRules.Pick(Event{StickerEmoji: "🫡"}); got != "🫡" {
+		t.Errorf("Pick() without rules = %s, want 🫡", got)
+	}
+
+	// A matching rule with priority 0 still loses to the sticker
+	zero, err := NewEngine([]Rule{{Name: "always", Emoji: "👀"}}, "", nil)
+	if err != nil {
+		t.Fatalf("NewEngine() error = %v", err)
+	}
+	if got := zero.Pick(Event{StickerEmoji: "🫡"}); got != "🫡" {
+		t.Errorf("Pick() with a priority 0 rule = %s, want 🫡", got)
+	}
+	if got := zero.Pick(Event{}); got != "👀" {
+		t.Errorf("Pick() of a text message with a priority 0 rule = %s, want 👀", got)
+	}
+}
+
+func TestLoadRules_Example(t *testing.T) {
+	rules, err := LoadRules("rules.example.json")
+	if err != nil {
+		t.Fatalf("LoadRules() error = %v", err)
+	}
+	if _, err := NewEngine(rules, "", nil); err != nil {
+		t.Errorf("NewEngine() with the example rules error = %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// InactiveUser is a member who hasn't logged a poop in a while
+type InactiveUser struct {
+	UserID       int64
+	Username     string
+	LastPoopUnix int64
+}
+
+// GetInactiveUsers returns the members of a chat whose last poop was before inactiveSince but not before activeSince.
+// Members who opted out of check-ins, or were already checked on since their last poop, are left out.
+func GetInactiveUsers(ctx context.Context, db *sql.DB, chatID int64, inactiveSince int64, activeSince int64) ([]InactiveUser, error) {
+	query := `
+	WITH last_poops AS (
+		-- SQLite takes the bare username from the row holding the maximum
+		SELECT user_id, username, MAX(created_at_unix) AS last_poop_unix
+		FROM poop_log
+		WHERE chat_id = ?
+		GROUP BY user_id
+	)
+	-- Mentions need the current @username, members without one are mentioned by ID alone
+	SELECT lp.user_id, COALESCE(NULLIF(u.username, ''), lp.username), lp.last_poop_unix
+	FROM last_poops lp
+	LEFT JOIN users u ON u.user_id = lp.user_id
+	LEFT JOIN user_settings us ON us.user_id = lp.user_id
+	LEFT JOIN inactivity_checkins ic ON ic.chat_id = ? AND ic.user_id = lp.user_id
+	WHERE lp.last_poop_unix < ? AND lp.last_poop_unix >= ?
+	  AND COALESCE(us.checkins_enabled, 1) = 1
+	  AND (ic.last_poop_unix IS NULL OR ic.last_poop_unix < lp.last_poop_unix)
+	ORDER BY lp.last_poop_unix;
+	`
+	rows, err := db.QueryContext(ctx, query, chatID, chatID, inactiveSince, activeSince)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []InactiveUser
+	for rows.Next() {
+		var user InactiveUser
+		if err := rows.Scan(&user.UserID, &user.Username, &user.LastPoopUnix); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// RecordCheckIn remembers that a member was checked on about the silence after lastPoopUnix
+func RecordCheckIn(ctx context.Context, db *sql.DB, chatID int64, userID int64, lastPoopUnix int64, sentAtUnix int64) error {
+	query := `
+	INSERT INTO inactivity_checkins (chat_id, user_id, last_poop_unix, sent_at_unix)
+	VALUES (?, ?, ?, ?)
+	ON CONFLICT (chat_id, user_id) DO UPDATE SET
+		last_poop_unix = excluded.last_poop_unix,
+		sent_at_unix = excluded.sent_at_unix;
+	`
+	_, err := db.ExecContext(ctx, query, chatID, userID, lastPoopUnix, sentAtUnix)
+	return err
+}
+
+// GetCheckInsEnabled reports whether a user wants to be checked on, which is the default
+func GetCheckInsEnabled(ctx context.Context, db *sql.DB, userID int64) (bool, error) {
+	query := `
+	SELECT checkins_enabled
+	FROM user_settings
+	WHERE user_id = ?;
+	`
+	var enabled bool
+	err := db.QueryRowContext(ctx, query, userID).Scan(&enabled)
+	if errors.Is(err, sql.ErrNoRows) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return enabled, nil
+}
+
+func SetCheckInsEnabled(ctx context.Context, db *sql.DB, userID int64, enabled bool) error {
+	query := `
+	INSERT INTO user_settings (user_id, checkins_enabled)
+	VALUES (?, ?)
+	ON CONFLICT (user_id) DO UPDATE SET checkins_enabled = excluded.checkins_enabled;
+	`
+	_, err := db.ExecContext(ctx, query, userID, enabled)
+	return err
+}
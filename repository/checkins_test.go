@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func inactiveUserIDs(t *testing.T, users []InactiveUser) []int64 {
+	t.Helper()
+	ids := make([]int64, 0, len(users))
+	for _, user := range users {
+		ids = append(ids, user.UserID)
+	}
+	return ids
+}
+
+func TestGetInactiveUsers(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	current := time.Date(2025, 6, 10, 12, 0, 0, 0, time.UTC)
+	inactiveSince := current.Add(-48 * time.Hour).Unix()
+	activeSince := current.Add(-30 * 24 * time.Hour).Unix()
+
+	logPoopAt(t, db, 1001, "alice", 1, current.Add(-72*time.Hour))       // quiet for three days
+	logPoopAt(t, db, 1002, "bob", 2, current.Add(-72*time.Hour))         // quiet, but opted out
+	logPoopAt(t, db, 1003, "charlie", 3, current.Add(-time.Hour))        // active
+	logPoopAt(t, db, 1004, "dave", 4, current.Add(-90*24*time.Hour))     // left long ago
+	logPoopAt(t, db, 1005, "eve", 5, current.Add(-96*time.Hour))         // quiet for four days
+	logPoopAt(t, db, 1005, "eve_renamed", 6, current.Add(-72*time.Hour)) // latest name wins
+
+	if err := SetCheckInsEnabled(ctx, db, 1002, false); err != nil {
+		t.Fatalf("SetCheckInsEnabled() error = %v", err)
+	}
+	// Alice was recorded by an import, which doesn't know @usernames
+	if err := UpsertUser(ctx, db, User{UserID: 1001, FirstName: "Alice"}); err != nil {
+		t.Fatalf("UpsertUser() error = %v", err)
+	}
+
+	users, err := GetInactiveUsers(ctx, db, testChatID, inactiveSince, activeSince)
+	if err != nil {
+		t.Fatalf("GetInactiveUsers() error = %v", err)
+	}
+	if len(users) != 2 || users[0].UserID != 1001 || users[1].UserID != 1005 {
+		t.Fatalf("GetInactiveUsers() = %v, want alice and eve", inactiveUserIDs(t, users))
+	}
+	if users[0].Username != "alice" {
+		t.Errorf("GetInactiveUsers() username = %s, want the one she logged with", users[0].Username)
+	}
+	if users[1].Username != "eve_renamed" {
+		t.Errorf("GetInactiveUsers() username = %s, want eve_renamed", users[1].Username)
+	}
+
+	// Once alice was checked on she isn't asked again for the same silence
+	if err := RecordCheckIn(ctx, db, testChatID, 1001, users[0].LastPoopUnix, current.Unix()); err != nil {
+		t.Fatalf("RecordCheckIn() error = %v", err)
+	}
+	users, err = GetInactiveUsers(ctx, db, testChatID, inactiveSince, activeSince)
+	if err != nil {
+		t.Fatalf("GetInactiveUsers() error = %v", err)
+	}
+	if len(users) != 1 || users[0].UserID != 1005 {
+		t.Errorf("GetInactiveUsers() after check-in = %v, want only eve", inactiveUserIDs(t, users))
+	}
+
+	// After logging again and going quiet for another two days, she's asked again
+	logPoopAt(t, db, 1001, "alice", 7, current.Add(-50*time.Hour))
+	users, err = GetInactiveUsers(ctx, db, testChatID, inactiveSince, activeSince)
+	if err != nil {
+		t.Fatalf("GetInactiveUsers() error = %v", err)
+	}
+	if len(users) != 2 || users[0].UserID != 1005 || users[1].UserID != 1001 {
+		t.Errorf("GetInactiveUsers() after a new silence = %v, want eve and alice", inactiveUserIDs(t, users))
+	}
+
+	// Other chats are checked separately
+	users, err = GetInactiveUsers(ctx, db, testChatID-1, inactiveSince, activeSince)
+	if err != nil {
+		t.Fatalf("GetInactiveUsers() error = %v", err)
+	}
+	if len(users) != 0 {
+		t.Errorf("GetInactiveUsers() of another chat = %v, want none", inactiveUserIDs(t, users))
+	}
+}
+
+func TestCheckInsEnabled(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	enabled, err := GetCheckInsEnabled(ctx, db, 1001)
+	if err != nil {
+		t.Fatalf("GetCheckInsEnabled() error = %v", err)
+	}
+	if !enabled {
+		t.Error("GetCheckInsEnabled() = false for a new user, want true")
+	}
+
+	if err := SetUserTimezone(ctx, db, 1001, "Europe/Lisbon"); err != nil {
+		t.Fatalf("SetUserTimezone() error = %v", err)
+	}
+	if err := SetCheckInsEnabled(ctx, db, 1001, false); err != nil {
+		t.Fatalf("SetCheckInsEnabled() error = %v", err)
+	}
+
+	enabled, err = GetCheckInsEnabled(ctx, db, 1001)
+	if err != nil {
+		t.Fatalf("GetCheckInsEnabled() error = %v", err)
+	}
+	if enabled {
+		t.Error("GetCheckInsEnabled() = true after opting out, want false")
+	}
+
+	// Opting out leaves the other settings alone
+	timezone, err := GetUserTimezone(ctx, db, 1001)
+	if err != nil {
+		t.Fatalf("GetUserTimezone() error = %v", err)
+	}
+	if timezone != "Europe/Lisbon" {
+		t.Errorf("GetUserTimezone() = %q after opting out, want Europe/Lisbon", timezone)
+	}
+}
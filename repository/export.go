@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// ExportedPoop is a log as it appears in a member's data export, deleted logs included
+type ExportedPoop struct {
+	MessageID int64
+	Username  string
+	// LocalTime is in the timezone the log is bucketed in, Timezone
+	LocalTime time.Time
+	Timezone  string
+	// DeletedAt is zero for logs that weren't deleted
+	DeletedAt time.Time
+	DeletedBy int64
+}
+
+// StreamUserPoops calls fn for every log of a user in a chat, oldest first, without loading them all into memory.
+// Iteration stops at the first error fn returns.
+func StreamUserPoops(ctx context.Context, db *sql.DB, chatID int64, userID int64, fn func(ExportedPoop) error) error {
+	query := `
+	SELECT p.message_id, COALESCE(p.username, ''), p.created_at_unix,
+		COALESCE(us.timezone, g.timezone, 'UTC'), p.deleted_at_unix, p.deleted_by
+	FROM poop_tracker p
+	LEFT JOIN groups g ON g.chat_id = p.chat_id
+	LEFT JOIN user_settings us ON us.user_id = p.user_id
+	WHERE p.chat_id = ? AND p.user_id = ?
+	ORDER BY p.created_at_unix, p.id;
+	`
+	rows, err := db.QueryContext(ctx, query, chatID, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var poop ExportedPoop
+		var createdAtUnix int64
+		var deletedAtUnix, deletedBy sql.NullInt64
+		if err := rows.Scan(&poop.MessageID, &poop.Username, &createdAtUnix, &poop.Timezone, &deletedAtUnix, &deletedBy); err != nil {
+			return err
+		}
+
+		loc := loadLocation(poop.Timezone)
+		poop.LocalTime = time.Unix(createdAtUnix, 0).In(loc)
+		if deletedAtUnix.Valid {
+			poop.DeletedAt = time.Unix(deletedAtUnix.Int64, 0).In(loc)
+			poop.DeletedBy = deletedBy.Int64
+		}
+
+		if err := fn(poop); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStreamUserPoops(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	if err := RegisterGroup(ctx, db, testChatID, "Poopers", "Europe/Lisbon"); err != nil {
+		t.Fatalf("RegisterGroup() error = %v", err)
+	}
+
+	logPoopAt(t, db, 1001, "alice", 2, time.Date(2025, 7, 1, 23, 30, 0, 0, time.UTC))
+	logPoopAt(t, db, 1001, "alice", 1, time.Date(2025, 1, 1, 8, 0, 0, 0, time.UTC))
+	logPoopAt(t, db, 1001, "alice", 3, time.Date(2025, 7, 2, 9, 0, 0, 0, time.UTC))
+	logPoopAt(t, db, 1002, "bob", 4, time.Date(2025, 7, 2, 9, 0, 0, 0, time.UTC))
+	if err := DeletePoop(ctx, db, testChatID, 3, 1001, time.Date(2025, 7, 2, 10, 0, 0, 0, time.UTC).Unix()); err != nil {
+		t.Fatalf("DeletePoop() error = %v", err)
+	}
+
+	var poops []ExportedPoop
+	err := StreamUserPoops(ctx, db, testChatID, 1001, func(poop ExportedPoop) error {
+		poops = append(poops, poop)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamUserPoops() error = %v", err)
+	}
+
+	// Oldest first, in the group's timezone, with deleted logs included
+	wantTimes := []string{"2025-01-01T08:00:00Z", "2025-07-02T00:30:00+01:00", "2025-07-02T10:00:00+01:00"}
+	if len(poops) != len(wantTimes) {
+		t.Fatalf("StreamUserPoops() streamed %d logs, want %d", len(poops), len(wantTimes))
+	}
+	for i, want := range wantTimes {
+		if got := poops[i].LocalTime.Format(time.RFC3339); got != want {
+			t.Errorf("log %d local time = %s, want %s", i, got, want)
+		}
+		if poops[i].Timezone != "Europe/Lisbon" {
+			t.Errorf("log %d timezone = %s, want Europe/Lisbon", i, poops[i].Timezone)
+		}
+	}
+	if !poops[0].DeletedAt.IsZero() || poops[2].DeletedAt.Hour() != 11 || poops[2].DeletedBy != 1001 {
+		t.Errorf("deletions = %+v, want only the last log deleted by alice at 11:00 in Lisbon", poops)
+	}
+
+	// An error from the callback stops the stream
+	stop := errors.New("stop")
+	calls := 0
+	err = StreamUserPoops(ctx, db, testChatID, 1001, func(ExportedPoop) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Errorf("StreamUserPoops() with a failing callback = %v after %d calls, want stop after 1", err, calls)
+	}
+}
@@ -0,0 +1,225 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrPendingBackfillNotFound is returned for forwards that aren't waiting for a sender, or were already resolved
+var ErrPendingBackfillNotFound = errors.New("pending backfill not found")
+
+// ForwardedPoop is a poop the admin forwarded to be logged in a group.
+// The origin is the message it was forwarded from, zero when Telegram doesn't reveal it.
+type ForwardedPoop struct {
+	ChatID           int64
+	UserID           int64
+	Username         string
+	SentAtUnix       int64
+	ForwardMessageID int64
+	OriginChatID     int64
+	OriginMessageID  int64
+}
+
+// PendingBackfill is a forwarded poop whose sender the admin still has to pick
+type PendingBackfill struct {
+	ForwardMessageID int64
+	ChatID           int64
+	SenderName       string
+	SentAtUnix       int64
+	OriginChatID     int64
+	OriginMessageID  int64
+}
+
+func nullableID(id int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: id, Valid: id != 0}
+}
+
+// reconcileForwardedPoop gives a log backfilled from a forward of unknown origin the ID of the group message it was
+// forwarded from, once that message turns up. Telegram doesn't say which message a member's post was, so the log is
+// matched by its sender and the second it was sent. It reports whether there was such a log.
+func reconcileForwardedPoop(ctx context.Context, db *sql.DB, chatID int64, userID int64, messageID int64, sentAtUnix int64) (bool, error) {
+	query := `
+	UPDATE poop_tracker
+	SET message_id = ?
+	WHERE id = (
+		SELECT id FROM poop_tracker
+		WHERE chat_id = ? AND user_id = ? AND created_at_unix = ? AND message_id < 0
+		ORDER BY id
+		LIMIT 1
+	)
+	AND NOT EXISTS (SELECT 1 FROM poop_tracker WHERE chat_id = ? AND message_id = ?);
+	`
+	result, err := db.ExecContext(ctx, query, messageID, chatID, userID, sentAtUnix, chatID, messageID)
+	if err != nil {
+		return false, err
+	}
+
+	reconciled, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return reconciled > 0, nil
+}
+
+// IsForwardLogged reports whether a forward of unknown origin by the user at that second was backfilled, a log
+// LogPoop gives the message's ID instead of logging the message again
+func IsForwardLogged(ctx context.Context, db *sql.DB, chatID int64, userID int64, sentAtUnix int64) (bool, error) {
+	query := `
+	SELECT EXISTS (
+		SELECT 1 FROM poop_tracker
+		WHERE chat_id = ? AND user_id = ? AND created_at_unix = ? AND message_id < 0
+	);
+	`
+	var logged bool
+	err := db.QueryRowContext(ctx, query, chatID, userID, sentAtUnix).Scan(&logged)
+	return logged, err
+}
+
+// LogForwardedPoop logs a forwarded poop in its group, returning ErrPoopAlreadyLogged when it is already there.
+// A message forwarded from the group itself is logged under its own ID, so it can't be logged twice with the live bot or an import.
+// Otherwise a log by the same user at the same second, or from the same origin message, counts as the same poop.
+func LogForwardedPoop(ctx context.Context, db *sql.DB, poop ForwardedPoop) error {
+	// Messages whose origin is unknown get a negative ID, which never clashes with real message IDs.
+	// Their log takes the real ID when the message is logged by the live bot, an import or a forward that reveals it.
+	messageID := -poop.ForwardMessageID
+	if poop.OriginChatID == poop.ChatID && poop.OriginMessageID != 0 {
+		messageID = poop.OriginMessageID
+
+		reconciled, err := reconcileForwardedPoop(ctx, db, poop.ChatID, poop.UserID, messageID, poop.SentAtUnix)
+		if err != nil {
+			return err
+		}
+		if reconciled {
+			return ErrPoopAlreadyLogged
+		}
+	}
+	originChatID, originMessageID := nullableID(poop.OriginChatID), nullableID(poop.OriginMessageID)
+	sentAt := time.Unix(poop.SentAtUnix, 0).UTC()
+
+	query := `
+	INSERT INTO poop_tracker (chat_id, user_id, username, message_id, timestamp, created_at_unix, origin_chat_id, origin_message_id)
+	SELECT ?, ?, ?, ?, ?, ?, ?, ?
+	WHERE NOT EXISTS (
+		SELECT 1 FROM poop_tracker
+		WHERE chat_id = ?
+		  AND ((user_id = ? AND created_at_unix = ?)
+		       OR (origin_chat_id = ? AND origin_message_id = ?))
+	)
+	ON CONFLICT (chat_id, message_id) DO NOTHING;
+	`
+	result, err := db.ExecContext(ctx, query,
+		poop.ChatID, poop.UserID, poop.Username, messageID, sentAt.Format(sqliteTimeLayout), poop.SentAtUnix, originChatID, originMessageID,
+		poop.ChatID, poop.UserID, poop.SentAtUnix, originChatID, originMessageID)
+	if err != nil {
+		return err
+	}
+
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if inserted == 0 {
+		return ErrPoopAlreadyLogged
+	}
+	return nil
+}
+
+// SavePendingBackfill remembers a forward until the admin picks its sender
+func SavePendingBackfill(ctx context.Context, db *sql.DB, pending PendingBackfill, createdAtUnix int64) error {
+	query := `
+	INSERT INTO pending_backfills (forward_message_id, chat_id, sender_name, sent_at_unix, origin_chat_id, origin_message_id, created_at_unix)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT (forward_message_id) DO NOTHING;
+	`
+	_, err := db.ExecContext(ctx, query, pending.ForwardMessageID, pending.ChatID, pending.SenderName, pending.SentAtUnix,
+		nullableID(pending.OriginChatID), nullableID(pending.OriginMessageID), createdAtUnix)
+	return err
+}
+
+// TakePendingBackfill removes and returns a pending forward, so each one is resolved only once
+func TakePendingBackfill(ctx context.Context, db *sql.DB, forwardMessageID int64) (PendingBackfill, error) {
+	query := `
+	DELETE FROM pending_backfills
+	WHERE forward_message_id = ?
+	RETURNING forward_message_id, chat_id, sender_name, sent_at_unix, origin_chat_id, origin_message_id;
+	`
+	var pending PendingBackfill
+	var originChatID, originMessageID sql.NullInt64
+	err := db.QueryRowContext(ctx, query, forwardMessageID).Scan(&pending.ForwardMessageID, &pending.ChatID, &pending.SenderName,
+		&pending.SentAtUnix, &originChatID, &originMessageID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return PendingBackfill{}, ErrPendingBackfillNotFound
+	}
+	if err != nil {
+		return PendingBackfill{}, err
+	}
+	pending.OriginChatID = originChatID.Int64
+	pending.OriginMessageID = originMessageID.Int64
+	return pending, nil
+}
+
+// GetRecentMembers returns the members who logged in a chat, most recently active first
+func GetRecentMembers(ctx context.Context, db *sql.DB, chatID int64, limit int) ([]User, error) {
+	query := `
+	SELECT p.user_id, COALESCE(NULLIF(u.username, ''), p.username), COALESCE(u.first_name, ''), COALESCE(u.last_name, ''), MAX(p.created_at_unix)
+	FROM poop_log p
+	LEFT JOIN users u ON u.user_id = p.user_id
+	WHERE p.chat_id = ?
+	GROUP BY p.user_id
+	ORDER BY MAX(p.created_at_unix) DESC
+	LIMIT ?;
+	`
+	rows, err := db.QueryContext(ctx, query, chatID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []User
+	for rows.Next() {
+		var member User
+		if err := rows.Scan(&member.UserID, &member.Username, &member.FirstName, &member.LastName, &member.LastSeenUnix); err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// FindMembersByName returns the members of a chat whose full name, as Telegram shows it on hidden forwards, is name
+func FindMembersByName(ctx context.Context, db *sql.DB, chatID int64, name string) ([]User, error) {
+	query := `
+	SELECT u.user_id, u.username, u.first_name, u.last_name, u.last_seen_unix
+	FROM users u
+	WHERE TRIM(u.first_name || ' ' || u.last_name) = ?
+	  AND EXISTS (SELECT 1 FROM poop_log p WHERE p.chat_id = ? AND p.user_id = u.user_id)
+	ORDER BY u.user_id;
+	`
+	rows, err := db.QueryContext(ctx, query, name, chatID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []User
+	for rows.Next() {
+		var member User
+		if err := rows.Scan(&member.UserID, &member.Username, &member.FirstName, &member.LastName, &member.LastSeenUnix); err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
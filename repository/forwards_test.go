@@ -0,0 +1,179 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLogForwardedPoop(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	postedAt := time.Date(2025, 3, 1, 9, 30, 0, 0, time.UTC)
+	logPoopAt(t, db, 1001, "alice", 10, postedAt)
+
+	// Forwarding a poop the bot already logged in the group doesn't log it again
+	forwarded := ForwardedPoop{ChatID: testChatID, UserID: 1001, Username: "alice", SentAtUnix: postedAt.Unix(), ForwardMessageID: 5}
+	if err := LogForwardedPoop(ctx, db, forwarded); !errors.Is(err, ErrPoopAlreadyLogged) {
+		t.Errorf("LogForwardedPoop() of a logged poop error = %v, want ErrPoopAlreadyLogged", err)
+	}
+
+	missed := ForwardedPoop{ChatID: testChatID, UserID: 1001, Username: "alice", SentAtUnix: postedAt.Add(time.Hour).Unix(), ForwardMessageID: 6}
+	if err := LogForwardedPoop(ctx, db, missed); err != nil {
+		t.Fatalf("LogForwardedPoop() error = %v", err)
+	}
+	if _, err := GetPoopByMessageID(ctx, db, testChatID, -6); err != nil {
+		t.Errorf("A forward of unknown origin isn't logged under its negated ID: %v", err)
+	}
+	missed.ForwardMessageID = 7
+	if err := LogForwardedPoop(ctx, db, missed); !errors.Is(err, ErrPoopAlreadyLogged) {
+		t.Errorf("LogForwardedPoop() forwarded twice error = %v, want ErrPoopAlreadyLogged", err)
+	}
+
+	// Posts from the same origin are duplicates even when attributed to someone else
+	channelPost := ForwardedPoop{ChatID: testChatID, UserID: 1002, Username: "bob", SentAtUnix: postedAt.Unix(), ForwardMessageID: 8,
+		OriginChatID: -100999, OriginMessageID: 77}
+	if err := LogForwardedPoop(ctx, db, channelPost); err != nil {
+		t.Fatalf("LogForwardedPoop() of a channel post error = %v", err)
+	}
+	channelPost.UserID, channelPost.ForwardMessageID = 1003, 9
+	if err := LogForwardedPoop(ctx, db, channelPost); !errors.Is(err, ErrPoopAlreadyLogged) {
+		t.Errorf("LogForwardedPoop() of the same channel post error = %v, want ErrPoopAlreadyLogged", err)
+	}
+
+	// A message forwarded from the group itself is logged under its own ID
+	groupMessage := ForwardedPoop{ChatID: testChatID, UserID: 1002, Username: "bob", SentAtUnix: postedAt.Add(2 * time.Hour).Unix(), ForwardMessageID: 11,
+		OriginChatID: testChatID, OriginMessageID: 55}
+	if err := LogForwardedPoop(ctx, db, groupMessage); err != nil {
+		t.Fatalf("LogForwardedPoop() of a group message error = %v", err)
+	}
+	if logged, err := IsPoopLogged(ctx, db, testChatID, 55); err != nil || !logged {
+		t.Errorf("IsPoopLogged() of the origin message = %v, %v, want true", logged, err)
+	}
+}
+
+func TestLogForwardedPoop_Reconciles(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	postedAt := time.Date(2025, 3, 1, 9, 30, 0, 0, time.UTC)
+
+	forwarded := ForwardedPoop{ChatID: testChatID, UserID: 1001, Username: "alice", SentAtUnix: postedAt.Unix(), ForwardMessageID: 5}
+	if err := LogForwardedPoop(ctx, db, forwarded); err != nil {
+		t.Fatalf("LogForwardedPoop() error = %v", err)
+	}
+	if logged, err := IsForwardLogged(ctx, db, testChatID, 1001, postedAt.Unix()); err != nil || !logged {
+		t.Errorf("IsForwardLogged() before reconciling = %v, %v, want true", logged, err)
+	}
+
+	// The message the forward came from turns up in an import, its log takes the message's ID
+	err := LogPoop(ctx, db, testChatID, 1001, "alice", 40, postedAt.Format(sqliteTimeLayout), postedAt.Unix())
+	if !errors.Is(err, ErrPoopAlreadyLogged) {
+		t.Errorf("LogPoop() of a forwarded message error = %v, want ErrPoopAlreadyLogged", err)
+	}
+	if logged, err := IsPoopLogged(ctx, db, testChatID, 40); err != nil || !logged {
+		t.Errorf("IsPoopLogged() of the forwarded message = %v, %v, want true", logged, err)
+	}
+	if logged, err := IsPoopLogged(ctx, db, testChatID, -5); err != nil || logged {
+		t.Errorf("IsPoopLogged() of the forward = %v, %v, want its log moved to the message", logged, err)
+	}
+	if logged, err := IsForwardLogged(ctx, db, testChatID, 1001, postedAt.Unix()); err != nil || logged {
+		t.Errorf("IsForwardLogged() after reconciling = %v, %v, want false", logged, err)
+	}
+	if count, err := GetGlobalPoopCount(ctx, db, testChatID, 1001); err != nil || count != 1 {
+		t.Errorf("GetGlobalPoopCount() = %d, %v, want 1", count, err)
+	}
+
+	// Another message in the same second is a poop of its own
+	if err := LogPoop(ctx, db, testChatID, 1001, "alice", 41, postedAt.Format(sqliteTimeLayout), postedAt.Unix()); err != nil {
+		t.Errorf("LogPoop() of another message error = %v", err)
+	}
+
+	// So is a forward from the group that reveals its message
+	forwarded = ForwardedPoop{ChatID: testChatID, UserID: 1002, Username: "bob", SentAtUnix: postedAt.Add(time.Hour).Unix(), ForwardMessageID: 6}
+	if err := LogForwardedPoop(ctx, db, forwarded); err != nil {
+		t.Fatalf("LogForwardedPoop() error = %v", err)
+	}
+	forwarded.ForwardMessageID, forwarded.OriginChatID, forwarded.OriginMessageID = 7, testChatID, 50
+	if err := LogForwardedPoop(ctx, db, forwarded); !errors.Is(err, ErrPoopAlreadyLogged) {
+		t.Errorf("LogForwardedPoop() of the same message from the group error = %v, want ErrPoopAlreadyLogged", err)
+	}
+	if logged, err := IsPoopLogged(ctx, db, testChatID, 50); err != nil || !logged {
+		t.Errorf("IsPoopLogged() of the group message = %v, %v, want true", logged, err)
+	}
+}
+
+func TestPendingBackfills(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	if _, err := TakePendingBackfill(ctx, db, 5); !errors.Is(err, ErrPendingBackfillNotFound) {
+		t.Errorf("TakePendingBackfill() of an unknown forward error = %v, want ErrPendingBackfillNotFound", err)
+	}
+
+	pending := PendingBackfill{ForwardMessageID: 5, ChatID: testChatID, SenderName: "Alice L", SentAtUnix: 1740821400}
+	if err := SavePendingBackfill(ctx, db, pending, 1740900000); err != nil {
+		t.Fatalf("SavePendingBackfill() error = %v", err)
+	}
+
+	taken, err := TakePendingBackfill(ctx, db, 5)
+	if err != nil {
+		t.Fatalf("TakePendingBackfill() error = %v", err)
+	}
+	if taken != pending {
+		t.Errorf("TakePendingBackfill() = %+v, want %+v", taken, pending)
+	}
+	if _, err := TakePendingBackfill(ctx, db, 5); !errors.Is(err, ErrPendingBackfillNotFound) {
+		t.Errorf("TakePendingBackfill() twice error = %v, want ErrPendingBackfillNotFound", err)
+	}
+}
+
+func TestFindMembers(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	at := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	for _, user := range []User{
+		{UserID: 1001, Username: "alice", FirstName: "Alice", LastName: "Liddell", LastSeenUnix: at.Unix()},
+		{UserID: 1002, FirstName: "Bob", LastSeenUnix: at.Unix()},
+		{UserID: 1003, Username: "carol", FirstName: "Alice", LastName: "Liddell", LastSeenUnix: at.Unix()},
+		// Dave was recorded by an import, which doesn't know @usernames
+		{UserID: 1004, FirstName: "Dave"},
+	} {
+		if err := UpsertUser(ctx, db, user); err != nil {
+			t.Fatalf("UpsertUser() error = %v", err)
+		}
+	}
+	logPoopAt(t, db, 1001, "alice", 1, at)
+	logPoopAt(t, db, 1002, "", 2, at.Add(time.Hour))
+	logPoopAt(t, db, 1004, "dave", 3, at.Add(-time.Hour))
+
+	members, err := GetRecentMembers(ctx, db, testChatID, 10)
+	if err != nil {
+		t.Fatalf("GetRecentMembers() error = %v", err)
+	}
+	if len(members) != 3 || members[0].UserID != 1002 || members[1].UserID != 1001 || members[2].UserID != 1004 {
+		t.Fatalf("GetRecentMembers() = %+v, want bob, alice then dave", members)
+	}
+	if members[2].Username != "dave" {
+		t.Errorf("GetRecentMembers() username of dave = %q, want the one he logged with", members[2].Username)
+	}
+
+	// Carol shares the name but never logged in the group
+	found, err := FindMembersByName(ctx, db, testChatID, "Alice Liddell")
+	if err != nil {
+		t.Fatalf("FindMembersByName() error = %v", err)
+	}
+	if len(found) != 1 || found[0].UserID != 1001 {
+		t.Errorf("FindMembersByName() = %+v, want only alice", found)
+	}
+	if found, err := FindMembersByName(ctx, db, testChatID, "Bob"); err != nil || len(found) != 1 {
+		t.Errorf("FindMembersByName() without a last name = %+v, %v, want bob", found, err)
+	}
+}
@@ -3,27 +3,64 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"time"
+
+	"src/metrics"
 )
 
 type Repository interface {
-	LogPoop(ctx context.Context, userID int64, username string, msgId int64, timestamp string, unixTimestamp int64) error
-	GetGlobalPoopCount(ctx context.Context, userID int64) (int, error)
-	GetMonthlyPoopCount(ctx context.Context, userID int64) (int, error)
-	GetMonthlyPoopStats(ctx context.Context, userID int64) ([]MonthlyPoopCount, error)
-	GetDaysWithoutPoop(ctx context.Context, userID int64) (int, error)
-	GetMaxPoopStreak(ctx context.Context, userID int64) (int, error)
-	GetDayWithMostPoops(ctx context.Context, userID int64) (string, int, error)
-	GetMonthlyLeaderboard(ctx context.Context) ([]UserPoopCount, error)
-	GetBottomPoopers(ctx context.Context) ([]UserPoopCount, error)
-	GetMonthlyPoodium(ctx context.Context) ([]UserPoopCount, error)
-	GetPastMonthPoodium(ctx context.Context) ([]UserPoopCount, error)
-	GetYearlyPoodium(ctx context.Context) ([]UserPoopCount, error)
-	GetYearlyPoopCount(ctx context.Context, userID int64, year int) (int, error)
-	GetPoopsByHour(ctx context.Context, userID int64, year int) ([]HourDistribution, error)
-	GetPoopsByDayOfWeek(ctx context.Context, userID int64, year int) ([]DayOfWeekDistribution, error)
-	GetYearlyRanking(ctx context.Context, userID int64, year int) (YearlyRanking, error)
-	GetGroupYearlyStats(ctx context.Context, year int) ([]UserPoopCount, error)
-	GetGroupAwards(ctx context.Context, year int) ([]GroupAward, error)
+	LogPoop(ctx context.Context, chatID int64, userID int64, username string, msgId int64, timestamp string, unixTimestamp int64) error
+	GetLatestPoop(ctx context.Context, chatID int64, userID int64) (PoopLog, error)
+	GetPoopByMessageID(ctx context.Context, chatID int64, messageID int64) (PoopLog, error)
+	DeletePoop(ctx context.Context, chatID int64, messageID int64, deletedBy int64, deletedAtUnix int64) error
+	GetGlobalPoopCount(ctx context.Context, chatID int64, userID int64) (int, error)
+	GetMonthlyPoopCount(ctx context.Context, chatID int64, userID int64, at time.Time) (int, error)
+	GetMonthlyPoopStats(ctx context.Context, chatID int64, userID int64) ([]MonthlyPoopCount, error)
+	GetDaysWithoutPoop(ctx context.Context, chatID int64, userID int64, at time.Time) (int, error)
+	GetMaxPoopStreak(ctx context.Context, chatID int64, userID int64) (int, error)
+	GetDayWithMostPoops(ctx context.Context, chatID int64, userID int64) (string, int, error)
+	GetYearlyDaysWithoutPoop(ctx context.Context, chatID int64, userID int64, year int, at time.Time) (int, error)
+	GetYearlyLongestStreak(ctx context.Context, chatID int64, userID int64, year int) (int, error)
+	GetYearlyDayWithMostPoops(ctx context.Context, chatID int64, userID int64, year int) (string, int, error)
+	GetLeaderboard(ctx context.Context, chatID int64, period Period, order Order, limit int) ([]UserPoopCount, error)
+	GetPeriodChanges(ctx context.Context, chatID int64, period Period, previous Period) ([]PeriodChange, error)
+	GetYearlyPoopCount(ctx context.Context, chatID int64, userID int64, year int) (int, error)
+	GetPoopsByHour(ctx context.Context, chatID int64, userID int64, year int) ([]HourDistribution, error)
+	GetPoopsByDayOfWeek(ctx context.Context, chatID int64, userID int64, year int) ([]DayOfWeekDistribution, error)
+	GetYearlyRanking(ctx context.Context, chatID int64, userID int64, year int) (YearlyRanking, error)
+	GetGroupYearlyStats(ctx context.Context, chatID int64, year int) ([]UserPoopCount, error)
+	GetGroupAwards(ctx context.Context, chatID int64, year int) ([]GroupAward, error)
+	RegisterGroup(ctx context.Context, chatID int64, title string, timezone string) error
+	IsRegisteredGroup(ctx context.Context, chatID int64) (bool, error)
+	GetGroups(ctx context.Context) ([]Group, error)
+	ClaimUnscopedLogs(ctx context.Context, chatID int64) (int64, error)
+	GetGroupTimezone(ctx context.Context, chatID int64) (string, error)
+	SetGroupTimezone(ctx context.Context, chatID int64, timezone string) error
+	GetUserTimezone(ctx context.Context, userID int64) (string, error)
+	SetUserTimezone(ctx context.Context, userID int64, timezone string) error
+	GetInactiveUsers(ctx context.Context, chatID int64, inactiveSince int64, activeSince int64) ([]InactiveUser, error)
+	RecordCheckIn(ctx context.Context, chatID int64, userID int64, lastPoopUnix int64, sentAtUnix int64) error
+	GetCheckInsEnabled(ctx context.Context, userID int64) (bool, error)
+	SetCheckInsEnabled(ctx context.Context, userID int64, enabled bool) error
+	GetLocalDayPoopCount(ctx context.Context, chatID int64, userID int64, at time.Time) (string, int, error)
+	ClaimWellnessAlert(ctx context.Context, chatID int64, userID int64, day string, level int, sentAtUnix int64) (bool, error)
+	RegisterSticker(ctx context.Context, sticker Sticker, registeredBy int64, registeredAtUnix int64) error
+	GetStickerEmoji(ctx context.Context, fileUniqueID string) (string, error)
+	GetStickers(ctx context.Context) ([]Sticker, error)
+	UpsertUser(ctx context.Context, user User) error
+	GetUser(ctx context.Context, userID int64) (User, error)
+	IsPoopLogged(ctx context.Context, chatID int64, messageID int64) (bool, error)
+	IsForwardLogged(ctx context.Context, chatID int64, userID int64, sentAtUnix int64) (bool, error)
+	LogForwardedPoop(ctx context.Context, poop ForwardedPoop) error
+	SavePendingBackfill(ctx context.Context, pending PendingBackfill, createdAtUnix int64) error
+	TakePendingBackfill(ctx context.Context, forwardMessageID int64) (PendingBackfill, error)
+	GetRecentMembers(ctx context.Context, chatID int64, limit int) ([]User, error)
+	FindMembersByName(ctx context.Context, chatID int64, name string) ([]User, error)
+	StreamUserPoops(ctx context.Context, chatID int64, userID int64, fn func(ExportedPoop) error) error
+	GetLastScheduledRun(ctx context.Context, job string) (int64, error)
+	RecordScheduledRun(ctx context.Context, job string, scheduledAtUnix int64, finishedAtUnix int64) error
+	ClaimScheduledPost(ctx context.Context, job string, chatID int64, period string, sentAtUnix int64) (bool, error)
+	ReleaseScheduledPost(ctx context.Context, job string, chatID int64, period string) error
 	HealthCheck(ctx context.Context) error
 }
 
@@ -35,78 +72,272 @@ func NewSQLiteRepository(db *sql.DB) Repository {
 	return &SQLiteRepository{db: db}
 }
 
-func (r *SQLiteRepository) LogPoop(ctx context.Context, userID int64, username string, msgId int64, timestamp string, unixTimestamp int64) error {
-	return LogPoop(ctx, r.db, userID, username, msgId, timestamp, unixTimestamp)
+// observeQuery records how long a Repository method took, methods defer it with the time they started
+func observeQuery(method string, start time.Time) {
+	metrics.QueryDuration.With(method).Observe(time.Since(start).Seconds())
+}
+
+func (r *SQLiteRepository) LogPoop(ctx context.Context, chatID int64, userID int64, username string, msgId int64, timestamp string, unixTimestamp int64) error {
+	defer observeQuery("LogPoop", time.Now())
+	return LogPoop(ctx, r.db, chatID, userID, username, msgId, timestamp, unixTimestamp)
+}
+
+func (r *SQLiteRepository) GetLatestPoop(ctx context.Context, chatID int64, userID int64) (PoopLog, error) {
+	defer observeQuery("GetLatestPoop", time.Now())
+	return GetLatestPoop(ctx, r.db, chatID, userID)
+}
+
+func (r *SQLiteRepository) GetPoopByMessageID(ctx context.Context, chatID int64, messageID int64) (PoopLog, error) {
+	defer observeQuery("GetPoopByMessageID", time.Now())
+	return GetPoopByMessageID(ctx, r.db, chatID, messageID)
+}
+
+func (r *SQLiteRepository) DeletePoop(ctx context.Context, chatID int64, messageID int64, deletedBy int64, deletedAtUnix int64) error {
+	defer observeQuery("DeletePoop", time.Now())
+	return DeletePoop(ctx, r.db, chatID, messageID, deletedBy, deletedAtUnix)
+}
+
+func (r *SQLiteRepository) GetGlobalPoopCount(ctx context.Context, chatID int64, userID int64) (int, error) {
+	defer observeQuery("GetGlobalPoopCount", time.Now())
+	return GetGlobalPoopCount(ctx, r.db, chatID, userID)
+}
+
+func (r *SQLiteRepository) GetMonthlyPoopCount(ctx context.Context, chatID int64, userID int64, at time.Time) (int, error) {
+	defer observeQuery("GetMonthlyPoopCount", time.Now())
+	return GetMonthlyPoopCount(ctx, r.db, chatID, userID, at)
+}
+
+func (r *SQLiteRepository) GetMonthlyPoopStats(ctx context.Context, chatID int64, userID int64) ([]MonthlyPoopCount, error) {
+	defer observeQuery("GetMonthlyPoopStats", time.Now())
+	return GetMonthlyPoopStats(ctx, r.db, chatID, userID)
+}
+
+func (r *SQLiteRepository) GetDaysWithoutPoop(ctx context.Context, chatID int64, userID int64, at time.Time) (int, error) {
+	defer observeQuery("GetDaysWithoutPoop", time.Now())
+	return GetDaysWithoutPoop(ctx, r.db, chatID, userID, at)
+}
+
+func (r *SQLiteRepository) GetMaxPoopStreak(ctx context.Context, chatID int64, userID int64) (int, error) {
+	defer observeQuery("GetMaxPoopStreak", time.Now())
+	return GetMaxPoopStreak(ctx, r.db, chatID, userID)
+}
+
+func (r *SQLiteRepository) GetDayWithMostPoops(ctx context.Context, chatID int64, userID int64) (string, int, error) {
+	defer observeQuery("GetDayWithMostPoops", time.Now())
+	return GetDayWithMostPoops(ctx, r.db, chatID, userID)
+}
+
+func (r *SQLiteRepository) GetYearlyDaysWithoutPoop(ctx context.Context, chatID int64, userID int64, year int, at time.Time) (int, error) {
+	defer observeQuery("GetYearlyDaysWithoutPoop", time.Now())
+	return GetYearlyDaysWithoutPoop(ctx, r.db, chatID, userID, year, at)
+}
+
+func (r *SQLiteRepository) GetYearlyLongestStreak(ctx context.Context, chatID int64, userID int64, year int) (int, error) {
+	defer observeQuery("GetYearlyLongestStreak", time.Now())
+	return GetYearlyLongestStreak(ctx, r.db, chatID, userID, year)
+}
+
+func (r *SQLiteRepository) GetYearlyDayWithMostPoops(ctx context.Context, chatID int64, userID int64, year int) (string, int, error) {
+	defer observeQuery("GetYearlyDayWithMostPoops", time.Now())
+	return GetYearlyDayWithMostPoops(ctx, r.db, chatID, userID, year)
+}
+
+func (r *SQLiteRepository) GetLeaderboard(ctx context.Context, chatID int64, period Period, order Order, limit int) ([]UserPoopCount, error) {
+	defer observeQuery("GetLeaderboard", time.Now())
+	return GetLeaderboard(ctx, r.db, chatID, period, order, limit)
+}
+
+func (r *SQLiteRepository) GetPeriodChanges(ctx context.Context, chatID int64, period Period, previous Period) ([]PeriodChange, error) {
+	defer observeQuery("GetPeriodChanges", time.Now())
+	return GetPeriodChanges(ctx, r.db, chatID, period, previous)
+}
+
+func (r *SQLiteRepository) GetYearlyPoopCount(ctx context.Context, chatID int64, userID int64, year int) (int, error) {
+	defer observeQuery("GetYearlyPoopCount", time.Now())
+	return GetYearlyPoopCount(ctx, r.db, chatID, userID, year)
+}
+
+func (r *SQLiteRepository) GetPoopsByHour(ctx context.Context, chatID int64, userID int64, year int) ([]HourDistribution, error) {
+	defer observeQuery("GetPoopsByHour", time.Now())
+	return GetPoopsByHour(ctx, r.db, chatID, userID, year)
+}
+
+func (r *SQLiteRepository) GetPoopsByDayOfWeek(ctx context.Context, chatID int64, userID int64, year int) ([]DayOfWeekDistribution, error) {
+	defer observeQuery("GetPoopsByDayOfWeek", time.Now())
+	return GetPoopsByDayOfWeek(ctx, r.db, chatID, userID, year)
+}
+
+func (r *SQLiteRepository) GetYearlyRanking(ctx context.Context, chatID int64, userID int64, year int) (YearlyRanking, error) {
+	defer observeQuery("GetYearlyRanking", time.Now())
+	return GetYearlyRanking(ctx, r.db, chatID, userID, year)
+}
+
+func (r *SQLiteRepository) GetGroupYearlyStats(ctx context.Context, chatID int64, year int) ([]UserPoopCount, error) {
+	defer observeQuery("GetGroupYearlyStats", time.Now())
+	return GetGroupYearlyStats(ctx, r.db, chatID, year)
+}
+
+func (r *SQLiteRepository) GetGroupAwards(ctx context.Context, chatID int64, year int) ([]GroupAward, error) {
+	defer observeQuery("GetGroupAwards", time.Now())
+	return GetGroupAwards(ctx, r.db, chatID, year)
+}
+
+func (r *SQLiteRepository) RegisterGroup(ctx context.Context, chatID int64, title string, timezone string) error {
+	defer observeQuery("RegisterGroup", time.Now())
+	return RegisterGroup(ctx, r.db, chatID, title, timezone)
+}
+
+func (r *SQLiteRepository) IsRegisteredGroup(ctx context.Context, chatID int64) (bool, error) {
+	defer observeQuery("IsRegisteredGroup", time.Now())
+	return IsRegisteredGroup(ctx, r.db, chatID)
+}
+
+func (r *SQLiteRepository) GetGroups(ctx context.Context) ([]Group, error) {
+	defer observeQuery("GetGroups", time.Now())
+	return GetGroups(ctx, r.db)
+}
+
+func (r *SQLiteRepository) ClaimUnscopedLogs(ctx context.Context, chatID int64) (int64, error) {
+	defer observeQuery("ClaimUnscopedLogs", time.Now())
+	return ClaimUnscopedLogs(ctx, r.db, chatID)
+}
+
+func (r *SQLiteRepository) GetGroupTimezone(ctx context.Context, chatID int64) (string, error) {
+	defer observeQuery("GetGroupTimezone", time.Now())
+	return GetGroupTimezone(ctx, r.db, chatID)
+}
+
+func (r *SQLiteRepository) SetGroupTimezone(ctx context.Context, chatID int64, timezone string) error {
+	defer observeQuery("SetGroupTimezone", time.Now())
+	return SetGroupTimezone(ctx, r.db, chatID, timezone)
+}
+
+func (r *SQLiteRepository) GetUserTimezone(ctx context.Context, userID int64) (string, error) {
+	defer observeQuery("GetUserTimezone", time.Now())
+	return GetUserTimezone(ctx, r.db, userID)
+}
+
+func (r *SQLiteRepository) SetUserTimezone(ctx context.Context, userID int64, timezone string) error {
+	defer observeQuery("SetUserTimezone", time.Now())
+	return SetUserTimezone(ctx, r.db, userID, timezone)
+}
+
+func (r *SQLiteRepository) GetInactiveUsers(ctx context.Context, chatID int64, inactiveSince int64, activeSince int64) ([]InactiveUser, error) {
+	defer observeQuery("GetInactiveUsers", time.Now())
+	return GetInactiveUsers(ctx, r.db, chatID, inactiveSince, activeSince)
+}
+
+func (r *SQLiteRepository) RecordCheckIn(ctx context.Context, chatID int64, userID int64, lastPoopUnix int64, sentAtUnix int64) error {
+	defer observeQuery("RecordCheckIn", time.Now())
+	return RecordCheckIn(ctx, r.db, chatID, userID, lastPoopUnix, sentAtUnix)
+}
+
+func (r *SQLiteRepository) GetCheckInsEnabled(ctx context.Context, userID int64) (bool, error) {
+	defer observeQuery("GetCheckInsEnabled", time.Now())
+	return GetCheckInsEnabled(ctx, r.db, userID)
+}
+
+func (r *SQLiteRepository) SetCheckInsEnabled(ctx context.Context, userID int64, enabled bool) error {
+	defer observeQuery("SetCheckInsEnabled", time.Now())
+	return SetCheckInsEnabled(ctx, r.db, userID, enabled)
+}
+
+func (r *SQLiteRepository) GetLocalDayPoopCount(ctx context.Context, chatID int64, userID int64, at time.Time) (string, int, error) {
+	defer observeQuery("GetLocalDayPoopCount", time.Now())
+	return GetLocalDayPoopCount(ctx, r.db, chatID, userID, at)
+}
+
+func (r *SQLiteRepository) ClaimWellnessAlert(ctx context.Context, chatID int64, userID int64, day string, level int, sentAtUnix int64) (bool, error) {
+	defer observeQuery("ClaimWellnessAlert", time.Now())
+	return ClaimWellnessAlert(ctx, r.db, chatID, userID, day, level, sentAtUnix)
 }
 
-func (r *SQLiteRepository) GetGlobalPoopCount(ctx context.Context, userID int64) (int, error) {
-	return GetGlobalPoopCount(ctx, r.db, userID)
+func (r *SQLiteRepository) RegisterSticker(ctx context.Context, sticker Sticker, registeredBy int64, registeredAtUnix int64) error {
+	defer observeQuery("RegisterSticker", time.Now())
+	return RegisterSticker(ctx, r.db, sticker, registeredBy, registeredAtUnix)
 }
 
-func (r *SQLiteRepository) GetMonthlyPoopCount(ctx context.Context, userID int64) (int, error) {
-	return GetMonthlyPoopCount(ctx, r.db, userID)
+func (r *SQLiteRepository) GetStickerEmoji(ctx context.Context, fileUniqueID string) (string, error) {
+	defer observeQuery("GetStickerEmoji", time.Now())
+	return GetStickerEmoji(ctx, r.db, fileUniqueID)
 }
 
-func (r *SQLiteRepository) GetMonthlyPoopStats(ctx context.Context, userID int64) ([]MonthlyPoopCount, error) {
-	return GetMonthlyPoopStats(ctx, r.db, userID)
+func (r *SQLiteRepository) GetStickers(ctx context.Context) ([]Sticker, error) {
+	defer observeQuery("GetStickers", time.Now())
+	return GetStickers(ctx, r.db)
 }
 
-func (r *SQLiteRepository) GetDaysWithoutPoop(ctx context.Context, userID int64) (int, error) {
-	return GetDaysWithoutPoop(ctx, r.db, userID)
+func (r *SQLiteRepository) UpsertUser(ctx context.Context, user User) error {
+	defer observeQuery("UpsertUser", time.Now())
+	return UpsertUser(ctx, r.db, user)
 }
 
-func (r *SQLiteRepository) GetMaxPoopStreak(ctx context.Context, userID int64) (int, error) {
-	return GetMaxPoopStreak(ctx, r.db, userID)
+func (r *SQLiteRepository) GetUser(ctx context.Context, userID int64) (User, error) {
+	defer observeQuery("GetUser", time.Now())
+	return GetUser(ctx, r.db, userID)
 }
 
-func (r *SQLiteRepository) GetDayWithMostPoops(ctx context.Context, userID int64) (string, int, error) {
-	return GetDayWithMostPoops(ctx, r.db, userID)
+func (r *SQLiteRepository) IsPoopLogged(ctx context.Context, chatID int64, messageID int64) (bool, error) {
+	defer observeQuery("IsPoopLogged", time.Now())
+	return IsPoopLogged(ctx, r.db, chatID, messageID)
 }
 
-func (r *SQLiteRepository) GetMonthlyLeaderboard(ctx context.Context) ([]UserPoopCount, error) {
-	return GetMonthlyLeaderboard(ctx, r.db)
+func (r *SQLiteRepository) IsForwardLogged(ctx context.Context, chatID int64, userID int64, sentAtUnix int64) (bool, error) {
+	defer observeQuery("IsForwardLogged", time.Now())
+	return IsForwardLogged(ctx, r.db, chatID, userID, sentAtUnix)
 }
 
-func (r *SQLiteRepository) GetBottomPoopers(ctx context.Context) ([]UserPoopCount, error) {
-	return GetBottomPoopers(ctx, r.db)
+func (r *SQLiteRepository) LogForwardedPoop(ctx context.Context, poop ForwardedPoop) error {
+	defer observeQuery("LogForwardedPoop", time.Now())
+	return LogForwardedPoop(ctx, r.db, poop)
 }
 
-func (r *SQLiteRepository) GetMonthlyPoodium(ctx context.Context) ([]UserPoopCount, error) {
-	return GetMonthlyPoodium(ctx, r.db)
+func (r *SQLiteRepository) SavePendingBackfill(ctx context.Context, pending PendingBackfill, createdAtUnix int64) error {
+	defer observeQuery("SavePendingBackfill", time.Now())
+	return SavePendingBackfill(ctx, r.db, pending, createdAtUnix)
 }
 
-func (r *SQLiteRepository) GetPastMonthPoodium(ctx context.Context) ([]UserPoopCount, error) {
-	return GetPastMonthPoodium(ctx, r.db)
+func (r *SQLiteRepository) TakePendingBackfill(ctx context.Context, forwardMessageID int64) (PendingBackfill, error) {
+	defer observeQuery("TakePendingBackfill", time.Now())
+	return TakePendingBackfill(ctx, r.db, forwardMessageID)
 }
 
-func (r *SQLiteRepository) GetYearlyPoodium(ctx context.Context) ([]UserPoopCount, error) {
-	return GetYearlyPoodium(ctx, r.db)
+func (r *SQLiteRepository) GetRecentMembers(ctx context.Context, chatID int64, limit int) ([]User, error) {
+	defer observeQuery("GetRecentMembers", time.Now())
+	return GetRecentMembers(ctx, r.db, chatID, limit)
 }
 
-func (r *SQLiteRepository) GetYearlyPoopCount(ctx context.Context, userID int64, year int) (int, error) {
-	return GetYearlyPoopCount(ctx, r.db, userID, year)
+func (r *SQLiteRepository) FindMembersByName(ctx context.Context, chatID int64, name string) ([]User, error) {
+	defer observeQuery("FindMembersByName", time.Now())
+	return FindMembersByName(ctx, r.db, chatID, name)
 }
 
-func (r *SQLiteRepository) GetPoopsByHour(ctx context.Context, userID int64, year int) ([]HourDistribution, error) {
-	return GetPoopsByHour(ctx, r.db, userID, year)
+func (r *SQLiteRepository) StreamUserPoops(ctx context.Context, chatID int64, userID int64, fn func(ExportedPoop) error) error {
+	defer observeQuery("StreamUserPoops", time.Now())
+	return StreamUserPoops(ctx, r.db, chatID, userID, fn)
 }
 
-func (r *SQLiteRepository) GetPoopsByDayOfWeek(ctx context.Context, userID int64, year int) ([]DayOfWeekDistribution, error) {
-	return GetPoopsByDayOfWeek(ctx, r.db, userID, year)
+func (r *SQLiteRepository) GetLastScheduledRun(ctx context.Context, job string) (int64, error) {
+	defer observeQuery("GetLastScheduledRun", time.Now())
+	return GetLastScheduledRun(ctx, r.db, job)
 }
 
-func (r *SQLiteRepository) GetYearlyRanking(ctx context.Context, userID int64, year int) (YearlyRanking, error) {
-	return GetYearlyRanking(ctx, r.db, userID, year)
+func (r *SQLiteRepository) RecordScheduledRun(ctx context.Context, job string, scheduledAtUnix int64, finishedAtUnix int64) error {
+	defer observeQuery("RecordScheduledRun", time.Now())
+	return RecordScheduledRun(ctx, r.db, job, scheduledAtUnix, finishedAtUnix)
 }
 
-func (r *SQLiteRepository) GetGroupYearlyStats(ctx context.Context, year int) ([]UserPoopCount, error) {
-	return GetGroupYearlyStats(ctx, r.db, year)
+func (r *SQLiteRepository) ClaimScheduledPost(ctx context.Context, job string, chatID int64, period string, sentAtUnix int64) (bool, error) {
+	defer observeQuery("ClaimScheduledPost", time.Now())
+	return ClaimScheduledPost(ctx, r.db, job, chatID, period, sentAtUnix)
 }
 
-func (r *SQLiteRepository) GetGroupAwards(ctx context.Context, year int) ([]GroupAward, error) {
-	return GetGroupAwards(ctx, r.db, year)
+func (r *SQLiteRepository) ReleaseScheduledPost(ctx context.Context, job string, chatID int64, period string) error {
+	defer observeQuery("ReleaseScheduledPost", time.Now())
+	return ReleaseScheduledPost(ctx, r.db, job, chatID, period)
 }
 
 func (r *SQLiteRepository) HealthCheck(ctx context.Context) error {
+	defer observeQuery("HealthCheck", time.Now())
 	return HealthCheck(ctx, r.db)
 }
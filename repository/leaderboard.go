@@ -0,0 +1,199 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// PeriodKind is the kind of calendar span a Period covers
+type PeriodKind int
+
+const (
+	PeriodRange PeriodKind = iota
+	PeriodWeek
+	PeriodMonth
+	PeriodYear
+)
+
+// Period is a span of local days, from Start up to but not including End.
+// Both are midnights of calendar dates, logs fall in it by the local time of the person who logged them.
+type Period struct {
+	Kind  PeriodKind
+	Start time.Time
+	End   time.Time
+}
+
+// utcBounds returns the unix seconds every log in the period was posted within, whatever the poster's timezone.
+// Filtering on them first lets a query use the index on (chat_id, created_at_unix) instead of converting every log to local time.
+func (p Period) utcBounds() (int64, int64) {
+	// Local time is at most 14 hours ahead of UTC and 12 hours behind it
+	return p.Start.Add(-14 * time.Hour).Unix(), p.End.Add(12 * time.Hour).Unix()
+}
+
+// calendarDate is midnight of a calendar date, periods compare it against local timestamps
+func calendarDate(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// MonthPeriod is a calendar month, months outside 1-12 roll over into the neighbouring years
+func MonthPeriod(year int, month time.Month) Period {
+	start := calendarDate(year, month, 1)
+	return Period{Kind: PeriodMonth, Start: start, End: start.AddDate(0, 1, 0)}
+}
+
+// YearPeriod is a calendar year
+func YearPeriod(year int) Period {
+	start := calendarDate(year, time.January, 1)
+	return Period{Kind: PeriodYear, Start: start, End: start.AddDate(1, 0, 0)}
+}
+
+// WeekPeriod is the Monday to Sunday week containing day's date
+func WeekPeriod(day time.Time) Period {
+	start := calendarDate(day.Year(), day.Month(), day.Day())
+	start = start.AddDate(0, 0, -((int(start.Weekday()) + 6) % 7))
+	return Period{Kind: PeriodWeek, Start: start, End: start.AddDate(0, 0, 7)}
+}
+
+// ISOWeekPeriod is week number week of an ISO 8601 year, weeks start on Monday and week 1 holds the year's first Thursday
+func ISOWeekPeriod(year int, week int) Period {
+	// January 4th is always in week 1
+	return WeekPeriod(calendarDate(year, time.January, 4).AddDate(0, 0, 7*(week-1)))
+}
+
+// RangePeriod is every day from first to last, both included
+func RangePeriod(first time.Time, last time.Time) Period {
+	start := calendarDate(first.Year(), first.Month(), first.Day())
+	end := calendarDate(last.Year(), last.Month(), last.Day()).AddDate(0, 0, 1)
+	return Period{Kind: PeriodRange, Start: start, End: end}
+}
+
+// Previous is the period of the same kind right before this one, a range is followed by one of the same length
+func (p Period) Previous() Period {
+	switch p.Kind {
+	case PeriodWeek:
+		return WeekPeriod(p.Start.AddDate(0, 0, -7))
+	case PeriodMonth:
+		return MonthPeriod(p.Start.Year(), p.Start.Month()-1)
+	case PeriodYear:
+		return YearPeriod(p.Start.Year() - 1)
+	default:
+		days := int(p.End.Sub(p.Start).Hours() / 24)
+		return RangePeriod(p.Start.AddDate(0, 0, -days), p.Start.AddDate(0, 0, -1))
+	}
+}
+
+// LastDay is the final day included in the period
+func (p Period) LastDay() time.Time {
+	return p.End.AddDate(0, 0, -1)
+}
+
+// Order is the direction a leaderboard is ranked in
+type Order int
+
+const (
+	// MostPoopsFirst ranks the biggest poopers first
+	MostPoopsFirst Order = iota
+	// FewestPoopsFirst ranks the smallest poopers first, for the bottom poopers
+	FewestPoopsFirst
+)
+
+// GetLeaderboard ranks the members who logged in a period with a dense rank, so members with the same count share a rank.
+// A limit keeps the members ranked in the top limit ranks, which can be more members than limit when there are ties.
+// A limit of 0 or less returns everyone.
+func GetLeaderboard(ctx context.Context, db *sql.DB, chatID int64, period Period, order Order, limit int) ([]UserPoopCount, error) {
+	direction := "DESC"
+	if order == FewestPoopsFirst {
+		direction = "ASC"
+	}
+
+	// Members sharing a rank are listed by name, nobody's placed above the others
+	query := fmt.Sprintf(`
+	SELECT display_name, poop_count, poop_rank
+	FROM (
+		SELECT display_name, COUNT(*) AS poop_count, DENSE_RANK() OVER (ORDER BY COUNT(*) %s) AS poop_rank
+		FROM poop_log
+		WHERE chat_id = ? AND created_at_unix >= ? AND created_at_unix < ? AND timestamp >= ? AND timestamp < ?
+		GROUP BY user_id
+	)
+	WHERE ? <= 0 OR poop_rank <= ?
+	ORDER BY poop_rank, display_name COLLATE NOCASE;
+	`, direction)
+	start, end := period.utcBounds()
+	rows, err := db.QueryContext(ctx, query, chatID, start, end, period.Start.Format(sqliteTimeLayout), period.End.Format(sqliteTimeLayout), limit, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var leaderboard []UserPoopCount
+	for rows.Next() {
+		var upc UserPoopCount
+		if err := rows.Scan(&upc.Username, &upc.PoopCount, &upc.Rank); err != nil {
+			return nil, err
+		}
+		leaderboard = append(leaderboard, upc)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return leaderboard, nil
+}
+
+// PeriodChange is a member's count in a period next to their count in the period before
+type PeriodChange struct {
+	Username      string
+	PoopCount     int
+	PreviousCount int
+}
+
+// GetPeriodChanges compares what every member logged in a period with what they logged in previous.
+// Members who logged in either period are included, the busiest in period first.
+func GetPeriodChanges(ctx context.Context, db *sql.DB, chatID int64, period Period, previous Period) ([]PeriodChange, error) {
+	from, to := period.Start, period.End
+	if previous.Start.Before(from) {
+		from = previous.Start
+	}
+	if previous.End.After(to) {
+		to = previous.End
+	}
+
+	query := `
+	SELECT
+		display_name,
+		SUM(CASE WHEN timestamp >= ? AND timestamp < ? THEN 1 ELSE 0 END) AS poop_count,
+		SUM(CASE WHEN timestamp >= ? AND timestamp < ? THEN 1 ELSE 0 END) AS previous_count
+	FROM poop_log
+	WHERE chat_id = ? AND created_at_unix >= ? AND created_at_unix < ? AND timestamp >= ? AND timestamp < ?
+	GROUP BY user_id
+	HAVING poop_count > 0 OR previous_count > 0
+	ORDER BY poop_count DESC, previous_count DESC, display_name;
+	`
+	start, end := Period{Start: from, End: to}.utcBounds()
+	rows, err := db.QueryContext(ctx, query,
+		period.Start.Format(sqliteTimeLayout), period.End.Format(sqliteTimeLayout),
+		previous.Start.Format(sqliteTimeLayout), previous.End.Format(sqliteTimeLayout),
+		chatID, start, end, from.Format(sqliteTimeLayout), to.Format(sqliteTimeLayout))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes []PeriodChange
+	for rows.Next() {
+		var pc PeriodChange
+		if err := rows.Scan(&pc.Username, &pc.PoopCount, &pc.PreviousCount); err != nil {
+			return nil, err
+		}
+		changes = append(changes, pc)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
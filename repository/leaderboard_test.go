@@ -0,0 +1,192 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPeriods(t *testing.T) {
+	tests := []struct {
+		name      string
+		period    Period
+		wantStart string
+		wantEnd   string
+	}{
+		{"month", MonthPeriod(2025, time.March), "2025-03-01", "2025-04-01"},
+		{"previous month across a year", MonthPeriod(2025, time.January-1), "2024-12-01", "2025-01-01"},
+		{"year", YearPeriod(2024), "2024-01-01", "2025-01-01"},
+		{"week from a sunday", WeekPeriod(time.Date(2025, 3, 16, 23, 0, 0, 0, time.UTC)), "2025-03-10", "2025-03-17"},
+		{"week from a monday", WeekPeriod(time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC)), "2025-03-10", "2025-03-17"},
+		{"first iso week starts in the year before", ISOWeekPeriod(2025, 1), "2024-12-30", "2025-01-06"},
+		{"iso week", ISOWeekPeriod(2025, 11), "2025-03-10", "2025-03-17"},
+		{"week before", WeekPeriod(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)).Previous(), "2024-12-23", "2024-12-30"},
+		{"month before", MonthPeriod(2025, time.January).Previous(), "2024-12-01", "2025-01-01"},
+		{"year before", YearPeriod(2025).Previous(), "2024-01-01", "2025-01-01"},
+		{"range before", RangePeriod(time.Date(2025, 1, 11, 0, 0, 0, 0, time.UTC), time.Date(2025, 1, 20, 0, 0, 0, 0, time.UTC)).Previous(), "2025-01-01", "2025-01-11"},
+		{"range", RangePeriod(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 2, 15, 0, 0, 0, 0, time.UTC)), "2025-01-01", "2025-02-16"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end := tt.period.Start.Format("2006-01-02"), tt.period.End.Format("2006-01-02")
+			if start != tt.wantStart || end != tt.wantEnd {
+				t.Errorf("period = %s..%s, want %s..%s", start, end, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestGetLeaderboard(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	logPoopAt(t, db, 1001, "alice", 1, time.Date(2025, 1, 31, 23, 59, 0, 0, time.UTC))
+	logPoopAt(t, db, 1001, "alice", 2, time.Date(2025, 2, 1, 8, 0, 0, 0, time.UTC))
+	logPoopAt(t, db, 1001, "alice", 3, time.Date(2025, 2, 2, 8, 0, 0, 0, time.UTC))
+	logPoopAt(t, db, 1002, "bob", 4, time.Date(2025, 2, 1, 9, 0, 0, 0, time.UTC))
+	logPoopAt(t, db, 1003, "charlie", 5, time.Date(2025, 2, 3, 9, 0, 0, 0, time.UTC))
+	logPoopAt(t, db, 1004, "dave", 6, time.Date(2025, 2, 15, 23, 0, 0, 0, time.UTC))
+	logPoopAt(t, db, 1005, "eve", 7, time.Date(2025, 2, 16, 0, 0, 0, 0, time.UTC))
+
+	tests := []struct {
+		name   string
+		period Period
+		order  Order
+		limit  int
+		want   []UserPoopCount
+	}{
+		{
+			name:   "month excludes the days around it",
+			period: MonthPeriod(2025, time.February),
+			order:  MostPoopsFirst,
+			want:   []UserPoopCount{{"alice", 2, 1}, {"bob", 1, 2}, {"charlie", 1, 2}, {"dave", 1, 2}, {"eve", 1, 2}},
+		},
+		{
+			name:   "limit keeps the top ranks",
+			period: MonthPeriod(2025, time.February),
+			order:  MostPoopsFirst,
+			limit:  1,
+			want:   []UserPoopCount{{"alice", 2, 1}},
+		},
+		{
+			name:   "limit keeps everyone tied in the last rank",
+			period: MonthPeriod(2025, time.February),
+			order:  MostPoopsFirst,
+			limit:  2,
+			want:   []UserPoopCount{{"alice", 2, 1}, {"bob", 1, 2}, {"charlie", 1, 2}, {"dave", 1, 2}, {"eve", 1, 2}},
+		},
+		{
+			name:   "fewest first",
+			period: YearPeriod(2025),
+			order:  FewestPoopsFirst,
+			limit:  3,
+			want:   []UserPoopCount{{"bob", 1, 1}, {"charlie", 1, 1}, {"dave", 1, 1}, {"eve", 1, 1}, {"alice", 3, 2}},
+		},
+		{
+			name:   "range includes its last day",
+			period: RangePeriod(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 2, 15, 0, 0, 0, 0, time.UTC)),
+			order:  MostPoopsFirst,
+			want:   []UserPoopCount{{"alice", 3, 1}, {"bob", 1, 2}, {"charlie", 1, 2}, {"dave", 1, 2}},
+		},
+		{
+			// eve logged last, the tie isn't broken in dave's favour
+			name:   "week tie shares the first rank",
+			period: WeekPeriod(time.Date(2025, 2, 16, 0, 0, 0, 0, time.UTC)),
+			order:  MostPoopsFirst,
+			want:   []UserPoopCount{{"dave", 1, 1}, {"eve", 1, 1}},
+		},
+		{
+			name:   "empty period",
+			period: YearPeriod(2024),
+			order:  MostPoopsFirst,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GetLeaderboard(ctx, db, testChatID, tt.period, tt.order, tt.limit)
+			if err != nil {
+				t.Fatalf("GetLeaderboard() error = %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("GetLeaderboard() = %+v, want %+v", got, tt.want)
+			}
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Errorf("GetLeaderboard()[%d] = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestGetPeriodChanges(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	// The week of March 3rd, then the week of March 10th
+	logPoopAt(t, db, 1001, "alice", 1, time.Date(2025, 3, 3, 8, 0, 0, 0, time.UTC))
+	logPoopAt(t, db, 1002, "bob", 2, time.Date(2025, 3, 4, 8, 0, 0, 0, time.UTC))
+	logPoopAt(t, db, 1002, "bob", 3, time.Date(2025, 3, 5, 8, 0, 0, 0, time.UTC))
+	logPoopAt(t, db, 1001, "alice", 4, time.Date(2025, 3, 10, 8, 0, 0, 0, time.UTC))
+	logPoopAt(t, db, 1001, "alice", 5, time.Date(2025, 3, 11, 8, 0, 0, 0, time.UTC))
+	logPoopAt(t, db, 1003, "charlie", 6, time.Date(2025, 3, 16, 23, 0, 0, 0, time.UTC))
+	// Outside both weeks
+	logPoopAt(t, db, 1004, "dave", 7, time.Date(2025, 3, 17, 0, 0, 0, 0, time.UTC))
+
+	week := ISOWeekPeriod(2025, 11)
+	changes, err := GetPeriodChanges(ctx, db, testChatID, week, week.Previous())
+	if err != nil {
+		t.Fatalf("GetPeriodChanges() error = %v", err)
+	}
+
+	want := []PeriodChange{
+		{Username: "alice", PoopCount: 2, PreviousCount: 1},
+		{Username: "charlie", PoopCount: 1, PreviousCount: 0},
+		{Username: "bob", PoopCount: 0, PreviousCount: 2},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("GetPeriodChanges() = %+v, want %+v", changes, want)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Errorf("GetPeriodChanges()[%d] = %+v, want %+v", i, changes[i], want[i])
+		}
+	}
+}
+
+func TestGetLeaderboard_DenseRanking(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	// zoe reaches 2 first and bob last, neither gets ahead of the other for it
+	logPoopAt(t, db, 1001, "zoe", 1, time.Date(2025, 3, 1, 8, 0, 0, 0, time.UTC))
+	logPoopAt(t, db, 1001, "zoe", 2, time.Date(2025, 3, 2, 8, 0, 0, 0, time.UTC))
+	logPoopAt(t, db, 1002, "Bob", 3, time.Date(2025, 3, 3, 8, 0, 0, 0, time.UTC))
+	logPoopAt(t, db, 1002, "Bob", 4, time.Date(2025, 3, 20, 8, 0, 0, 0, time.UTC))
+	for i, day := range []int{4, 5, 6} {
+		logPoopAt(t, db, 1003, "alice", int64(5+i), time.Date(2025, 3, day, 8, 0, 0, 0, time.UTC))
+	}
+	logPoopAt(t, db, 1004, "carol", 8, time.Date(2025, 3, 7, 8, 0, 0, 0, time.UTC))
+	logPoopAt(t, db, 1005, "dan", 9, time.Date(2025, 3, 8, 8, 0, 0, 0, time.UTC))
+
+	got, err := GetLeaderboard(ctx, db, testChatID, MonthPeriod(2025, time.March), MostPoopsFirst, 3)
+	if err != nil {
+		t.Fatalf("GetLeaderboard() error = %v", err)
+	}
+
+	// Two members tied for silver still leave bronze for the next count
+	want := []UserPoopCount{{"alice", 3, 1}, {"Bob", 2, 2}, {"zoe", 2, 2}, {"carol", 1, 3}, {"dan", 1, 3}}
+	if len(got) != len(want) {
+		t.Fatalf("GetLeaderboard() = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("GetLeaderboard()[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,10 @@
+-- Baseline schema. Matches the table previously created by createTable, so
+-- databases that predate the migration runner adopt it without changes.
+CREATE TABLE IF NOT EXISTS poop_tracker (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    username TEXT NOT NULL,
+    message_id INTEGER UNIQUE NOT NULL,
+    timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+    created_at_unix INTEGER NOT NULL
+);
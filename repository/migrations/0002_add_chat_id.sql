@@ -0,0 +1,27 @@
+-- Scope every log to the chat it was posted in. Telegram message IDs are only
+-- unique within a chat, so the unique constraint moves to (chat_id, message_id).
+-- Rows that predate this migration keep chat_id 0 until they are claimed by the
+-- configured group on startup.
+CREATE TABLE poop_tracker_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    chat_id INTEGER NOT NULL DEFAULT 0,
+    user_id INTEGER NOT NULL,
+    username TEXT NOT NULL,
+    message_id INTEGER NOT NULL,
+    timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+    created_at_unix INTEGER NOT NULL,
+    UNIQUE (chat_id, message_id)
+);
+
+INSERT INTO poop_tracker_new (id, chat_id, user_id, username, message_id, timestamp, created_at_unix)
+SELECT id, 0, user_id, username, message_id, timestamp, created_at_unix
+FROM poop_tracker;
+
+DROP TABLE poop_tracker;
+ALTER TABLE poop_tracker_new RENAME TO poop_tracker;
+
+CREATE TABLE groups (
+    chat_id INTEGER PRIMARY KEY,
+    title TEXT NOT NULL DEFAULT '',
+    registered_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
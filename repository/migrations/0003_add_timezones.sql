@@ -0,0 +1,25 @@
+-- Timezones used to bucket logs into local days, weeks, months and years.
+-- Groups default to UTC, which matches how logs were bucketed before.
+ALTER TABLE groups ADD COLUMN timezone TEXT NOT NULL DEFAULT 'UTC';
+
+-- Per-user overrides. A NULL timezone means the user follows the group's timezone.
+CREATE TABLE user_settings (
+    user_id INTEGER PRIMARY KEY,
+    timezone TEXT
+);
+
+-- poop_log exposes every log with its timestamp in the poster's local time.
+-- Statistics read from this view instead of poop_tracker, which keeps UTC.
+-- local_time is registered by the repository package.
+CREATE VIEW poop_log AS
+SELECT
+    p.id,
+    p.chat_id,
+    p.user_id,
+    p.username,
+    p.message_id,
+    local_time(p.created_at_unix, COALESCE(us.timezone, g.timezone, 'UTC')) AS timestamp,
+    p.created_at_unix
+FROM poop_tracker p
+LEFT JOIN groups g ON g.chat_id = p.chat_id
+LEFT JOIN user_settings us ON us.user_id = p.user_id;
@@ -0,0 +1,20 @@
+-- Retracted logs are voided rather than removed, so there is an audit trail of
+-- who removed what and when. Statistics only see logs that haven't been voided.
+ALTER TABLE poop_tracker ADD COLUMN deleted_at_unix INTEGER;
+ALTER TABLE poop_tracker ADD COLUMN deleted_by INTEGER;
+
+DROP VIEW poop_log;
+
+CREATE VIEW poop_log AS
+SELECT
+    p.id,
+    p.chat_id,
+    p.user_id,
+    p.username,
+    p.message_id,
+    local_time(p.created_at_unix, COALESCE(us.timezone, g.timezone, 'UTC')) AS timestamp,
+    p.created_at_unix
+FROM poop_tracker p
+LEFT JOIN groups g ON g.chat_id = p.chat_id
+LEFT JOIN user_settings us ON us.user_id = p.user_id
+WHERE p.deleted_at_unix IS NULL;
@@ -0,0 +1,12 @@
+-- Members are checked on when they stop logging, unless they opt out.
+ALTER TABLE user_settings ADD COLUMN checkins_enabled INTEGER NOT NULL DEFAULT 1;
+
+-- The last check-in sent to each member, keyed by the log it was about, so a
+-- member is only asked once per silence and again after they log another poop.
+CREATE TABLE inactivity_checkins (
+    chat_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    last_poop_unix INTEGER NOT NULL,
+    sent_at_unix INTEGER NOT NULL,
+    PRIMARY KEY (chat_id, user_id)
+);
@@ -0,0 +1,11 @@
+-- Wellness alerts sent when a member logs too many poops in one of their local
+-- days. Level 1 is the first concern, level 2 the escalation, so each is only
+-- sent once per day even across restarts.
+CREATE TABLE wellness_alerts (
+    chat_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    day TEXT NOT NULL,
+    level INTEGER NOT NULL,
+    sent_at_unix INTEGER NOT NULL,
+    PRIMARY KEY (chat_id, user_id, day)
+);
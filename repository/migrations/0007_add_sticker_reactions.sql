@@ -0,0 +1,17 @@
+-- Reactions to specific stickers, managed by the admin with /register_sticker.
+-- Seeded with the Poopers2 stickers that used to be hardcoded in the config.
+CREATE TABLE sticker_reactions (
+    file_unique_id TEXT PRIMARY KEY,
+    set_name TEXT NOT NULL DEFAULT '',
+    emoji TEXT NOT NULL,
+    registered_by INTEGER,
+    registered_at_unix INTEGER
+);
+
+INSERT INTO sticker_reactions (file_unique_id, set_name, emoji) VALUES
+    ('AgADOxkAAgTYWVE', 'Poopers2', '😢'),
+    ('AgADRhoAAhq7WVE', 'Poopers2', '🎉'),
+    ('AgADQRcAAu99WVE', 'Poopers2', '🏆'),
+    ('AgADrxkAAtHnYFE', 'Poopers2', '💅'),
+    ('AgADfBkAAgwIYVE', 'Poopers2', '🫡'),
+    ('AgADcxgAAvVG0FE', 'Poopers2', '🤨');
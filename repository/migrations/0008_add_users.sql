@@ -0,0 +1,36 @@
+-- Everyone the bot has seen, with the names they currently go by. Logs keep the
+-- username from when they were posted, statistics show the current name instead.
+CREATE TABLE users (
+    user_id INTEGER PRIMARY KEY,
+    username TEXT NOT NULL DEFAULT '',
+    first_name TEXT NOT NULL DEFAULT '',
+    last_name TEXT NOT NULL DEFAULT '',
+    last_seen_unix INTEGER NOT NULL DEFAULT 0
+);
+
+-- Seed users with the username of their latest log, SQLite takes the bare
+-- username from the row holding the maximum.
+INSERT INTO users (user_id, username, last_seen_unix)
+SELECT user_id, COALESCE(username, ''), MAX(created_at_unix)
+FROM poop_tracker
+GROUP BY user_id;
+
+DROP VIEW poop_log;
+
+-- display_name is the user's current @username, their first name if they have
+-- none, and the username logged with the poop for users the bot never saw since.
+CREATE VIEW poop_log AS
+SELECT
+    p.id,
+    p.chat_id,
+    p.user_id,
+    p.username,
+    COALESCE(NULLIF(u.username, ''), NULLIF(u.first_name, ''), p.username, '') AS display_name,
+    p.message_id,
+    local_time(p.created_at_unix, COALESCE(us.timezone, g.timezone, 'UTC')) AS timestamp,
+    p.created_at_unix
+FROM poop_tracker p
+LEFT JOIN users u ON u.user_id = p.user_id
+LEFT JOIN groups g ON g.chat_id = p.chat_id
+LEFT JOIN user_settings us ON us.user_id = p.user_id
+WHERE p.deleted_at_unix IS NULL;
@@ -0,0 +1,17 @@
+-- Logs backfilled from messages forwarded to the admin remember the message
+-- they were forwarded from, when Telegram reveals it, so forwarding the same
+-- message twice is detected. Logs posted in the group leave them empty.
+ALTER TABLE poop_tracker ADD COLUMN origin_chat_id INTEGER;
+ALTER TABLE poop_tracker ADD COLUMN origin_message_id INTEGER;
+
+-- Forwards whose sender Telegram hides, waiting for the admin to say who
+-- posted them. Keyed by the forwarded message in the admin's chat.
+CREATE TABLE pending_backfills (
+    forward_message_id INTEGER PRIMARY KEY,
+    chat_id INTEGER NOT NULL,
+    sender_name TEXT NOT NULL DEFAULT '',
+    sent_at_unix INTEGER NOT NULL,
+    origin_chat_id INTEGER,
+    origin_message_id INTEGER,
+    created_at_unix INTEGER NOT NULL
+);
@@ -0,0 +1,17 @@
+-- The last successful run of each scheduled job, as the time it was scheduled
+-- for, so runs missed while the bot was stopped can be caught up at startup.
+CREATE TABLE scheduled_runs (
+    job TEXT PRIMARY KEY,
+    scheduled_at_unix INTEGER NOT NULL,
+    finished_at_unix INTEGER NOT NULL
+);
+
+-- Every announcement a scheduled job posted, one per group and period, so a
+-- job that runs again for the same period doesn't post twice.
+CREATE TABLE scheduled_posts (
+    job TEXT NOT NULL,
+    chat_id INTEGER NOT NULL,
+    period TEXT NOT NULL,
+    sent_at_unix INTEGER NOT NULL,
+    PRIMARY KEY (job, chat_id, period)
+);
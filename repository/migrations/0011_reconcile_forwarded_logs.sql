@@ -0,0 +1,17 @@
+-- Logs backfilled from forwards of unknown origin were kept under a negative
+-- ID even after the message they were forwarded from was logged, by the live
+-- bot or an import, so the same poop counted twice. Void those duplicates, a
+-- log by the same member in the same chat at the same second that hasn't been
+-- deleted, so the poop counts once and the forward stays in the audit trail.
+UPDATE poop_tracker
+SET deleted_at_unix = CAST(strftime('%s', 'now') AS INTEGER)
+WHERE message_id < 0
+  AND deleted_at_unix IS NULL
+  AND EXISTS (
+    SELECT 1 FROM poop_tracker logged
+    WHERE logged.chat_id = poop_tracker.chat_id
+      AND logged.user_id = poop_tracker.user_id
+      AND logged.created_at_unix = poop_tracker.created_at_unix
+      AND logged.message_id > 0
+      AND logged.deleted_at_unix IS NULL
+  );
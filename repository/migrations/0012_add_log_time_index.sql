@@ -0,0 +1,4 @@
+-- Statistics bucket logs by local time, which poop_log computes for every row
+-- it reads. Queries bound created_at_unix first, so this index narrows the
+-- logs down to the period before any of them is converted.
+CREATE INDEX poop_tracker_chat_created_at ON poop_tracker (chat_id, created_at_unix);
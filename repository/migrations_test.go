@@ -0,0 +1,263 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+// legacySchema is the table createTable used to create before migrations existed
+const legacySchema = `
+CREATE TABLE IF NOT EXISTS poop_tracker (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    username TEXT NOT NULL,
+	message_id INTEGER UNIQUE NOT NULL,
+    timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+    created_at_unix INTEGER NOT NULL
+);
+`
+
+// setupBaselineDB creates a file database in the shape production had before the migration runner
+func setupBaselineDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "baseline.db"))
+	if err != nil {
+		t.Fatalf("Failed to open baseline database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	ctx := context.Background()
+	if _, err := db.ExecContext(ctx, legacySchema); err != nil {
+		t.Fatalf("Failed to create legacy schema: %v", err)
+	}
+
+	_, err = db.ExecContext(ctx, `
+	INSERT INTO poop_tracker (user_id, username, message_id, timestamp, created_at_unix)
+	VALUES (1001, 'alice', 1, '2024-12-31 23:30:00', 1735687800),
+	       (1002, 'bob', 2, '2025-01-01 08:00:00', 1735718400);
+	`)
+	if err != nil {
+		t.Fatalf("Failed to insert legacy rows: %v", err)
+	}
+
+	return db
+}
+
+func latestMigrationVersion(t *testing.T) int {
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatalf("loadMigrations() error = %v", err)
+	}
+	return migrations[len(migrations)-1].Version
+}
+
+func TestMigrate_BaselineToLatest(t *testing.T) {
+	db := setupBaselineDB(t)
+	ctx := context.Background()
+
+	if err := migrate(ctx, db); err != nil {
+		t.Fatalf("migrate() error = %v", err)
+	}
+
+	version, err := SchemaVersion(ctx, db)
+	if err != nil {
+		t.Fatalf("SchemaVersion() error = %v", err)
+	}
+	if want := latestMigrationVersion(t); version != want {
+		t.Errorf("SchemaVersion() = %d, want %d", version, want)
+	}
+
+	var rows int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM poop_tracker`).Scan(&rows); err != nil {
+		t.Fatalf("Failed to count rows: %v", err)
+	}
+	if rows != 2 {
+		t.Errorf("poop_tracker has %d rows after migration, want 2", rows)
+	}
+
+	// Everyone who logged before users were tracked is known by their last username
+	user, err := GetUser(ctx, db, 1002)
+	if err != nil {
+		t.Fatalf("GetUser() error = %v", err)
+	}
+	if user.Username != "bob" || user.LastSeenUnix != 1735718400 {
+		t.Errorf("GetUser() after migration = %+v, want bob last seen at his log", user)
+	}
+
+	// Running again must be a no-op
+	if err := migrate(ctx, db); err != nil {
+		t.Fatalf("second migrate() error = %v", err)
+	}
+
+	var applied int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM schema_migrations`).Scan(&applied); err != nil {
+		t.Fatalf("Failed to count applied migrations: %v", err)
+	}
+	if applied != latestMigrationVersion(t) {
+		t.Errorf("schema_migrations has %d rows, want %d", applied, latestMigrationVersion(t))
+	}
+}
+
+func TestMigrate_RefusesDowngrade(t *testing.T) {
+	db := setupBaselineDB(t)
+	ctx := context.Background()
+
+	if err := migrate(ctx, db); err != nil {
+		t.Fatalf("migrate() error = %v", err)
+	}
+
+	future := latestMigrationVersion(t) + 1
+	_, err := db.ExecContext(ctx, `INSERT INTO schema_migrations (version, name) VALUES (?, 'from_the_future')`, future)
+	if err != nil {
+		t.Fatalf("Failed to record future migration: %v", err)
+	}
+
+	err = migrate(ctx, db)
+	if err == nil {
+		t.Fatal("migrate() succeeded on a newer schema, want error")
+	}
+	if !strings.Contains(err.Error(), "refusing to downgrade") {
+		t.Errorf("migrate() error = %v, want downgrade refusal", err)
+	}
+}
+
+func TestApplyMigrations_RollsBackFailedMigration(t *testing.T) {
+	db := setupBaselineDB(t)
+	ctx := context.Background()
+
+	migrations := []migration{
+		{
+			Version: 1,
+			Name:    "create_notes",
+			Up: func(ctx context.Context, tx *sql.Tx) error {
+				_, err := tx.ExecContext(ctx, `CREATE TABLE notes (id INTEGER PRIMARY KEY)`)
+				return err
+			},
+		},
+		{
+			Version: 2,
+			Name:    "broken",
+			Up: func(ctx context.Context, tx *sql.Tx) error {
+				if _, err := tx.ExecContext(ctx, `CREATE TABLE half_done (id INTEGER PRIMARY KEY)`); err != nil {
+					return err
+				}
+				return errors.New("boom")
+			},
+		},
+	}
+
+	if err := applyMigrations(ctx, db, migrations); err == nil {
+		t.Fatal("applyMigrations() succeeded, want error from broken migration")
+	}
+
+	version, err := SchemaVersion(ctx, db)
+	if err != nil {
+		t.Fatalf("SchemaVersion() error = %v", err)
+	}
+	if version != 1 {
+		t.Errorf("SchemaVersion() = %d, want 1", version)
+	}
+
+	var tables int
+	err = db.QueryRowContext(ctx, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'half_done'`).Scan(&tables)
+	if err != nil {
+		t.Fatalf("Failed to inspect schema: %v", err)
+	}
+	if tables != 0 {
+		t.Error("half_done table exists, want failed migration rolled back")
+	}
+}
+
+func TestParseMigrationFileName(t *testing.T) {
+	tests := []struct {
+		fileName    string
+		wantVersion int
+		wantName    string
+		wantErr     bool
+	}{
+		{"0001_create_poop_tracker.sql", 1, "create_poop_tracker", false},
+		{"0012_add_index.sql", 12, "add_index", false},
+		{"create_table.sql", 0, "", true},
+		{"0003.sql", 0, "", true},
+		{"0000_zero.sql", 0, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fileName, func(t *testing.T) {
+			version, name, err := parseMigrationFileName(tt.fileName)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseMigrationFileName() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if version != tt.wantVersion || name != tt.wantName {
+				t.Errorf("parseMigrationFileName() = (%d, %q), want (%d, %q)", version, name, tt.wantVersion, tt.wantName)
+			}
+		})
+	}
+}
+
+func TestMigrate_VoidsForwardedDuplicates(t *testing.T) {
+	db := setupBaselineDB(t)
+	ctx := context.Background()
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatalf("loadMigrations() error = %v", err)
+	}
+	var before []migration
+	for _, m := range migrations {
+		if m.Version < 11 {
+			before = append(before, m)
+		}
+	}
+	if err := applyMigrations(ctx, db, before); err != nil {
+		t.Fatalf("applyMigrations() error = %v", err)
+	}
+
+	// Alice's forward duplicates a live log, Bob's a log that was deleted since
+	_, err = db.ExecContext(ctx, `
+	INSERT INTO poop_tracker (chat_id, user_id, username, message_id, timestamp, created_at_unix, deleted_at_unix)
+	VALUES (-100123, 1001, 'alice', 10, '2025-03-01 08:00:00', 1740816000, NULL),
+	       (-100123, 1001, 'alice', -20, '2025-03-01 08:00:00', 1740816000, NULL),
+	       (-100123, 1002, 'bob', 11, '2025-03-01 09:00:00', 1740819600, 1740820000),
+	       (-100123, 1002, 'bob', -21, '2025-03-01 09:00:00', 1740819600, NULL);
+	`)
+	if err != nil {
+		t.Fatalf("Failed to insert logs: %v", err)
+	}
+
+	if err := migrate(ctx, db); err != nil {
+		t.Fatalf("migrate() error = %v", err)
+	}
+
+	var rows int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM poop_tracker WHERE chat_id = -100123`).Scan(&rows); err != nil {
+		t.Fatalf("Failed to count rows: %v", err)
+	}
+	if rows != 4 {
+		t.Errorf("poop_tracker has %d rows in the chat after migration, want all 4 kept", rows)
+	}
+
+	for _, tt := range []struct {
+		messageID  int64
+		wantVoided bool
+	}{
+		{10, false},
+		{-20, true},
+		{11, true},
+		{-21, false},
+	} {
+		var deletedAt sql.NullInt64
+		err := db.QueryRowContext(ctx, `SELECT deleted_at_unix FROM poop_tracker WHERE chat_id = -100123 AND message_id = ?`, tt.messageID).Scan(&deletedAt)
+		if err != nil {
+			t.Fatalf("Failed to read log %d: %v", tt.messageID, err)
+		}
+		if deletedAt.Valid != tt.wantVoided {
+			t.Errorf("log %d voided = %v, want %v", tt.messageID, deletedAt.Valid, tt.wantVoided)
+		}
+	}
+}
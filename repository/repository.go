@@ -3,12 +3,16 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"math"
 	"strconv"
+	"strings"
 	"time"
 
 	"src/config"
+	"src/utils"
 
 	_ "modernc.org/sqlite"
 )
@@ -50,134 +54,184 @@ type MonthlyPoopCount struct {
 type UserPoopCount struct {
 	Username  string
 	PoopCount int
+	// Rank is the dense rank of PoopCount, members with the same count share it and the next count is one rank below
+	Rank int
 }
 
-func LogPoop(ctx context.Context, db *sql.DB, userID int64, username string, msgId int64, timestamp string, unixTimestamp int64) error {
+// PoopLog is a single logged poop, Timestamp is in the poster's local time.
+// Imported logs have no Username, DisplayName is the name to show for the poster, like poop_log.display_name.
+type PoopLog struct {
+	ChatID        int64
+	UserID        int64
+	Username      string
+	DisplayName   string
+	MessageID     int64
+	Timestamp     string
+	CreatedAtUnix int64
+}
+
+// ErrPoopNotFound is returned when there is no matching log that hasn't been deleted
+var ErrPoopNotFound = errors.New("poop log not found")
+
+type Group struct {
+	ChatID   int64
+	Title    string
+	Timezone string
+}
+
+// ErrPoopAlreadyLogged is returned by LogPoop for a message that was already logged, even if the log was deleted since
+var ErrPoopAlreadyLogged = errors.New("poop already logged")
+
+// LogPoop logs the poop posted in a message. Logging the same message again leaves the existing log alone and returns ErrPoopAlreadyLogged.
+// So does a message that was already backfilled from a forward, whose log takes the message's ID instead.
+func LogPoop(ctx context.Context, db *sql.DB, chatID int64, userID int64, username string, msgId int64, timestamp string, unixTimestamp int64) error {
+	reconciled, err := reconcileForwardedPoop(ctx, db, chatID, userID, msgId, unixTimestamp)
+	if err != nil {
+		return err
+	}
+	if reconciled {
+		return ErrPoopAlreadyLogged
+	}
+
 	query := `
-	INSERT INTO poop_tracker (user_id, username, message_id, timestamp, created_at_unix)
-	VALUES (?, ?, ?, ?, ?)
+	INSERT INTO poop_tracker (chat_id, user_id, username, message_id, timestamp, created_at_unix)
+	VALUES (?, ?, ?, ?, ?, ?)
+	ON CONFLICT (chat_id, message_id) DO NOTHING
 	`
-	log.Println("Logging poop for user:", username)
-	_, err := db.ExecContext(ctx, query, userID, username, msgId, timestamp, unixTimestamp)
-	return err
+	result, err := db.ExecContext(ctx, query, chatID, userID, username, msgId, timestamp, unixTimestamp)
+	if err != nil {
+		return err
+	}
+
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if inserted == 0 {
+		return ErrPoopAlreadyLogged
+	}
+	return nil
 }
 
-func GetGlobalPoopCount(ctx context.Context, db *sql.DB, userID int64) (int, error) {
+// IsPoopLogged reports whether a message was ever logged in a chat, deleted logs included
+func IsPoopLogged(ctx context.Context, db *sql.DB, chatID int64, messageID int64) (bool, error) {
 	query := `
-    SELECT COUNT(*) AS poop_count
-    FROM poop_tracker
-    WHERE user_id = ?;
-    `
-	var poopCount int
-	err := db.QueryRowContext(ctx, query, userID).Scan(&poopCount)
+	SELECT EXISTS (
+		SELECT 1 FROM poop_tracker WHERE chat_id = ? AND message_id = ?
+	);
+	`
+	var logged bool
+	err := db.QueryRowContext(ctx, query, chatID, messageID).Scan(&logged)
+	return logged, err
+}
+
+// GetLatestPoop returns the user's most recent log in a chat
+func GetLatestPoop(ctx context.Context, db *sql.DB, chatID int64, userID int64) (PoopLog, error) {
+	query := `
+	SELECT chat_id, user_id, username, display_name, message_id, timestamp, created_at_unix
+	FROM poop_log
+	WHERE chat_id = ? AND user_id = ?
+	ORDER BY created_at_unix DESC, id DESC
+	LIMIT 1;
+	`
+	var pl PoopLog
+	err := db.QueryRowContext(ctx, query, chatID, userID).Scan(&pl.ChatID, &pl.UserID, &pl.Username, &pl.DisplayName, &pl.MessageID, &pl.Timestamp, &pl.CreatedAtUnix)
+	if errors.Is(err, sql.ErrNoRows) {
+		return PoopLog{}, ErrPoopNotFound
+	}
 	if err != nil {
-		return 0, err
+		return PoopLog{}, err
 	}
-	return poopCount, nil
+	return pl, nil
 }
 
-func GetMonthlyPoopCount(ctx context.Context, db *sql.DB, userID int64) (int, error) {
+// GetPoopByMessageID returns the log recorded for a message in a chat
+func GetPoopByMessageID(ctx context.Context, db *sql.DB, chatID int64, messageID int64) (PoopLog, error) {
 	query := `
-    SELECT COUNT(*) AS poop_count
-    FROM poop_tracker
-    WHERE user_id = $1 AND strftime('%Y-%m', timestamp) = strftime('%Y-%m', 'now');
-    `
-	var poopCount int
-	err := db.QueryRowContext(ctx, query, userID).Scan(&poopCount)
+	SELECT chat_id, user_id, username, display_name, message_id, timestamp, created_at_unix
+	FROM poop_log
+	WHERE chat_id = ? AND message_id = ?;
+	`
+	var pl PoopLog
+	err := db.QueryRowContext(ctx, query, chatID, messageID).Scan(&pl.ChatID, &pl.UserID, &pl.Username, &pl.DisplayName, &pl.MessageID, &pl.Timestamp, &pl.CreatedAtUnix)
+	if errors.Is(err, sql.ErrNoRows) {
+		return PoopLog{}, ErrPoopNotFound
+	}
 	if err != nil {
-		return 0, err
+		return PoopLog{}, err
 	}
-	return poopCount, nil
+	return pl, nil
 }
 
-func GetMonthlyPoodium(ctx context.Context, db *sql.DB) ([]UserPoopCount, error) {
+// DeletePoop voids the log for a message. The row is kept with who deleted it and when, but no longer counts in any statistic.
+func DeletePoop(ctx context.Context, db *sql.DB, chatID int64, messageID int64, deletedBy int64, deletedAtUnix int64) error {
 	query := `
-    SELECT username, COUNT(*) AS poop_count
-    FROM poop_tracker
-    WHERE strftime('%Y-%m', timestamp) = strftime('%Y-%m', 'now')
-    GROUP BY user_id
-    ORDER BY poop_count DESC, MAX(timestamp) ASC
-    LIMIT 3;
-    `
-	rows, err := db.QueryContext(ctx, query)
+	UPDATE poop_tracker
+	SET deleted_at_unix = ?, deleted_by = ?
+	WHERE chat_id = ? AND message_id = ? AND deleted_at_unix IS NULL;
+	`
+	result, err := db.ExecContext(ctx, query, deletedAtUnix, deletedBy, chatID, messageID)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
 
-	var topPoopers []UserPoopCount
-	for rows.Next() {
-		var upc UserPoopCount
-		if err := rows.Scan(&upc.Username, &upc.PoopCount); err != nil {
-			return nil, err
-		}
-		topPoopers = append(topPoopers, upc)
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrPoopNotFound
 	}
-	return topPoopers, nil
+	slog.InfoContext(ctx, "Poop deleted", "message_id", messageID, "deleted_by", deletedBy)
+	return nil
 }
 
-func GetPastMonthPoodium(ctx context.Context, db *sql.DB) ([]UserPoopCount, error) {
+func GetGlobalPoopCount(ctx context.Context, db *sql.DB, chatID int64, userID int64) (int, error) {
 	query := `
-    SELECT username, COUNT(*) AS poop_count
-    FROM poop_tracker
-    WHERE strftime('%Y-%m', timestamp) = strftime('%Y-%m', 'now', '-1 month')
-    GROUP BY user_id
-    ORDER BY poop_count DESC, MAX(timestamp) ASC
-    LIMIT 3;
+    SELECT COUNT(*) AS poop_count
+    FROM poop_log
+    WHERE chat_id = ? AND user_id = ?;
     `
-	rows, err := db.QueryContext(ctx, query)
+	var poopCount int
+	err := db.QueryRowContext(ctx, query, chatID, userID).Scan(&poopCount)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
-	defer rows.Close()
+	return poopCount, nil
+}
 
-	var topPoopers []UserPoopCount
-	for rows.Next() {
-		var upc UserPoopCount
-		if err := rows.Scan(&upc.Username, &upc.PoopCount); err != nil {
-			return nil, err
-		}
-		topPoopers = append(topPoopers, upc)
+// GetMonthlyPoopCount counts the user's poops in the month that contains at, in their timezone
+func GetMonthlyPoopCount(ctx context.Context, db *sql.DB, chatID int64, userID int64, at time.Time) (int, error) {
+	loc, err := userLocation(ctx, db, chatID, userID)
+	if err != nil {
+		return 0, err
 	}
-	return topPoopers, nil
-}
 
-func GetYearlyPoodium(ctx context.Context, db *sql.DB) ([]UserPoopCount, error) {
 	query := `
-    SELECT username, COUNT(*) AS poop_count
-    FROM poop_tracker
-    WHERE strftime('%Y', timestamp) = strftime('%Y', 'now')
-    GROUP BY user_id
-    ORDER BY poop_count DESC, MAX(timestamp) ASC
-    LIMIT 3;
+    SELECT COUNT(*) AS poop_count
+    FROM poop_log
+    WHERE chat_id = ? AND user_id = ? AND created_at_unix >= ? AND created_at_unix < ? AND strftime('%Y-%m', timestamp) = ?;
     `
-	rows, err := db.QueryContext(ctx, query)
+	local := at.In(loc)
+	start, end := MonthPeriod(local.Year(), local.Month()).utcBounds()
+	var poopCount int
+	err = db.QueryRowContext(ctx, query, chatID, userID, start, end, local.Format("2006-01")).Scan(&poopCount)
 	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var topPoopers []UserPoopCount
-	for rows.Next() {
-		var upc UserPoopCount
-		if err := rows.Scan(&upc.Username, &upc.PoopCount); err != nil {
-			return nil, err
-		}
-		topPoopers = append(topPoopers, upc)
+		return 0, err
 	}
-	return topPoopers, nil
+	return poopCount, nil
 }
 
-func GetMonthlyPoopStats(ctx context.Context, db *sql.DB, userID int64) ([]MonthlyPoopCount, error) {
+func GetMonthlyPoopStats(ctx context.Context, db *sql.DB, chatID int64, userID int64) ([]MonthlyPoopCount, error) {
 	query := `
     SELECT strftime('%Y-%m', timestamp) AS month, COUNT(*) AS poop_count
-    FROM poop_tracker
-    WHERE user_id = ?
+    FROM poop_log
+    WHERE chat_id = ? AND user_id = ?
     GROUP BY month
     ORDER BY month;
     `
 
-	rows, err := db.QueryContext(ctx, query, userID)
+	rows, err := db.QueryContext(ctx, query, chatID, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -199,77 +253,51 @@ func GetMonthlyPoopStats(ctx context.Context, db *sql.DB, userID int64) ([]Month
 	return results, nil
 }
 
-func GetMonthlyLeaderboard(ctx context.Context, db *sql.DB) ([]UserPoopCount, error) {
-	query := `
-    SELECT username, COUNT(*) AS poop_count
-    FROM poop_tracker
-    WHERE strftime('%Y-%m', timestamp) = strftime('%Y-%m', 'now')
-    GROUP BY user_id
-    ORDER BY poop_count DESC, MAX(timestamp) ASC;
-    `
-	rows, err := db.QueryContext(ctx, query)
+// GetDaysWithoutPoop counts the days the user didn't poop this year, up to the day that contains at
+func GetDaysWithoutPoop(ctx context.Context, db *sql.DB, chatID int64, userID int64, at time.Time) (int, error) {
+	loc, err := userLocation(ctx, db, chatID, userID)
 	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var leaderboard []UserPoopCount
-	for rows.Next() {
-		var upc UserPoopCount
-		if err := rows.Scan(&upc.Username, &upc.PoopCount); err != nil {
-			return nil, err
-		}
-		leaderboard = append(leaderboard, upc)
+		return 0, err
 	}
-	return leaderboard, nil
+	return GetYearlyDaysWithoutPoop(ctx, db, chatID, userID, at.In(loc).Year(), at)
 }
 
-func GetBottomPoopers(ctx context.Context, db *sql.DB) ([]UserPoopCount, error) {
-	query := `
-    SELECT username, COUNT(*) AS poop_count
-    FROM poop_tracker
-    WHERE strftime('%Y-%m', timestamp) = strftime('%Y-%m', 'now')
-    GROUP BY user_id
-    ORDER BY poop_count ASC, MAX(timestamp) ASC
-    LIMIT 3;
-    `
-	rows, err := db.QueryContext(ctx, query)
+// GetYearlyDaysWithoutPoop counts the days of a year the user didn't poop, up to the day that contains at for the current year
+func GetYearlyDaysWithoutPoop(ctx context.Context, db *sql.DB, chatID int64, userID int64, year int, at time.Time) (int, error) {
+	loc, err := userLocation(ctx, db, chatID, userID)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
-	defer rows.Close()
 
-	var bottomPoopers []UserPoopCount
-	for rows.Next() {
-		var upc UserPoopCount
-		if err := rows.Scan(&upc.Username, &upc.PoopCount); err != nil {
-			return nil, err
-		}
-		bottomPoopers = append(bottomPoopers, upc)
+	today := at.In(loc)
+	if year > today.Year() {
+		return 0, nil
+	}
+	lastDay := fmt.Sprintf("%04d-12-31", year)
+	if year == today.Year() {
+		lastDay = today.Format("2006-01-02")
 	}
-	return bottomPoopers, nil
-}
 
-func GetDaysWithoutPoop(ctx context.Context, db *sql.DB, userID int64) (int, error) {
 	query := `
-    WITH all_days AS (
-        SELECT date('now', '-' || (julianday('now') - julianday(date('now', 'start of year'))) || ' days') AS day
+    WITH RECURSIVE all_days AS (
+        SELECT date(?, 'start of year') AS day
         UNION ALL
         SELECT date(day, '+1 day')
         FROM all_days
-        WHERE day < date('now')
+        WHERE day < ?
     ),
     pooped_days AS (
         SELECT DISTINCT date(timestamp) AS day
-        FROM poop_tracker
-        WHERE user_id = ?
+        FROM poop_log
+        WHERE chat_id = ? AND user_id = ? AND created_at_unix >= ? AND created_at_unix < ? AND strftime('%Y', timestamp) = ?
     )
     SELECT COUNT(*)
     FROM all_days
     WHERE day NOT IN (SELECT day FROM pooped_days);
     `
+	start, end := YearPeriod(year).utcBounds()
 	var daysWithoutPoop int
-	err := db.QueryRowContext(ctx, query, userID).Scan(&daysWithoutPoop)
+	err = db.QueryRowContext(ctx, query, lastDay, lastDay, chatID, userID, start, end, strconv.Itoa(year)).Scan(&daysWithoutPoop)
 
 	if err != nil {
 		return 0, err
@@ -277,14 +305,15 @@ func GetDaysWithoutPoop(ctx context.Context, db *sql.DB, userID int64) (int, err
 	return daysWithoutPoop, nil
 }
 
-func GetMaxPoopStreak(ctx context.Context, db *sql.DB, userID int64) (int, error) {
+// GetMaxPoopStreak returns the longest run of days the user logged the same number of poops on
+func GetMaxPoopStreak(ctx context.Context, db *sql.DB, chatID int64, userID int64) (int, error) {
 	query := `
     WITH daily_poops AS (
         SELECT 
             date(timestamp) AS day, 
             COUNT(*) AS poops
-        FROM poop_tracker
-        WHERE user_id = ?
+        FROM poop_log
+        WHERE chat_id = ? AND user_id = ?
         GROUP BY day
         ORDER BY day
     ),
@@ -297,7 +326,7 @@ func GetMaxPoopStreak(ctx context.Context, db *sql.DB, userID int64) (int, error
             ROW_NUMBER() OVER (PARTITION BY poops ORDER BY day) AS streak_group
         FROM daily_poops
     )
-    SELECT MAX(streak_count) AS max_streak
+    SELECT COALESCE(MAX(streak_count), 0) AS max_streak
     FROM (
         SELECT COUNT(*) AS streak_count
         FROM streaks
@@ -305,57 +334,104 @@ func GetMaxPoopStreak(ctx context.Context, db *sql.DB, userID int64) (int, error
     );
     `
 	var maxStreak int
-	err := db.QueryRowContext(ctx, query, userID).Scan(&maxStreak)
+	err := db.QueryRowContext(ctx, query, chatID, userID).Scan(&maxStreak)
 	if err != nil {
 		return 0, err
 	}
 	return maxStreak, nil
 }
 
-func GetDayWithMostPoops(ctx context.Context, db *sql.DB, userID int64) (string, int, error) {
+// GetYearlyLongestStreak returns the longest run of consecutive days the user logged at least one poop on in a calendar year
+func GetYearlyLongestStreak(ctx context.Context, db *sql.DB, chatID int64, userID int64, year int) (int, error) {
 	query := `
+    WITH days AS (
+        SELECT DISTINCT date(timestamp) AS day
+        FROM poop_log
+        WHERE chat_id = ? AND user_id = ? AND created_at_unix >= ? AND created_at_unix < ? AND strftime('%Y', timestamp) = ?
+    ),
+    streaks AS (
+        SELECT
+            -- Consecutive days share the same difference between their date and their position
+            julianday(day) - ROW_NUMBER() OVER (ORDER BY day) AS streak_group
+        FROM days
+    )
+    SELECT COALESCE(MAX(streak_count), 0) AS longest_streak
+    FROM (
+        SELECT COUNT(*) AS streak_count
+        FROM streaks
+        GROUP BY streak_group
+    );
+    `
+	start, end := YearPeriod(year).utcBounds()
+	var longestStreak int
+	err := db.QueryRowContext(ctx, query, chatID, userID, start, end, strconv.Itoa(year)).Scan(&longestStreak)
+	if err != nil {
+		return 0, err
+	}
+	return longestStreak, nil
+}
+
+// dayWithMostPoopsQuery finds the busiest day, the year filter is optional
+const dayWithMostPoopsQuery = `
     SELECT 
         date(timestamp) AS day, 
         COUNT(*) AS dumps
-    FROM poop_tracker
-    WHERE user_id = ?
+    FROM poop_log
+    WHERE chat_id = ? AND user_id = ? AND created_at_unix >= ? AND created_at_unix < ? AND (? = '' OR strftime('%Y', timestamp) = ?)
     GROUP BY day
-    ORDER BY dumps DESC
+    ORDER BY dumps DESC, day
     LIMIT 1;
     `
+
+func GetDayWithMostPoops(ctx context.Context, db *sql.DB, chatID int64, userID int64) (string, int, error) {
 	var day string
 	var dumps int
-	err := db.QueryRowContext(ctx, query, userID).Scan(&day, &dumps)
+	err := db.QueryRowContext(ctx, dayWithMostPoopsQuery, chatID, userID, int64(math.MinInt64), int64(math.MaxInt64), "", "").Scan(&day, &dumps)
 	if err != nil {
 		return "", 0, err
 	}
 	return day, dumps, nil
 }
 
-func GetYearlyPoopCount(ctx context.Context, db *sql.DB, userID int64, year int) (int, error) {
+// GetYearlyDayWithMostPoops is GetDayWithMostPoops limited to a single calendar year
+func GetYearlyDayWithMostPoops(ctx context.Context, db *sql.DB, chatID int64, userID int64, year int) (string, int, error) {
+	yearStr := strconv.Itoa(year)
+	start, end := YearPeriod(year).utcBounds()
+	var day string
+	var dumps int
+	err := db.QueryRowContext(ctx, dayWithMostPoopsQuery, chatID, userID, start, end, yearStr, yearStr).Scan(&day, &dumps)
+	if err != nil {
+		return "", 0, err
+	}
+	return day, dumps, nil
+}
+
+func GetYearlyPoopCount(ctx context.Context, db *sql.DB, chatID int64, userID int64, year int) (int, error) {
 	query := `
 	SELECT COUNT(*) AS poop_count
-	FROM poop_tracker
-	WHERE user_id = ? AND strftime('%Y', timestamp) = ?;
+	FROM poop_log
+	WHERE chat_id = ? AND user_id = ? AND created_at_unix >= ? AND created_at_unix < ? AND strftime('%Y', timestamp) = ?;
 	`
+	start, end := YearPeriod(year).utcBounds()
 	var poopCount int
-	err := db.QueryRowContext(ctx, query, userID, strconv.Itoa(year)).Scan(&poopCount)
+	err := db.QueryRowContext(ctx, query, chatID, userID, start, end, strconv.Itoa(year)).Scan(&poopCount)
 	if err != nil {
 		return 0, err
 	}
 	return poopCount, nil
 }
 
-func GetPoopsByHour(ctx context.Context, db *sql.DB, userID int64, year int) ([]HourDistribution, error) {
+func GetPoopsByHour(ctx context.Context, db *sql.DB, chatID int64, userID int64, year int) ([]HourDistribution, error) {
 	query := `
 	SELECT CAST(strftime('%H', timestamp) AS INTEGER) AS hour, COUNT(*) AS poop_count
-	FROM poop_tracker
-	WHERE user_id = ? AND strftime('%Y', timestamp) = ?
+	FROM poop_log
+	WHERE chat_id = ? AND user_id = ? AND created_at_unix >= ? AND created_at_unix < ? AND strftime('%Y', timestamp) = ?
 	GROUP BY hour
 	ORDER BY hour;
 	`
 
-	rows, err := db.QueryContext(ctx, query, userID, strconv.Itoa(year))
+	start, end := YearPeriod(year).utcBounds()
+	rows, err := db.QueryContext(ctx, query, chatID, userID, start, end, strconv.Itoa(year))
 	if err != nil {
 		return nil, err
 	}
@@ -389,7 +465,7 @@ func GetPoopsByHour(ctx context.Context, db *sql.DB, userID int64, year int) ([]
 	return results, nil
 }
 
-func GetPoopsByDayOfWeek(ctx context.Context, db *sql.DB, userID int64, year int) ([]DayOfWeekDistribution, error) {
+func GetPoopsByDayOfWeek(ctx context.Context, db *sql.DB, chatID int64, userID int64, year int) ([]DayOfWeekDistribution, error) {
 	query := `
 	SELECT 
     CASE CAST(strftime('%w', timestamp) AS INTEGER)
@@ -402,8 +478,8 @@ func GetPoopsByDayOfWeek(ctx context.Context, db *sql.DB, userID int64, year int
         WHEN 6 THEN 'Saturday'
     END AS day_of_week,
     COUNT(*) AS poop_count
-	FROM poop_tracker
-	WHERE user_id = ? AND strftime('%Y', timestamp) = ?
+	FROM poop_log
+	WHERE chat_id = ? AND user_id = ? AND created_at_unix >= ? AND created_at_unix < ? AND strftime('%Y', timestamp) = ?
 	GROUP BY day_of_week
 	ORDER BY 
     CASE CAST(strftime('%w', timestamp) AS INTEGER)
@@ -417,7 +493,8 @@ func GetPoopsByDayOfWeek(ctx context.Context, db *sql.DB, userID int64, year int
     END;
 	`
 
-	rows, err := db.QueryContext(ctx, query, userID, strconv.Itoa(year))
+	start, end := YearPeriod(year).utcBounds()
+	rows, err := db.QueryContext(ctx, query, chatID, userID, start, end, strconv.Itoa(year))
 	if err != nil {
 		return nil, err
 	}
@@ -452,45 +529,49 @@ func GetPoopsByDayOfWeek(ctx context.Context, db *sql.DB, userID int64, year int
 	return results, nil
 }
 
-func GetYearlyRanking(ctx context.Context, db *sql.DB, userID int64, year int) (YearlyRanking, error) {
+// GetYearlyRanking ranks userID among the group's poopers for the year, densely like the leaderboards,
+// so members tied on count share a rank
+func GetYearlyRanking(ctx context.Context, db *sql.DB, chatID int64, userID int64, year int) (YearlyRanking, error) {
 	query := `
 	WITH user_stats AS (
 		SELECT user_id, COUNT(*) AS poop_count
-		FROM poop_tracker
-		WHERE strftime('%Y', timestamp) = ?
-		GROUP BY user_id	
+		FROM poop_log
+		WHERE chat_id = ? AND created_at_unix >= ? AND created_at_unix < ? AND strftime('%Y', timestamp) = ?
+		GROUP BY user_id
 	),
 	user_rank AS (
-		SELECT 
+		SELECT
 			user_id,
-			poop_count,
-			ROW_NUMBER() OVER (ORDER BY poop_count DESC) AS rank,
-			COUNT(*) OVER () AS total_users
+			DENSE_RANK() OVER (ORDER BY poop_count DESC) AS rank,
+			COUNT(*) OVER () AS total_users,
+			COUNT(*) OVER (ORDER BY poop_count RANGE BETWEEN UNBOUNDED PRECEDING AND 1 PRECEDING) AS users_below
 		FROM user_stats
 	)
 	SELECT rank, total_users,
-		CAST ((total_users - rank) AS FLOAT) / CAST (total_users AS FLOAT) * 100.0 AS percentage
+		CAST (users_below AS FLOAT) / CAST (total_users AS FLOAT) * 100.0 AS percentage
 	FROM user_rank
 	WHERE user_id = ?;
 	`
 
+	start, end := YearPeriod(year).utcBounds()
 	var yr YearlyRanking
-	err := db.QueryRowContext(ctx, query, strconv.Itoa(year), userID).Scan(&yr.Rank, &yr.TotalUsers, &yr.Percentage)
+	err := db.QueryRowContext(ctx, query, chatID, start, end, strconv.Itoa(year), userID).Scan(&yr.Rank, &yr.TotalUsers, &yr.Percentage)
 	if err != nil {
 		return YearlyRanking{}, err
 	}
 	return yr, nil
 }
 
-func GetGroupYearlyStats(ctx context.Context, db *sql.DB, year int) ([]UserPoopCount, error) {
+func GetGroupYearlyStats(ctx context.Context, db *sql.DB, chatID int64, year int) ([]UserPoopCount, error) {
 	query := `
-	SELECT username, COUNT(*) AS poop_count
-	FROM poop_tracker
-	WHERE strftime('%Y', timestamp) = ?
+	SELECT display_name, COUNT(*) AS poop_count, DENSE_RANK() OVER (ORDER BY COUNT(*) DESC) AS poop_rank
+	FROM poop_log
+	WHERE chat_id = ? AND created_at_unix >= ? AND created_at_unix < ? AND strftime('%Y', timestamp) = ?
 	GROUP BY user_id
-	ORDER BY poop_count DESC;
+	ORDER BY poop_rank, display_name COLLATE NOCASE;
 	`
-	rows, err := db.QueryContext(ctx, query, strconv.Itoa(year))
+	start, end := YearPeriod(year).utcBounds()
+	rows, err := db.QueryContext(ctx, query, chatID, start, end, strconv.Itoa(year))
 	if err != nil {
 		return nil, err
 	}
@@ -499,7 +580,7 @@ func GetGroupYearlyStats(ctx context.Context, db *sql.DB, year int) ([]UserPoopC
 	var results []UserPoopCount
 	for rows.Next() {
 		var upc UserPoopCount
-		if err := rows.Scan(&upc.Username, &upc.PoopCount); err != nil {
+		if err := rows.Scan(&upc.Username, &upc.PoopCount, &upc.Rank); err != nil {
 			return nil, err
 		}
 		results = append(results, upc)
@@ -512,23 +593,25 @@ func GetGroupYearlyStats(ctx context.Context, db *sql.DB, year int) ([]UserPoopC
 	return results, nil
 }
 
-func GetGroupAwards(ctx context.Context, db *sql.DB, year int) ([]GroupAward, error) {
+// GetGroupAwards picks the year's winner of each award, ties go to the lowest user ID so the winner doesn't change between runs
+func GetGroupAwards(ctx context.Context, db *sql.DB, chatID int64, year int) ([]GroupAward, error) {
 	var awards []GroupAward
 	yearStr := strconv.Itoa(year)
+	start, end := YearPeriod(year).utcBounds()
 
 	// Award 1: Early Bird (Most poops 05:00-08:00)
 	earlyBirdQuery := `
-	SELECT username, COUNT(*) AS count
-	FROM poop_tracker
-	WHERE strftime('%Y', timestamp) = ?
+	SELECT display_name, COUNT(*) AS count
+	FROM poop_log
+	WHERE chat_id = ? AND created_at_unix >= ? AND created_at_unix < ? AND strftime('%Y', timestamp) = ?
 	  AND CAST(strftime('%H', timestamp) AS INTEGER) BETWEEN 5 AND 8
 	GROUP BY user_id
-	ORDER BY count DESC
+	ORDER BY count DESC, user_id
 	LIMIT 1;
 	`
 	var earlyBirdWinner string
 	var earlyBirdCount int
-	err := db.QueryRowContext(ctx, earlyBirdQuery, yearStr).Scan(&earlyBirdWinner, &earlyBirdCount)
+	err := db.QueryRowContext(ctx, earlyBirdQuery, chatID, start, end, yearStr).Scan(&earlyBirdWinner, &earlyBirdCount)
 	if err == nil && earlyBirdCount > 0 {
 		awards = append(awards, GroupAward{
 			AwardName: "Early Bird",
@@ -540,18 +623,18 @@ func GetGroupAwards(ctx context.Context, db *sql.DB, year int) ([]GroupAward, er
 
 	// Award 2: Night Owl (Most poops 23:00-04:00)
 	nightOwlQuery := `
-	SELECT username, COUNT(*) AS count
-	FROM poop_tracker
-	WHERE strftime('%Y', timestamp) = ?
+	SELECT display_name, COUNT(*) AS count
+	FROM poop_log
+	WHERE chat_id = ? AND created_at_unix >= ? AND created_at_unix < ? AND strftime('%Y', timestamp) = ?
 	  AND (CAST(strftime('%H', timestamp) AS INTEGER) >= 23 
 	       OR CAST(strftime('%H', timestamp) AS INTEGER) <= 4)
 	GROUP BY user_id
-	ORDER BY count DESC
+	ORDER BY count DESC, user_id
 	LIMIT 1;
 	`
 	var nightOwlWinner string
 	var nightOwlCount int
-	err = db.QueryRowContext(ctx, nightOwlQuery, yearStr).Scan(&nightOwlWinner, &nightOwlCount)
+	err = db.QueryRowContext(ctx, nightOwlQuery, chatID, start, end, yearStr).Scan(&nightOwlWinner, &nightOwlCount)
 	if err == nil && nightOwlCount > 0 {
 		awards = append(awards, GroupAward{
 			AwardName: "Night Owl",
@@ -563,20 +646,20 @@ func GetGroupAwards(ctx context.Context, db *sql.DB, year int) ([]GroupAward, er
 
 	// Award 3: Machine Gun (Most poops in single day)
 	machineGunQuery := `
-	SELECT username, MAX(daily_count) AS max_poops
+	SELECT display_name, MAX(daily_count) AS max_poops
 	FROM (
-		SELECT user_id, username, date(timestamp) AS day, COUNT(*) AS daily_count
-		FROM poop_tracker
-		WHERE strftime('%Y', timestamp) = ?
+		SELECT user_id, display_name, date(timestamp) AS day, COUNT(*) AS daily_count
+		FROM poop_log
+		WHERE chat_id = ? AND created_at_unix >= ? AND created_at_unix < ? AND strftime('%Y', timestamp) = ?
 		GROUP BY user_id, day
 	) AS daily_stats
 	GROUP BY user_id
-	ORDER BY max_poops DESC
+	ORDER BY max_poops DESC, user_id
 	LIMIT 1;
 	`
 	var machineGunWinner string
 	var machineGunCount int
-	err = db.QueryRowContext(ctx, machineGunQuery, yearStr).Scan(&machineGunWinner, &machineGunCount)
+	err = db.QueryRowContext(ctx, machineGunQuery, chatID, start, end, yearStr).Scan(&machineGunWinner, &machineGunCount)
 	if err == nil && machineGunCount > 0 {
 		awards = append(awards, GroupAward{
 			AwardName: "Machine Gun",
@@ -592,16 +675,16 @@ func GetGroupAwards(ctx context.Context, db *sql.DB, year int) ([]GroupAward, er
 	WITH daily_poops AS (
 		SELECT 
 			user_id,
-			username,
+			display_name,
 			date(timestamp) AS day
-		FROM poop_tracker
-		WHERE strftime('%Y', timestamp) = ?
+		FROM poop_log
+		WHERE chat_id = ? AND created_at_unix >= ? AND created_at_unix < ? AND strftime('%Y', timestamp) = ?
 		GROUP BY user_id, day
 	),
 	streaks AS (
 		SELECT 
 			user_id,
-			username,
+			display_name,
 			day,
 			ROW_NUMBER() OVER (PARTITION BY user_id ORDER BY day) - 
 			julianday(day) AS streak_group
@@ -610,28 +693,28 @@ func GetGroupAwards(ctx context.Context, db *sql.DB, year int) ([]GroupAward, er
 	streak_lengths AS (
 		SELECT 
 			user_id,
-			username,
+			display_name,
 			streak_group,
 			COUNT(*) AS streak_count
 		FROM streaks
-		GROUP BY user_id, username, streak_group
+		GROUP BY user_id, display_name, streak_group
 	),
 	max_streaks AS (
 		SELECT 
 			user_id,
-			username,
+			display_name,
 			MAX(streak_count) AS max_streak
 		FROM streak_lengths
-		GROUP BY user_id, username
+		GROUP BY user_id, display_name
 	)
-	SELECT username, max_streak
+	SELECT display_name, max_streak
 	FROM max_streaks
-	ORDER BY max_streak DESC
+	ORDER BY max_streak DESC, user_id
 	LIMIT 1;
 	`
 	var consistencyWinner string
 	var consistencyStreak int
-	err = db.QueryRowContext(ctx, consistencyQuery, yearStr).Scan(&consistencyWinner, &consistencyStreak)
+	err = db.QueryRowContext(ctx, consistencyQuery, chatID, start, end, yearStr).Scan(&consistencyWinner, &consistencyStreak)
 	if err == nil && consistencyStreak > 0 {
 		awards = append(awards, GroupAward{
 			AwardName: "Consistency King",
@@ -646,22 +729,22 @@ func GetGroupAwards(ctx context.Context, db *sql.DB, year int) ([]GroupAward, er
 	WITH user_stats AS (
 		SELECT 
 			user_id,
-			username,
+			display_name,
 			COUNT(*) AS total_poops,
 			SUM(CASE WHEN CAST(strftime('%w', timestamp) AS INTEGER) IN (0, 6) THEN 1 ELSE 0 END) AS weekend_poops
-		FROM poop_tracker
-		WHERE strftime('%Y', timestamp) = ?
+		FROM poop_log
+		WHERE chat_id = ? AND created_at_unix >= ? AND created_at_unix < ? AND strftime('%Y', timestamp) = ?
 		GROUP BY user_id
 	)
-	SELECT username, CAST(weekend_poops AS FLOAT) / CAST(total_poops AS FLOAT) * 100.0 AS weekend_percentage
+	SELECT display_name, CAST(weekend_poops AS FLOAT) / CAST(total_poops AS FLOAT) * 100.0 AS weekend_percentage
 	FROM user_stats
 	WHERE total_poops > 0
-	ORDER BY weekend_percentage DESC
+	ORDER BY weekend_percentage DESC, user_id
 	LIMIT 1;
 	`
 	var weekendWinner string
 	var weekendPercentage float64
-	err = db.QueryRowContext(ctx, weekendWarriorQuery, yearStr).Scan(&weekendWinner, &weekendPercentage)
+	err = db.QueryRowContext(ctx, weekendWarriorQuery, chatID, start, end, yearStr).Scan(&weekendWinner, &weekendPercentage)
 	if err == nil && weekendPercentage > 0 {
 		awards = append(awards, GroupAward{
 			AwardName: "Weekend Warrior",
@@ -673,17 +756,17 @@ func GetGroupAwards(ctx context.Context, db *sql.DB, year int) ([]GroupAward, er
 
 	// Award 6: Boss makes a dollar, I make a dime (Most poops 09:00-18:00)
 	companyTimeQuery := `
-	SELECT username, COUNT(*) AS count
-	FROM poop_tracker
-	WHERE strftime('%Y', timestamp) = ?
+	SELECT display_name, COUNT(*) AS count
+	FROM poop_log
+	WHERE chat_id = ? AND created_at_unix >= ? AND created_at_unix < ? AND strftime('%Y', timestamp) = ?
 	  AND CAST(strftime('%H', timestamp) AS INTEGER) BETWEEN 9 AND 18
 	GROUP BY user_id
-	ORDER BY count DESC
+	ORDER BY count DESC, user_id
 	LIMIT 1;
 	`
 	var companyTimeWinner string
 	var companyTimeCount int
-	err = db.QueryRowContext(ctx, companyTimeQuery, yearStr).Scan(&companyTimeWinner, &companyTimeCount)
+	err = db.QueryRowContext(ctx, companyTimeQuery, chatID, start, end, yearStr).Scan(&companyTimeWinner, &companyTimeCount)
 	if err == nil && companyTimeCount > 0 {
 		awards = append(awards, GroupAward{
 			AwardName: "Boss makes a dollar, I make a dime",
@@ -696,35 +779,100 @@ func GetGroupAwards(ctx context.Context, db *sql.DB, year int) ([]GroupAward, er
 	return awards, nil
 }
 
-func createTable(ctx context.Context, db *sql.DB) error {
+// RegisterGroup registers a group chat, the timezone only applies to groups that weren't registered yet
+func RegisterGroup(ctx context.Context, db *sql.DB, chatID int64, title string, timezone string) error {
+	if err := utils.ValidateTimezone(timezone); err != nil {
+		return err
+	}
+
 	query := `
-	CREATE TABLE IF NOT EXISTS poop_tracker (
-	    id INTEGER PRIMARY KEY AUTOINCREMENT,
-	    user_id INTEGER NOT NULL,
-	    username TEXT NOT NULL,
-		message_id INTEGER UNIQUE NOT NULL,
-	    timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
-        created_at_unix INTEGER NOT NULL
-	);
+	INSERT INTO groups (chat_id, title, timezone)
+	VALUES (?, ?, ?)
+	ON CONFLICT (chat_id) DO UPDATE SET title = excluded.title
+	WHERE excluded.title != '';
 	`
-	_, err := db.ExecContext(ctx, query)
+	_, err := db.ExecContext(ctx, query, chatID, title, timezone)
 	return err
 }
 
+func IsRegisteredGroup(ctx context.Context, db *sql.DB, chatID int64) (bool, error) {
+	query := `
+	SELECT EXISTS (SELECT 1 FROM groups WHERE chat_id = ?);
+	`
+	var registered bool
+	err := db.QueryRowContext(ctx, query, chatID).Scan(&registered)
+	if err != nil {
+		return false, err
+	}
+	return registered, nil
+}
+
+func GetGroups(ctx context.Context, db *sql.DB) ([]Group, error) {
+	query := `
+	SELECT chat_id, title, timezone
+	FROM groups
+	ORDER BY registered_at, chat_id;
+	`
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []Group
+	for rows.Next() {
+		var g Group
+		if err := rows.Scan(&g.ChatID, &g.Title, &g.Timezone); err != nil {
+			return nil, err
+		}
+		groups = append(groups, g)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return groups, nil
+}
+
+// ClaimUnscopedLogs assigns logs recorded before chats were tracked to the given chat
+func ClaimUnscopedLogs(ctx context.Context, db *sql.DB, chatID int64) (int64, error) {
+	query := `
+	UPDATE poop_tracker
+	SET chat_id = ?
+	WHERE chat_id = 0;
+	`
+	result, err := db.ExecContext(ctx, query, chatID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// busyTimeout is how long a connection waits for another one's write to finish before failing with SQLITE_BUSY.
+// Jobs catch up while updates are handled, so writes from both can meet.
+const busyTimeout = 5 * time.Second
+
+// OpenDBConnection opens the database in WAL mode, where readers don't block writers, and migrates it
 func OpenDBConnection(cfg *config.Config) (*sql.DB, error) {
-	db, err := sql.Open("sqlite", cfg.DBPath)
+	separator := "?"
+	if strings.Contains(cfg.DBPath, "?") {
+		separator = "&"
+	}
+	dsn := fmt.Sprintf("%s%s_pragma=busy_timeout(%d)&_pragma=journal_mode(WAL)", cfg.DBPath, separator, busyTimeout.Milliseconds())
+	db, err := sql.Open("sqlite", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to SQLite database: %w", err)
 	}
 
 	ctx := context.Background()
-	err = createTable(ctx, db)
+	err = migrate(ctx, db)
 	if err != nil {
 		db.Close()
-		return nil, fmt.Errorf("failed to create table: %w", err)
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
 	}
 
-	log.Println("Table created or already exists.")
+	slog.Info("Database schema is up to date.")
 	return db, nil
 }
 
@@ -742,3 +890,12 @@ func HealthCheck(ctx context.Context, db *sql.DB) error {
 	}
 	return nil
 }
+
+// CloseDBConnection writes everything still in the write-ahead log to the database file, so the file holds every log on its own, and closes it
+func CloseDBConnection(db *sql.DB) error {
+	if _, err := db.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		db.Close()
+		return fmt.Errorf("failed to checkpoint the database: %w", err)
+	}
+	return db.Close()
+}
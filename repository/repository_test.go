@@ -3,12 +3,22 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
 	"testing"
 	"time"
 
+	"src/config"
+
 	_ "modernc.org/sqlite"
 )
 
+// testChatID is the group chat all shared test data is logged in
+const testChatID = int64(-100123)
+
 // setupTestDB creates a temporary in-memory database for testing
 func setupTestDB(t *testing.T) (*sql.DB, func()) {
 	db, err := sql.Open("sqlite", ":memory:")
@@ -16,11 +26,14 @@ func setupTestDB(t *testing.T) (*sql.DB, func()) {
 		t.Fatalf("Failed to open test database: %v", err)
 	}
 
+	// Every connection to :memory: is a separate database, so keep a single one
+	db.SetMaxOpenConns(1)
+
 	ctx := context.Background()
-	err = createTable(ctx, db)
+	err = migrate(ctx, db)
 	if err != nil {
 		db.Close()
-		t.Fatalf("Failed to create test table: %v", err)
+		t.Fatalf("Failed to migrate test database: %v", err)
 	}
 
 	// Return cleanup function
@@ -42,7 +55,7 @@ func insertTestData(t *testing.T, db *sql.DB) {
 	aliceUsername := "alice"
 	for i := 0; i < 5; i++ {
 		timestamp := baseTime.AddDate(0, 0, i*7).Add(time.Hour * time.Duration(8+i%3))
-		err := LogPoop(ctx, db, aliceID, aliceUsername, int64(1000+i), timestamp.Format("2006-01-02 15:04:05"), timestamp.Unix())
+		err := LogPoop(ctx, db, testChatID, aliceID, aliceUsername, int64(1000+i), timestamp.Format("2006-01-02 15:04:05"), timestamp.Unix())
 		if err != nil {
 			t.Fatalf("Failed to insert test data: %v", err)
 		}
@@ -55,7 +68,7 @@ func insertTestData(t *testing.T, db *sql.DB) {
 	// Create a 3-day streak
 	for day := 0; day < 3; day++ {
 		timestamp := baseTime.AddDate(0, 0, day).Add(time.Hour * 23) // 11 PM each day
-		err := LogPoop(ctx, db, bobID, bobUsername, int64(2000+day), timestamp.Format("2006-01-02 15:04:05"), timestamp.Unix())
+		err := LogPoop(ctx, db, testChatID, bobID, bobUsername, int64(2000+day), timestamp.Format("2006-01-02 15:04:05"), timestamp.Unix())
 		if err != nil {
 			t.Fatalf("Failed to insert test data: %v", err)
 		}
@@ -63,7 +76,7 @@ func insertTestData(t *testing.T, db *sql.DB) {
 	// Add more poops throughout January
 	for i := 0; i < 7; i++ {
 		timestamp := baseTime.AddDate(0, 0, 5+i*3).Add(time.Hour * time.Duration(1+i%2)) // 1-2 AM
-		err := LogPoop(ctx, db, bobID, bobUsername, int64(2010+i), timestamp.Format("2006-01-02 15:04:05"), timestamp.Unix())
+		err := LogPoop(ctx, db, testChatID, bobID, bobUsername, int64(2010+i), timestamp.Format("2006-01-02 15:04:05"), timestamp.Unix())
 		if err != nil {
 			t.Fatalf("Failed to insert test data: %v", err)
 		}
@@ -77,7 +90,7 @@ func insertTestData(t *testing.T, db *sql.DB) {
 	weekendDays := []int{4, 5, 11, 12, 18, 19} // Saturdays and Sundays in January 2025
 	for i, day := range weekendDays {
 		timestamp := baseTime.AddDate(0, 0, day).Add(time.Hour * 10) // 10 AM
-		err := LogPoop(ctx, db, charlieID, charlieUsername, int64(3000+i), timestamp.Format("2006-01-02 15:04:05"), timestamp.Unix())
+		err := LogPoop(ctx, db, testChatID, charlieID, charlieUsername, int64(3000+i), timestamp.Format("2006-01-02 15:04:05"), timestamp.Unix())
 		if err != nil {
 			t.Fatalf("Failed to insert test data: %v", err)
 		}
@@ -85,7 +98,7 @@ func insertTestData(t *testing.T, db *sql.DB) {
 	// Add 2 more weekend poops
 	for i := 0; i < 2; i++ {
 		timestamp := baseTime.AddDate(0, 0, weekendDays[i]).Add(time.Hour * 15) // 3 PM same day
-		err := LogPoop(ctx, db, charlieID, charlieUsername, int64(3010+i), timestamp.Format("2006-01-02 15:04:05"), timestamp.Unix())
+		err := LogPoop(ctx, db, testChatID, charlieID, charlieUsername, int64(3010+i), timestamp.Format("2006-01-02 15:04:05"), timestamp.Unix())
 		if err != nil {
 			t.Fatalf("Failed to insert test data: %v", err)
 		}
@@ -97,7 +110,7 @@ func insertTestData(t *testing.T, db *sql.DB) {
 	bigDay := baseTime.AddDate(0, 0, 14) // Jan 15
 	for i := 0; i < 5; i++ {
 		timestamp := bigDay.Add(time.Hour * time.Duration(8+i*3)) // 8 AM, 11 AM, 2 PM, 5 PM, 8 PM
-		err := LogPoop(ctx, db, machineGunID, machineGunUsername, int64(4000+i), timestamp.Format("2006-01-02 15:04:05"), timestamp.Unix())
+		err := LogPoop(ctx, db, testChatID, machineGunID, machineGunUsername, int64(4000+i), timestamp.Format("2006-01-02 15:04:05"), timestamp.Unix())
 		if err != nil {
 			t.Fatalf("Failed to insert test data: %v", err)
 		}
@@ -108,7 +121,7 @@ func insertTestData(t *testing.T, db *sql.DB) {
 	earlyBirdUsername := "early_bird"
 	for i := 0; i < 6; i++ {
 		timestamp := baseTime.AddDate(0, 0, i*4).Add(time.Hour * time.Duration(6+i%3)) // 6-8 AM
-		err := LogPoop(ctx, db, earlyBirdID, earlyBirdUsername, int64(5000+i), timestamp.Format("2006-01-02 15:04:05"), timestamp.Unix())
+		err := LogPoop(ctx, db, testChatID, earlyBirdID, earlyBirdUsername, int64(5000+i), timestamp.Format("2006-01-02 15:04:05"), timestamp.Unix())
 		if err != nil {
 			t.Fatalf("Failed to insert test data: %v", err)
 		}
@@ -121,7 +134,7 @@ func insertTestData(t *testing.T, db *sql.DB) {
 	for i := 0; i < 8; i++ {
 		hour := companyHours[i%len(companyHours)]
 		timestamp := baseTime.AddDate(0, 0, i*3).Add(time.Hour * time.Duration(hour))
-		err := LogPoop(ctx, db, companyTimeID, companyTimeUsername, int64(6000+i), timestamp.Format("2006-01-02 15:04:05"), timestamp.Unix())
+		err := LogPoop(ctx, db, testChatID, companyTimeID, companyTimeUsername, int64(6000+i), timestamp.Format("2006-01-02 15:04:05"), timestamp.Unix())
 		if err != nil {
 			t.Fatalf("Failed to insert test data: %v", err)
 		}
@@ -131,7 +144,7 @@ func insertTestData(t *testing.T, db *sql.DB) {
 	baseTime2024 := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
 	for i := 0; i < 3; i++ {
 		timestamp := baseTime2024.AddDate(0, 0, i*10).Add(time.Hour * 12)
-		err := LogPoop(ctx, db, aliceID, aliceUsername, int64(7000+i), timestamp.Format("2006-01-02 15:04:05"), timestamp.Unix())
+		err := LogPoop(ctx, db, testChatID, aliceID, aliceUsername, int64(7000+i), timestamp.Format("2006-01-02 15:04:05"), timestamp.Unix())
 		if err != nil {
 			t.Fatalf("Failed to insert test data: %v", err)
 		}
@@ -161,7 +174,7 @@ func TestGetYearlyPoopCount(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := GetYearlyPoopCount(ctx, db, tt.userID, tt.year)
+			result, err := GetYearlyPoopCount(ctx, db, testChatID, tt.userID, tt.year)
 			if err != nil {
 				t.Fatalf("GetYearlyPoopCount() error = %v", err)
 			}
@@ -179,7 +192,7 @@ func TestGetPoopsByHour(t *testing.T) {
 
 	ctx := context.Background()
 
-	result, err := GetPoopsByHour(ctx, db, 1001, 2025) // Alice
+	result, err := GetPoopsByHour(ctx, db, testChatID, 1001, 2025) // Alice
 	if err != nil {
 		t.Fatalf("GetPoopsByHour() error = %v", err)
 	}
@@ -225,7 +238,7 @@ func TestGetPoopsByDayOfWeek(t *testing.T) {
 
 	ctx := context.Background()
 
-	result, err := GetPoopsByDayOfWeek(ctx, db, 1003, 2025) // Charlie (weekend warrior)
+	result, err := GetPoopsByDayOfWeek(ctx, db, testChatID, 1003, 2025) // Charlie (weekend warrior)
 	if err != nil {
 		t.Fatalf("GetPoopsByDayOfWeek() error = %v", err)
 	}
@@ -268,12 +281,12 @@ func TestGetYearlyRanking(t *testing.T) {
 	ctx := context.Background()
 
 	// Bob has 10 poops, should rank higher than Alice (5 poops)
-	bobRanking, err := GetYearlyRanking(ctx, db, 1002, 2025) // Bob
+	bobRanking, err := GetYearlyRanking(ctx, db, testChatID, 1002, 2025) // Bob
 	if err != nil {
 		t.Fatalf("GetYearlyRanking() error = %v", err)
 	}
 
-	aliceRanking, err := GetYearlyRanking(ctx, db, 1001, 2025) // Alice
+	aliceRanking, err := GetYearlyRanking(ctx, db, testChatID, 1001, 2025) // Alice
 	if err != nil {
 		t.Fatalf("GetYearlyRanking() error = %v", err)
 	}
@@ -306,7 +319,7 @@ func TestGetGroupYearlyStats(t *testing.T) {
 
 	ctx := context.Background()
 
-	result, err := GetGroupYearlyStats(ctx, db, 2025)
+	result, err := GetGroupYearlyStats(ctx, db, testChatID, 2025)
 	if err != nil {
 		t.Fatalf("GetGroupYearlyStats() error = %v", err)
 	}
@@ -336,7 +349,7 @@ func TestGetGroupAwards(t *testing.T) {
 
 	ctx := context.Background()
 
-	awards, err := GetGroupAwards(ctx, db, 2025)
+	awards, err := GetGroupAwards(ctx, db, testChatID, 2025)
 	if err != nil {
 		t.Fatalf("GetGroupAwards() error = %v", err)
 	}
@@ -389,10 +402,10 @@ func TestGetGroupAwards(t *testing.T) {
 		}
 	}
 
-	// Boss makes a dollar, I make a dime (should be company_time)
+	// Boss makes a dollar, I make a dime (charlie ties company_time on 8 and has the lower user ID)
 	if companyTime, ok := awardMap["Boss makes a dollar, I make a dime"]; ok {
-		if companyTime.Winner != "company_time" {
-			t.Errorf("Company Time winner = %s, want company_time", companyTime.Winner)
+		if companyTime.Winner != "charlie" {
+			t.Errorf("Company Time winner = %s, want charlie", companyTime.Winner)
 		}
 		if companyTime.Emoji != "💰" {
 			t.Errorf("Company Time emoji = %s, want 💰", companyTime.Emoji)
@@ -413,7 +426,7 @@ func TestCompanyTimeAward(t *testing.T) {
 	ctx := context.Background()
 
 	// Test the company time award specifically
-	awards, err := GetGroupAwards(ctx, db, 2025)
+	awards, err := GetGroupAwards(ctx, db, testChatID, 2025)
 	if err != nil {
 		t.Fatalf("GetGroupAwards() error = %v", err)
 	}
@@ -431,9 +444,9 @@ func TestCompanyTimeAward(t *testing.T) {
 		t.Fatal("Company Time award not found")
 	}
 
-	// Verify the winner
-	if companyTimeAward.Winner != "company_time" {
-		t.Errorf("Company Time winner = %s, want company_time", companyTimeAward.Winner)
+	// Verify the winner, charlie ties company_time and has the lower user ID
+	if companyTimeAward.Winner != "charlie" {
+		t.Errorf("Company Time winner = %s, want charlie", companyTimeAward.Winner)
 	}
 
 	// Verify the count (should be 8 poops during 9-18)
@@ -459,7 +472,7 @@ func TestCompanyTimeAward_EdgeCases(t *testing.T) {
 	for i := 0; i < 5; i++ {
 		// All poops at 10 AM (company time)
 		timestamp := baseTime.AddDate(0, 0, i).Add(time.Hour * 10)
-		err := LogPoop(ctx, db, userID, "workaholic", int64(10000+i), timestamp.Format("2006-01-02 15:04:05"), timestamp.Unix())
+		err := LogPoop(ctx, db, testChatID, userID, "workaholic", int64(10000+i), timestamp.Format("2006-01-02 15:04:05"), timestamp.Unix())
 		if err != nil {
 			t.Fatalf("Failed to insert test data: %v", err)
 		}
@@ -470,13 +483,13 @@ func TestCompanyTimeAward_EdgeCases(t *testing.T) {
 	for i := 0; i < 3; i++ {
 		// All poops at 7 AM (before company time)
 		timestamp := baseTime.AddDate(0, 0, i).Add(time.Hour * 7)
-		err := LogPoop(ctx, db, userID2, "early_riser", int64(20000+i), timestamp.Format("2006-01-02 15:04:05"), timestamp.Unix())
+		err := LogPoop(ctx, db, testChatID, userID2, "early_riser", int64(20000+i), timestamp.Format("2006-01-02 15:04:05"), timestamp.Unix())
 		if err != nil {
 			t.Fatalf("Failed to insert test data: %v", err)
 		}
 	}
 
-	awards, err := GetGroupAwards(ctx, db, 2025)
+	awards, err := GetGroupAwards(ctx, db, testChatID, 2025)
 	if err != nil {
 		t.Fatalf("GetGroupAwards() error = %v", err)
 	}
@@ -503,6 +516,31 @@ func TestCompanyTimeAward_EdgeCases(t *testing.T) {
 	}
 }
 
+func TestGetGroupAwards_Ties(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	// Both log once at 06:00 on the same Wednesday, zed first
+	at := time.Date(2025, 3, 5, 6, 0, 0, 0, time.UTC)
+	logPoopAt(t, db, 2002, "zed", 1, at)
+	logPoopAt(t, db, 2001, "amy", 2, at.Add(time.Minute))
+
+	awards, err := GetGroupAwards(ctx, db, testChatID, 2025)
+	if err != nil {
+		t.Fatalf("GetGroupAwards() error = %v", err)
+	}
+	if len(awards) != 3 {
+		t.Fatalf("GetGroupAwards() = %+v, want Early Bird, Machine Gun and Consistency King", awards)
+	}
+	for _, award := range awards {
+		if award.Winner != "amy" {
+			t.Errorf("%s winner = %s, want amy, the lowest user ID of the tied members", award.AwardName, award.Winner)
+		}
+	}
+}
+
 func TestGetYearlyRanking_EdgeCases(t *testing.T) {
 	db, cleanup := setupTestDB(t)
 	defer cleanup()
@@ -512,12 +550,12 @@ func TestGetYearlyRanking_EdgeCases(t *testing.T) {
 	// Test with single user
 	aliceID := int64(1001)
 	baseTime := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
-	err := LogPoop(ctx, db, aliceID, "alice", 1, baseTime.Format("2006-01-02 15:04:05"), baseTime.Unix())
+	err := LogPoop(ctx, db, testChatID, aliceID, "alice", 1, baseTime.Format("2006-01-02 15:04:05"), baseTime.Unix())
 	if err != nil {
 		t.Fatalf("Failed to insert test data: %v", err)
 	}
 
-	ranking, err := GetYearlyRanking(ctx, db, aliceID, 2025)
+	ranking, err := GetYearlyRanking(ctx, db, testChatID, aliceID, 2025)
 	if err != nil {
 		t.Fatalf("GetYearlyRanking() error = %v", err)
 	}
@@ -533,6 +571,40 @@ func TestGetYearlyRanking_EdgeCases(t *testing.T) {
 	}
 }
 
+func TestGetYearlyRanking_Ties(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	day := time.Date(2025, 3, 1, 8, 0, 0, 0, time.UTC)
+
+	// alice and bob both have 2, charlie has 1
+	logPoopAt(t, db, 1001, "alice", 1, day)
+	logPoopAt(t, db, 1001, "alice", 2, day.Add(time.Hour))
+	logPoopAt(t, db, 1002, "bob", 3, day)
+	logPoopAt(t, db, 1002, "bob", 4, day.Add(time.Hour))
+	logPoopAt(t, db, 1003, "charlie", 5, day)
+
+	tests := []struct {
+		userID int64
+		want   YearlyRanking
+	}{
+		{1001, YearlyRanking{Rank: 1, TotalUsers: 3, Percentage: 100.0 / 3}},
+		{1002, YearlyRanking{Rank: 1, TotalUsers: 3, Percentage: 100.0 / 3}},
+		{1003, YearlyRanking{Rank: 2, TotalUsers: 3, Percentage: 0}},
+	}
+
+	for _, tt := range tests {
+		got, err := GetYearlyRanking(ctx, db, testChatID, tt.userID, 2025)
+		if err != nil {
+			t.Fatalf("GetYearlyRanking(%d) error = %v", tt.userID, err)
+		}
+		if got.Rank != tt.want.Rank || got.TotalUsers != tt.want.TotalUsers || math.Abs(got.Percentage-tt.want.Percentage) > 0.01 {
+			t.Errorf("GetYearlyRanking(%d) = %+v, want %+v", tt.userID, got, tt.want)
+		}
+	}
+}
+
 func TestGetPoopsByHour_AllHoursPresent(t *testing.T) {
 	db, cleanup := setupTestDB(t)
 	defer cleanup()
@@ -544,13 +616,13 @@ func TestGetPoopsByHour_AllHoursPresent(t *testing.T) {
 	userID := int64(2000)
 	for hour := 0; hour < 24; hour++ {
 		timestamp := baseTime.Add(time.Hour * time.Duration(hour))
-		err := LogPoop(ctx, db, userID, "testuser", int64(10000+hour), timestamp.Format("2006-01-02 15:04:05"), timestamp.Unix())
+		err := LogPoop(ctx, db, testChatID, userID, "testuser", int64(10000+hour), timestamp.Format("2006-01-02 15:04:05"), timestamp.Unix())
 		if err != nil {
 			t.Fatalf("Failed to insert test data: %v", err)
 		}
 	}
 
-	result, err := GetPoopsByHour(ctx, db, userID, 2025)
+	result, err := GetPoopsByHour(ctx, db, testChatID, userID, 2025)
 	if err != nil {
 		t.Fatalf("GetPoopsByHour() error = %v", err)
 	}
@@ -583,13 +655,13 @@ func TestGetPoopsByDayOfWeek_AllDaysPresent(t *testing.T) {
 	daysToAdd := []int{0, 1, 2, 3, 4, 5, 6} // Wed, Thu, Fri, Sat, Sun, Mon, Tue
 	for i, dayOffset := range daysToAdd {
 		timestamp := baseTime.AddDate(0, 0, dayOffset)
-		err := LogPoop(ctx, db, userID, "testuser", int64(20000+i), timestamp.Format("2006-01-02 15:04:05"), timestamp.Unix())
+		err := LogPoop(ctx, db, testChatID, userID, "testuser", int64(20000+i), timestamp.Format("2006-01-02 15:04:05"), timestamp.Unix())
 		if err != nil {
 			t.Fatalf("Failed to insert test data: %v", err)
 		}
 	}
 
-	result, err := GetPoopsByDayOfWeek(ctx, db, userID, 2025)
+	result, err := GetPoopsByDayOfWeek(ctx, db, testChatID, userID, 2025)
 	if err != nil {
 		t.Fatalf("GetPoopsByDayOfWeek() error = %v", err)
 	}
@@ -608,7 +680,294 @@ func TestGetPoopsByDayOfWeek_AllDaysPresent(t *testing.T) {
 	}
 }
 
+func TestChatIsolation(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	ctx := context.Background()
+	otherChatID := int64(-100456)
+	baseTime := time.Date(2025, 1, 10, 12, 0, 0, 0, time.UTC)
+
+	// Alice also logs in another group, reusing message IDs that exist in the test chat
+	for i := 0; i < 4; i++ {
+		timestamp := baseTime.AddDate(0, 0, i)
+		err := LogPoop(ctx, db, otherChatID, 1001, "alice", int64(1000+i), timestamp.Format("2006-01-02 15:04:05"), timestamp.Unix())
+		if err != nil {
+			t.Fatalf("Failed to log poop in second chat: %v", err)
+		}
+	}
+
+	count, err := GetYearlyPoopCount(ctx, db, testChatID, 1001, 2025)
+	if err != nil {
+		t.Fatalf("GetYearlyPoopCount() error = %v", err)
+	}
+	if count != 5 {
+		t.Errorf("GetYearlyPoopCount() in test chat = %d, want 5", count)
+	}
+
+	count, err = GetYearlyPoopCount(ctx, db, otherChatID, 1001, 2025)
+	if err != nil {
+		t.Fatalf("GetYearlyPoopCount() error = %v", err)
+	}
+	if count != 4 {
+		t.Errorf("GetYearlyPoopCount() in other chat = %d, want 4", count)
+	}
+
+	stats, err := GetGroupYearlyStats(ctx, db, otherChatID, 2025)
+	if err != nil {
+		t.Fatalf("GetGroupYearlyStats() error = %v", err)
+	}
+	if len(stats) != 1 || stats[0].Username != "alice" {
+		t.Errorf("GetGroupYearlyStats() in other chat = %v, want only alice", stats)
+	}
+
+	// The same message can't be logged twice in one chat
+	err = LogPoop(ctx, db, otherChatID, 1001, "alice", 1000, baseTime.Format("2006-01-02 15:04:05"), baseTime.Unix())
+	if err == nil {
+		t.Error("LogPoop() accepted a duplicate message ID in the same chat")
+	}
+}
+
+func TestGroups(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	registered, err := IsRegisteredGroup(ctx, db, testChatID)
+	if err != nil {
+		t.Fatalf("IsRegisteredGroup() error = %v", err)
+	}
+	if registered {
+		t.Error("IsRegisteredGroup() = true before registering")
+	}
+
+	if err := RegisterGroup(ctx, db, testChatID, "Poopers", "UTC"); err != nil {
+		t.Fatalf("RegisterGroup() error = %v", err)
+	}
+	// Registering again keeps the existing title and timezone
+	if err := RegisterGroup(ctx, db, testChatID, "", "Europe/Lisbon"); err != nil {
+		t.Fatalf("RegisterGroup() error = %v", err)
+	}
+
+	registered, err = IsRegisteredGroup(ctx, db, testChatID)
+	if err != nil {
+		t.Fatalf("IsRegisteredGroup() error = %v", err)
+	}
+	if !registered {
+		t.Error("IsRegisteredGroup() = false after registering")
+	}
+
+	groups, err := GetGroups(ctx, db)
+	if err != nil {
+		t.Fatalf("GetGroups() error = %v", err)
+	}
+	if len(groups) != 1 || groups[0].ChatID != testChatID || groups[0].Title != "Poopers" || groups[0].Timezone != "UTC" {
+		t.Errorf("GetGroups() = %v, want [{%d Poopers UTC}]", groups, testChatID)
+	}
+}
+
+func TestClaimUnscopedLogs(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	timestamp := time.Date(2025, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	// Logs migrated from before chats were tracked have chat_id 0
+	for i := 0; i < 3; i++ {
+		err := LogPoop(ctx, db, 0, 1001, "alice", int64(i), timestamp.Format("2006-01-02 15:04:05"), timestamp.Unix())
+		if err != nil {
+			t.Fatalf("Failed to insert unscoped log: %v", err)
+		}
+	}
+
+	claimed, err := ClaimUnscopedLogs(ctx, db, testChatID)
+	if err != nil {
+		t.Fatalf("ClaimUnscopedLogs() error = %v", err)
+	}
+	if claimed != 3 {
+		t.Errorf("ClaimUnscopedLogs() = %d, want 3", claimed)
+	}
+
+	count, err := GetYearlyPoopCount(ctx, db, testChatID, 1001, 2025)
+	if err != nil {
+		t.Fatalf("GetYearlyPoopCount() error = %v", err)
+	}
+	if count != 3 {
+		t.Errorf("GetYearlyPoopCount() after claiming = %d, want 3", count)
+	}
+}
+
+func TestDeletePoop(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+	insertTestData(t, db)
+
+	ctx := context.Background()
+
+	latest, err := GetLatestPoop(ctx, db, testChatID, 1001)
+	if err != nil {
+		t.Fatalf("GetLatestPoop() error = %v", err)
+	}
+	// Alice's latest 2025 log is message 1004 on January 29th
+	if latest.MessageID != 1004 || latest.Username != "alice" {
+		t.Errorf("GetLatestPoop() = %+v, want alice's message 1004", latest)
+	}
+
+	if err := DeletePoop(ctx, db, testChatID, 1004, 1001, time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC).Unix()); err != nil {
+		t.Fatalf("DeletePoop() error = %v", err)
+	}
+
+	count, err := GetYearlyPoopCount(ctx, db, testChatID, 1001, 2025)
+	if err != nil {
+		t.Fatalf("GetYearlyPoopCount() error = %v", err)
+	}
+	if count != 4 {
+		t.Errorf("GetYearlyPoopCount() after delete = %d, want 4", count)
+	}
+
+	latest, err = GetLatestPoop(ctx, db, testChatID, 1001)
+	if err != nil {
+		t.Fatalf("GetLatestPoop() error = %v", err)
+	}
+	if latest.MessageID != 1003 {
+		t.Errorf("GetLatestPoop() after delete = message %d, want 1003", latest.MessageID)
+	}
+
+	if _, err := GetPoopByMessageID(ctx, db, testChatID, 1004); !errors.Is(err, ErrPoopNotFound) {
+		t.Errorf("GetPoopByMessageID() of deleted poop error = %v, want ErrPoopNotFound", err)
+	}
+	if err := DeletePoop(ctx, db, testChatID, 1004, 1001, time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC).Unix()); !errors.Is(err, ErrPoopNotFound) {
+		t.Errorf("second DeletePoop() error = %v, want ErrPoopNotFound", err)
+	}
+
+	// The row stays in place for auditing
+	var deletedBy int64
+	err = db.QueryRowContext(ctx, `SELECT deleted_by FROM poop_tracker WHERE chat_id = ? AND message_id = 1004`, testChatID).Scan(&deletedBy)
+	if err != nil {
+		t.Fatalf("Failed to read deleted row: %v", err)
+	}
+	if deletedBy != 1001 {
+		t.Errorf("deleted_by = %d, want 1001", deletedBy)
+	}
+}
+
+func TestGetLatestPoop_NoLogs(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	_, err := GetLatestPoop(context.Background(), db, testChatID, 1001)
+	if !errors.Is(err, ErrPoopNotFound) {
+		t.Errorf("GetLatestPoop() error = %v, want ErrPoopNotFound", err)
+	}
+}
+
 // Benchmark tests
+func TestYearScopedStats(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	if err := RegisterGroup(ctx, db, testChatID, "Poopers", "UTC"); err != nil {
+		t.Fatalf("RegisterGroup() error = %v", err)
+	}
+	today := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	// One poop a day from December 30th to January 2nd is a streak that spans both years
+	days := []time.Time{
+		time.Date(2024, 6, 1, 8, 0, 0, 0, time.UTC),
+		time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC),
+		time.Date(2024, 6, 1, 18, 0, 0, 0, time.UTC),
+		time.Date(2024, 12, 30, 8, 0, 0, 0, time.UTC),
+		time.Date(2024, 12, 31, 8, 0, 0, 0, time.UTC),
+		time.Date(2025, 1, 1, 8, 0, 0, 0, time.UTC),
+		time.Date(2025, 1, 2, 8, 0, 0, 0, time.UTC),
+		time.Date(2025, 3, 3, 8, 0, 0, 0, time.UTC),
+		time.Date(2025, 3, 3, 20, 0, 0, 0, time.UTC),
+	}
+	for i, at := range days {
+		logPoopAt(t, db, 1001, "alice", int64(i+1), at)
+	}
+
+	allTime, err := GetMaxPoopStreak(ctx, db, testChatID, 1001)
+	if err != nil {
+		t.Fatalf("GetMaxPoopStreak() error = %v", err)
+	}
+	if allTime != 4 {
+		t.Errorf("GetMaxPoopStreak() = %d, want 4", allTime)
+	}
+
+	tests := []struct {
+		year            int
+		wantStreak      int
+		wantDay         string
+		wantDayCount    int
+		wantDaysWithout int
+	}{
+		// 2024 is a leap year with 3 days logged
+		{year: 2024, wantStreak: 2, wantDay: "2024-06-01", wantDayCount: 3, wantDaysWithout: 363},
+		// January 1st to March 10th is 69 days, 3 of them logged
+		{year: 2025, wantStreak: 2, wantDay: "2025-03-03", wantDayCount: 2, wantDaysWithout: 66},
+	}
+
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.year), func(t *testing.T) {
+			streak, err := GetYearlyLongestStreak(ctx, db, testChatID, 1001, tt.year)
+			if err != nil {
+				t.Fatalf("GetYearlyLongestStreak() error = %v", err)
+			}
+			if streak != tt.wantStreak {
+				t.Errorf("GetYearlyLongestStreak() = %d, want %d", streak, tt.wantStreak)
+			}
+
+			day, count, err := GetYearlyDayWithMostPoops(ctx, db, testChatID, 1001, tt.year)
+			if err != nil {
+				t.Fatalf("GetYearlyDayWithMostPoops() error = %v", err)
+			}
+			if day != tt.wantDay || count != tt.wantDayCount {
+				t.Errorf("GetYearlyDayWithMostPoops() = %s, %d, want %s, %d", day, count, tt.wantDay, tt.wantDayCount)
+			}
+
+			daysWithout, err := GetYearlyDaysWithoutPoop(ctx, db, testChatID, 1001, tt.year, today)
+			if err != nil {
+				t.Fatalf("GetYearlyDaysWithoutPoop() error = %v", err)
+			}
+			if daysWithout != tt.wantDaysWithout {
+				t.Errorf("GetYearlyDaysWithoutPoop() = %d, want %d", daysWithout, tt.wantDaysWithout)
+			}
+		})
+	}
+
+	// Days in a row count as a streak however many poops each has
+	for i, at := range []time.Time{
+		time.Date(2025, 3, 4, 8, 0, 0, 0, time.UTC),
+		time.Date(2025, 3, 5, 8, 0, 0, 0, time.UTC),
+	} {
+		logPoopAt(t, db, 1001, "alice", int64(len(days)+i+1), at)
+	}
+	streak, err := GetYearlyLongestStreak(ctx, db, testChatID, 1001, 2025)
+	if err != nil || streak != 3 {
+		t.Errorf("GetYearlyLongestStreak() 2025 with March 3rd to 5th = %d, %v, want 3", streak, err)
+	}
+
+	// A year without logs has no streak and no busiest day
+	streak, err = GetYearlyLongestStreak(ctx, db, testChatID, 1001, 2023)
+	if err != nil || streak != 0 {
+		t.Errorf("GetYearlyLongestStreak() 2023 = %d, %v, want 0", streak, err)
+	}
+	if _, _, err := GetYearlyDayWithMostPoops(ctx, db, testChatID, 1001, 2023); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetYearlyDayWithMostPoops() 2023 error = %v, want sql.ErrNoRows", err)
+	}
+
+	// Years that haven't started yet have no days to count
+	daysWithout, err := GetYearlyDaysWithoutPoop(ctx, db, testChatID, 1001, 2026, today)
+	if err != nil || daysWithout != 0 {
+		t.Errorf("GetYearlyDaysWithoutPoop() 2026 = %d, %v, want 0", daysWithout, err)
+	}
+}
+
 func BenchmarkGetYearlyPoopCount(b *testing.B) {
 	db, cleanup := setupTestDB(&testing.T{})
 	defer cleanup()
@@ -620,7 +979,7 @@ func BenchmarkGetYearlyPoopCount(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_, _ = GetYearlyPoopCount(ctx, db, userID, year)
+		_, _ = GetYearlyPoopCount(ctx, db, testChatID, userID, year)
 	}
 }
 
@@ -635,7 +994,7 @@ func BenchmarkGetPoopsByHour(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_, _ = GetPoopsByHour(ctx, db, userID, year)
+		_, _ = GetPoopsByHour(ctx, db, testChatID, userID, year)
 	}
 }
 
@@ -649,6 +1008,66 @@ func BenchmarkGetGroupAwards(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_, _ = GetGroupAwards(ctx, db, year)
+		_, _ = GetGroupAwards(ctx, db, testChatID, year)
+	}
+}
+
+func TestLogPoop_Idempotent(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	logged, err := IsPoopLogged(ctx, db, testChatID, 42)
+	if err != nil || logged {
+		t.Errorf("IsPoopLogged() before logging = %v, %v, want false", logged, err)
+	}
+
+	if err := LogPoop(ctx, db, testChatID, 1001, "alice", 42, "2025-01-10 08:00:00", 1736496000); err != nil {
+		t.Fatalf("LogPoop() error = %v", err)
+	}
+	err = LogPoop(ctx, db, testChatID, 1002, "bob", 42, "2025-01-11 08:00:00", 1736582400)
+	if !errors.Is(err, ErrPoopAlreadyLogged) {
+		t.Errorf("LogPoop() of the same message error = %v, want ErrPoopAlreadyLogged", err)
+	}
+
+	poop, err := GetPoopByMessageID(ctx, db, testChatID, 42)
+	if err != nil || poop.UserID != 1001 {
+		t.Errorf("GetPoopByMessageID() = %+v, %v, want the first log kept", poop, err)
+	}
+
+	// Deleted logs still count as logged, so imports don't bring them back
+	if err := DeletePoop(ctx, db, testChatID, 42, 1001, time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC).Unix()); err != nil {
+		t.Fatalf("DeletePoop() error = %v", err)
+	}
+	logged, err = IsPoopLogged(ctx, db, testChatID, 42)
+	if err != nil || !logged {
+		t.Errorf("IsPoopLogged() after deleting = %v, %v, want true", logged, err)
+	}
+}
+
+func TestOpenDBConnection_WAL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := OpenDBConnection(&config.Config{DBPath: path})
+	if err != nil {
+		t.Fatalf("OpenDBConnection() error = %v", err)
+	}
+
+	var mode string
+	if err := db.QueryRow("PRAGMA journal_mode").Scan(&mode); err != nil || mode != "wal" {
+		t.Errorf("journal_mode = %q, %v, want wal", mode, err)
+	}
+
+	at := time.Date(2025, 3, 1, 8, 0, 0, 0, time.UTC)
+	if err := LogPoop(context.Background(), db, testChatID, 1001, "alice", 1, at.Format(sqliteTimeLayout), at.Unix()); err != nil {
+		t.Fatalf("LogPoop() error = %v", err)
+	}
+	if err := CloseDBConnection(db); err != nil {
+		t.Fatalf("CloseDBConnection() error = %v", err)
+	}
+
+	// Closing leaves nothing behind in the write-ahead log
+	if info, err := os.Stat(path + "-wal"); err == nil && info.Size() != 0 {
+		t.Errorf("the write-ahead log has %d bytes after closing, want it checkpointed", info.Size())
 	}
 }
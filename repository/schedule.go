@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// GetLastScheduledRun returns the time the job's last successful run was scheduled for, or 0 if it never ran
+func GetLastScheduledRun(ctx context.Context, db *sql.DB, job string) (int64, error) {
+	query := `
+	SELECT scheduled_at_unix
+	FROM scheduled_runs
+	WHERE job = ?;
+	`
+	var scheduledAtUnix int64
+	err := db.QueryRowContext(ctx, query, job).Scan(&scheduledAtUnix)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return scheduledAtUnix, nil
+}
+
+// RecordScheduledRun records a successful run of a job. An older run finishing late doesn't move the last run back.
+func RecordScheduledRun(ctx context.Context, db *sql.DB, job string, scheduledAtUnix int64, finishedAtUnix int64) error {
+	query := `
+	INSERT INTO scheduled_runs (job, scheduled_at_unix, finished_at_unix)
+	VALUES (?, ?, ?)
+	ON CONFLICT (job) DO UPDATE SET
+		scheduled_at_unix = excluded.scheduled_at_unix,
+		finished_at_unix = excluded.finished_at_unix
+	WHERE scheduled_at_unix <= excluded.scheduled_at_unix;
+	`
+	_, err := db.ExecContext(ctx, query, job, scheduledAtUnix, finishedAtUnix)
+	return err
+}
+
+// ClaimScheduledPost records that a job is posting its announcement for a period in a chat.
+// It returns false when that announcement was already posted.
+func ClaimScheduledPost(ctx context.Context, db *sql.DB, job string, chatID int64, period string, sentAtUnix int64) (bool, error) {
+	query := `
+	INSERT INTO scheduled_posts (job, chat_id, period, sent_at_unix)
+	VALUES (?, ?, ?, ?)
+	ON CONFLICT (job, chat_id, period) DO NOTHING;
+	`
+	result, err := db.ExecContext(ctx, query, job, chatID, period, sentAtUnix)
+	if err != nil {
+		return false, err
+	}
+
+	claimed, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return claimed > 0, nil
+}
+
+// ReleaseScheduledPost forgets a claimed announcement that couldn't be posted, so the next run posts it
+func ReleaseScheduledPost(ctx context.Context, db *sql.DB, job string, chatID int64, period string) error {
+	query := `
+	DELETE FROM scheduled_posts
+	WHERE job = ? AND chat_id = ? AND period = ?;
+	`
+	_, err := db.ExecContext(ctx, query, job, chatID, period)
+	return err
+}
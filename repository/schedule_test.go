@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"testing"
+)
+
+func TestScheduledRuns(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	last, err := GetLastScheduledRun(ctx, db, "monthly_poodium")
+	if err != nil || last != 0 {
+		t.Fatalf("GetLastScheduledRun() for a job that never ran = %d, %v, want 0", last, err)
+	}
+
+	if err := RecordScheduledRun(ctx, db, "monthly_poodium", 1740787200, 1740787205); err != nil {
+		t.Fatalf("RecordScheduledRun() error = %v", err)
+	}
+	// A catch-up of an older run finishing late doesn't move the last run back
+	if err := RecordScheduledRun(ctx, db, "monthly_poodium", 1740783600, 1740787210); err != nil {
+		t.Fatalf("RecordScheduledRun() error = %v", err)
+	}
+
+	last, err = GetLastScheduledRun(ctx, db, "monthly_poodium")
+	if err != nil || last != 1740787200 {
+		t.Errorf("GetLastScheduledRun() = %d, %v, want 1740787200", last, err)
+	}
+	if last, _ := GetLastScheduledRun(ctx, db, "weekly_recap"); last != 0 {
+		t.Errorf("GetLastScheduledRun() of another job = %d, want 0", last)
+	}
+}
+
+func TestClaimScheduledPost(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		job    string
+		chatID int64
+		period string
+		want   bool
+	}{
+		{name: "first post", job: "monthly_poodium", chatID: testChatID, period: "2025-02", want: true},
+		{name: "repeated post", job: "monthly_poodium", chatID: testChatID, period: "2025-02", want: false},
+		{name: "next period", job: "monthly_poodium", chatID: testChatID, period: "2025-03", want: true},
+		{name: "another group", job: "monthly_poodium", chatID: -100456, period: "2025-02", want: true},
+		{name: "another job", job: "weekly_recap", chatID: testChatID, period: "2025-02", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claimed, err := ClaimScheduledPost(ctx, db, tt.job, tt.chatID, tt.period, 1740787200)
+			if err != nil {
+				t.Fatalf("ClaimScheduledPost() error = %v", err)
+			}
+			if claimed != tt.want {
+				t.Errorf("ClaimScheduledPost() = %v, want %v", claimed, tt.want)
+			}
+		})
+	}
+}
+
+func TestReleaseScheduledPost(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	if _, err := ClaimScheduledPost(ctx, db, "monthly_poodium", testChatID, "2025-02", 1740787200); err != nil {
+		t.Fatalf("ClaimScheduledPost() error = %v", err)
+	}
+	if err := ReleaseScheduledPost(ctx, db, "monthly_poodium", testChatID, "2025-02"); err != nil {
+		t.Fatalf("ReleaseScheduledPost() error = %v", err)
+	}
+
+	claimed, err := ClaimScheduledPost(ctx, db, "monthly_poodium", testChatID, "2025-02", 1740790800)
+	if err != nil || !claimed {
+		t.Errorf("ClaimScheduledPost() after releasing = %v, %v, want it claimed again", claimed, err)
+	}
+}
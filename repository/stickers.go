@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// Sticker maps a sticker to the emoji the bot reacts to it with
+type Sticker struct {
+	FileUniqueID string
+	SetName      string
+	Emoji        string
+}
+
+// RegisterSticker saves the reaction to a sticker, replacing any previous one
+func RegisterSticker(ctx context.Context, db *sql.DB, sticker Sticker, registeredBy int64, registeredAtUnix int64) error {
+	query := `
+	INSERT INTO sticker_reactions (file_unique_id, set_name, emoji, registered_by, registered_at_unix)
+	VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT (file_unique_id) DO UPDATE SET
+		set_name = excluded.set_name,
+		emoji = excluded.emoji,
+		registered_by = excluded.registered_by,
+		registered_at_unix = excluded.registered_at_unix;
+	`
+	_, err := db.ExecContext(ctx, query, sticker.FileUniqueID, sticker.SetName, sticker.Emoji, registeredBy, registeredAtUnix)
+	return err
+}
+
+// GetStickerEmoji returns the reaction registered for a sticker, or an empty string if there is none
+func GetStickerEmoji(ctx context.Context, db *sql.DB, fileUniqueID string) (string, error) {
+	query := `
+	SELECT emoji
+	FROM sticker_reactions
+	WHERE file_unique_id = ?;
+	`
+	var emoji string
+	err := db.QueryRowContext(ctx, query, fileUniqueID).Scan(&emoji)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return emoji, nil
+}
+
+func GetStickers(ctx context.Context, db *sql.DB) ([]Sticker, error) {
+	query := `
+	SELECT file_unique_id, set_name, emoji
+	FROM sticker_reactions
+	ORDER BY set_name, file_unique_id;
+	`
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stickers []Sticker
+	for rows.Next() {
+		var sticker Sticker
+		if err := rows.Scan(&sticker.FileUniqueID, &sticker.SetName, &sticker.Emoji); err != nil {
+			return nil, err
+		}
+		stickers = append(stickers, sticker)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return stickers, nil
+}
@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"testing"
+)
+
+func TestStickers(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	// The stickers that used to be hardcoded come with the migration
+	stickers, err := GetStickers(ctx, db)
+	if err != nil {
+		t.Fatalf("GetStickers() error = %v", err)
+	}
+	if len(stickers) != 6 {
+		t.Errorf("GetStickers() returned %d stickers, want the 6 seeded ones", len(stickers))
+	}
+
+	emoji, err := GetStickerEmoji(ctx, db, "AgADcxgAAvVG0FE")
+	if err != nil {
+		t.Fatalf("GetStickerEmoji() error = %v", err)
+	}
+	if emoji != "🤨" {
+		t.Errorf("GetStickerEmoji() of the sus sticker = %s, want 🤨", emoji)
+	}
+
+	emoji, err = GetStickerEmoji(ctx, db, "unknown")
+	if err != nil {
+		t.Fatalf("GetStickerEmoji() error = %v", err)
+	}
+	if emoji != "" {
+		t.Errorf("GetStickerEmoji() of an unknown sticker = %s, want none", emoji)
+	}
+
+	// Registering a new sticker adds it, registering a known one changes its reaction
+	if err := RegisterSticker(ctx, db, Sticker{FileUniqueID: "AgADnew", SetName: "Poopers3", Emoji: "🔥"}, 1001, 1740880800); err != nil {
+		t.Fatalf("RegisterSticker() error = %v", err)
+	}
+	if err := RegisterSticker(ctx, db, Sticker{FileUniqueID: "AgADcxgAAvVG0FE", SetName: "Poopers2", Emoji: "👀"}, 1001, 1740880800); err != nil {
+		t.Fatalf("RegisterSticker() error = %v", err)
+	}
+
+	stickers, err = GetStickers(ctx, db)
+	if err != nil {
+		t.Fatalf("GetStickers() error = %v", err)
+	}
+	if len(stickers) != 7 {
+		t.Errorf("GetStickers() returned %d stickers, want 7", len(stickers))
+	}
+
+	emoji, err = GetStickerEmoji(ctx, db, "AgADcxgAAvVG0FE")
+	if err != nil {
+		t.Fatalf("GetStickerEmoji() error = %v", err)
+	}
+	if emoji != "👀" {
+		t.Errorf("GetStickerEmoji() after re-registering = %s, want 👀", emoji)
+	}
+}
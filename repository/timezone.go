@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"src/utils"
+
+	"modernc.org/sqlite"
+)
+
+// sqliteTimeLayout is the layout SQLite date functions expect
+const sqliteTimeLayout = "2006-01-02 15:04:05"
+
+var locations sync.Map
+
+func init() {
+	// local_time(unix_seconds, timezone) renders a unix timestamp as local time in an IANA timezone,
+	// so SQLite date functions can bucket logs by the local day, week, month and year
+	sqlite.MustRegisterDeterministicScalarFunction("local_time", 2, func(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		unix, ok := args[0].(int64)
+		if !ok {
+			return nil, nil
+		}
+		timezone, _ := args[1].(string)
+		return time.Unix(unix, 0).In(loadLocation(timezone)).Format(sqliteTimeLayout), nil
+	})
+}
+
+// loadLocation returns the location for an IANA timezone name, falling back to UTC for unknown names
+func loadLocation(timezone string) *time.Location {
+	if cached, ok := locations.Load(timezone); ok {
+		return cached.(*time.Location)
+	}
+
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	locations.Store(timezone, loc)
+	return loc
+}
+
+// GetGroupTimezone returns the timezone of a group, or UTC for chats that aren't registered
+func GetGroupTimezone(ctx context.Context, db *sql.DB, chatID int64) (string, error) {
+	query := `
+	SELECT timezone
+	FROM groups
+	WHERE chat_id = ?;
+	`
+	var timezone string
+	err := db.QueryRowContext(ctx, query, chatID).Scan(&timezone)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "UTC", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return timezone, nil
+}
+
+func SetGroupTimezone(ctx context.Context, db *sql.DB, chatID int64, timezone string) error {
+	if err := utils.ValidateTimezone(timezone); err != nil {
+		return err
+	}
+
+	query := `
+	UPDATE groups
+	SET timezone = ?
+	WHERE chat_id = ?;
+	`
+	result, err := db.ExecContext(ctx, query, timezone, chatID)
+	if err != nil {
+		return err
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return fmt.Errorf("chat %d is not a registered group", chatID)
+	}
+	return nil
+}
+
+// GetUserTimezone returns the user's timezone override, or an empty string when they follow the group's timezone
+func GetUserTimezone(ctx context.Context, db *sql.DB, userID int64) (string, error) {
+	query := `
+	SELECT COALESCE(timezone, '')
+	FROM user_settings
+	WHERE user_id = ?;
+	`
+	var timezone string
+	err := db.QueryRowContext(ctx, query, userID).Scan(&timezone)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return timezone, nil
+}
+
+// SetUserTimezone overrides the timezone used for a user's logs, an empty timezone removes the override
+func SetUserTimezone(ctx context.Context, db *sql.DB, userID int64, timezone string) error {
+	if timezone != "" {
+		if err := utils.ValidateTimezone(timezone); err != nil {
+			return err
+		}
+	}
+
+	query := `
+	INSERT INTO user_settings (user_id, timezone)
+	VALUES (?, NULLIF(?, ''))
+	ON CONFLICT (user_id) DO UPDATE SET timezone = excluded.timezone;
+	`
+	_, err := db.ExecContext(ctx, query, userID, timezone)
+	return err
+}
+
+// groupLocation returns the location group-wide periods are computed in
+func groupLocation(ctx context.Context, db *sql.DB, chatID int64) (*time.Location, error) {
+	timezone, err := GetGroupTimezone(ctx, db, chatID)
+	if err != nil {
+		return nil, err
+	}
+	return loadLocation(timezone), nil
+}
+
+// userLocation returns the location a user's personal periods are computed in
+func userLocation(ctx context.Context, db *sql.DB, chatID int64, userID int64) (*time.Location, error) {
+	timezone, err := GetUserTimezone(ctx, db, userID)
+	if err != nil {
+		return nil, err
+	}
+	if timezone != "" {
+		return loadLocation(timezone), nil
+	}
+	return groupLocation(ctx, db, chatID)
+}
@@ -0,0 +1,237 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+)
+
+// logPoopAt logs a poop in the test chat at an exact UTC instant
+func logPoopAt(t *testing.T, db *sql.DB, userID int64, username string, msgID int64, at time.Time) {
+	t.Helper()
+	at = at.UTC()
+	err := LogPoop(context.Background(), db, testChatID, userID, username, msgID, at.Format(sqliteTimeLayout), at.Unix())
+	if err != nil {
+		t.Fatalf("Failed to insert test data: %v", err)
+	}
+}
+
+func TestLocalTimeBucketing(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	if err := RegisterGroup(ctx, db, testChatID, "Poopers", "Europe/Lisbon"); err != nil {
+		t.Fatalf("RegisterGroup() error = %v", err)
+	}
+
+	// 23:30 UTC on June 30th is 00:30 on July 1st in Lisbon summer time
+	logPoopAt(t, db, 1001, "alice", 1, time.Date(2025, 6, 30, 23, 30, 0, 0, time.UTC))
+
+	stats, err := GetMonthlyPoopStats(ctx, db, testChatID, 1001)
+	if err != nil {
+		t.Fatalf("GetMonthlyPoopStats() error = %v", err)
+	}
+	if len(stats) != 1 || stats[0].Month != "2025-07" {
+		t.Errorf("GetMonthlyPoopStats() = %v, want a single entry for 2025-07", stats)
+	}
+
+	hours, err := GetPoopsByHour(ctx, db, testChatID, 1001, 2025)
+	if err != nil {
+		t.Fatalf("GetPoopsByHour() error = %v", err)
+	}
+	if hours[0].PoopCount != 1 {
+		t.Errorf("GetPoopsByHour() hour 0 = %d, want 1", hours[0].PoopCount)
+	}
+
+	day, _, err := GetDayWithMostPoops(ctx, db, testChatID, 1001)
+	if err != nil {
+		t.Fatalf("GetDayWithMostPoops() error = %v", err)
+	}
+	if day != "2025-07-01" {
+		t.Errorf("GetDayWithMostPoops() day = %s, want 2025-07-01", day)
+	}
+}
+
+func TestLocalTimeBucketing_YearBoundary(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	if err := RegisterGroup(ctx, db, testChatID, "Poopers", "Asia/Tokyo"); err != nil {
+		t.Fatalf("RegisterGroup() error = %v", err)
+	}
+
+	// 20:00 UTC on New Year's Eve is already 2025 in Tokyo
+	logPoopAt(t, db, 1001, "alice", 1, time.Date(2024, 12, 31, 20, 0, 0, 0, time.UTC))
+
+	count, err := GetYearlyPoopCount(ctx, db, testChatID, 1001, 2025)
+	if err != nil {
+		t.Fatalf("GetYearlyPoopCount() error = %v", err)
+	}
+	if count != 1 {
+		t.Errorf("GetYearlyPoopCount() 2025 = %d, want 1", count)
+	}
+
+	count, err = GetYearlyPoopCount(ctx, db, testChatID, 1001, 2024)
+	if err != nil {
+		t.Fatalf("GetYearlyPoopCount() error = %v", err)
+	}
+	if count != 0 {
+		t.Errorf("GetYearlyPoopCount() 2024 = %d, want 0", count)
+	}
+}
+
+func TestUserTimezoneOverride(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	if err := RegisterGroup(ctx, db, testChatID, "Poopers", "Europe/Lisbon"); err != nil {
+		t.Fatalf("RegisterGroup() error = %v", err)
+	}
+	if err := SetUserTimezone(ctx, db, 1002, "America/New_York"); err != nil {
+		t.Fatalf("SetUserTimezone() error = %v", err)
+	}
+
+	// 03:00 UTC is 04:00 in Lisbon but still 23:00 the previous day in New York
+	at := time.Date(2025, 6, 10, 3, 0, 0, 0, time.UTC)
+	logPoopAt(t, db, 1001, "alice", 1, at)
+	logPoopAt(t, db, 1002, "bob", 2, at)
+
+	aliceHours, err := GetPoopsByHour(ctx, db, testChatID, 1001, 2025)
+	if err != nil {
+		t.Fatalf("GetPoopsByHour() error = %v", err)
+	}
+	if aliceHours[4].PoopCount != 1 {
+		t.Errorf("alice hour 4 = %d, want 1", aliceHours[4].PoopCount)
+	}
+
+	bobHours, err := GetPoopsByHour(ctx, db, testChatID, 1002, 2025)
+	if err != nil {
+		t.Fatalf("GetPoopsByHour() error = %v", err)
+	}
+	if bobHours[23].PoopCount != 1 {
+		t.Errorf("bob hour 23 = %d, want 1", bobHours[23].PoopCount)
+	}
+
+	timezone, err := GetUserTimezone(ctx, db, 1002)
+	if err != nil {
+		t.Fatalf("GetUserTimezone() error = %v", err)
+	}
+	if timezone != "America/New_York" {
+		t.Errorf("GetUserTimezone() = %q, want America/New_York", timezone)
+	}
+
+	// Removing the override puts bob back on Lisbon time
+	if err := SetUserTimezone(ctx, db, 1002, ""); err != nil {
+		t.Fatalf("SetUserTimezone() error = %v", err)
+	}
+	bobHours, err = GetPoopsByHour(ctx, db, testChatID, 1002, 2025)
+	if err != nil {
+		t.Fatalf("GetPoopsByHour() error = %v", err)
+	}
+	if bobHours[4].PoopCount != 1 {
+		t.Errorf("bob hour 4 after reset = %d, want 1", bobHours[4].PoopCount)
+	}
+}
+
+func TestCurrentPeriodUsesGroupTimezone(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	if err := RegisterGroup(ctx, db, testChatID, "Poopers", "Europe/Lisbon"); err != nil {
+		t.Fatalf("RegisterGroup() error = %v", err)
+	}
+
+	// It's already August 1st in Lisbon, but still July in UTC
+	today := time.Date(2025, 7, 31, 23, 30, 0, 0, time.UTC)
+
+	logPoopAt(t, db, 1001, "alice", 1, time.Date(2025, 7, 31, 23, 15, 0, 0, time.UTC)) // August in Lisbon
+	logPoopAt(t, db, 1002, "bob", 2, time.Date(2025, 7, 31, 22, 15, 0, 0, time.UTC))   // July in Lisbon
+
+	august, err := GetLeaderboard(ctx, db, testChatID, MonthPeriod(2025, time.August), MostPoopsFirst, 0)
+	if err != nil {
+		t.Fatalf("GetLeaderboard() error = %v", err)
+	}
+	if len(august) != 1 || august[0].Username != "alice" {
+		t.Errorf("GetLeaderboard(August) = %v, want only alice", august)
+	}
+
+	july, err := GetLeaderboard(ctx, db, testChatID, MonthPeriod(2025, time.July), MostPoopsFirst, 3)
+	if err != nil {
+		t.Fatalf("GetLeaderboard() error = %v", err)
+	}
+	if len(july) != 1 || july[0].Username != "bob" {
+		t.Errorf("GetLeaderboard(July) = %v, want only bob", july)
+	}
+
+	daysWithoutPoop, err := GetDaysWithoutPoop(ctx, db, testChatID, 1001, today)
+	if err != nil {
+		t.Fatalf("GetDaysWithoutPoop() error = %v", err)
+	}
+	// January 1st to August 1st is 213 days, alice pooped on one of them
+	if daysWithoutPoop != 212 {
+		t.Errorf("GetDaysWithoutPoop() = %d, want 212", daysWithoutPoop)
+	}
+}
+
+func TestTimezoneValidation(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	if err := RegisterGroup(ctx, db, testChatID, "Poopers", "UTC"); err != nil {
+		t.Fatalf("RegisterGroup() error = %v", err)
+	}
+
+	if err := SetGroupTimezone(ctx, db, testChatID, "Mars/Olympus_Mons"); err == nil {
+		t.Error("SetGroupTimezone() accepted an unknown timezone")
+	}
+	if err := SetUserTimezone(ctx, db, 1001, "Local"); err == nil {
+		t.Error("SetUserTimezone() accepted the Local timezone")
+	}
+	if err := SetGroupTimezone(ctx, db, 42, "Europe/Lisbon"); err == nil {
+		t.Error("SetGroupTimezone() accepted an unregistered chat")
+	}
+
+	if err := SetGroupTimezone(ctx, db, testChatID, "Europe/Lisbon"); err != nil {
+		t.Fatalf("SetGroupTimezone() error = %v", err)
+	}
+	timezone, err := GetGroupTimezone(ctx, db, testChatID)
+	if err != nil {
+		t.Fatalf("GetGroupTimezone() error = %v", err)
+	}
+	if timezone != "Europe/Lisbon" {
+		t.Errorf("GetGroupTimezone() = %q, want Europe/Lisbon", timezone)
+	}
+}
+
+func TestYearlyStatsCoverEveryTimezone(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	if err := SetUserTimezone(ctx, db, 1001, "Pacific/Kiritimati"); err != nil {
+		t.Fatalf("SetUserTimezone() error = %v", err)
+	}
+	if err := SetUserTimezone(ctx, db, 1002, "Etc/GMT+12"); err != nil {
+		t.Fatalf("SetUserTimezone() error = %v", err)
+	}
+
+	// 00:30 on New Year's Day, 14 hours ahead of UTC, and 23:30 on New Year's Eve, 12 hours behind
+	logPoopAt(t, db, 1001, "alice", 1, time.Date(2024, 12, 31, 10, 30, 0, 0, time.UTC))
+	logPoopAt(t, db, 1002, "bob", 2, time.Date(2026, 1, 1, 11, 30, 0, 0, time.UTC))
+
+	for _, userID := range []int64{1001, 1002} {
+		if count, err := GetYearlyPoopCount(ctx, db, testChatID, userID, 2025); err != nil || count != 1 {
+			t.Errorf("GetYearlyPoopCount(%d) = %d, %v, want 1", userID, count, err)
+		}
+	}
+	leaderboard, err := GetLeaderboard(ctx, db, testChatID, YearPeriod(2025), MostPoopsFirst, 0)
+	if err != nil || len(leaderboard) != 2 {
+		t.Errorf("GetLeaderboard(2025) = %+v, %v, want alice and bob", leaderboard, err)
+	}
+}
@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// ErrUserNotFound is returned for users the bot has never seen
+var ErrUserNotFound = errors.New("user not found")
+
+// User is a Telegram user with the names they had when the bot last saw them
+type User struct {
+	UserID       int64
+	Username     string
+	FirstName    string
+	LastName     string
+	LastSeenUnix int64
+}
+
+// DisplayName is the @username without the @, or the first name for users without one, like poop_log.display_name
+func (u User) DisplayName() string {
+	if u.Username != "" {
+		return u.Username
+	}
+	return u.FirstName
+}
+
+// UpsertUser records the names a user was seen with.
+// Sightings older than the stored one are ignored, so replayed or backfilled messages don't bring back old names.
+func UpsertUser(ctx context.Context, db *sql.DB, user User) error {
+	query := `
+	INSERT INTO users (user_id, username, first_name, last_name, last_seen_unix)
+	VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT (user_id) DO UPDATE SET
+		username = excluded.username,
+		first_name = excluded.first_name,
+		last_name = excluded.last_name,
+		last_seen_unix = excluded.last_seen_unix
+	WHERE excluded.last_seen_unix >= users.last_seen_unix;
+	`
+	_, err := db.ExecContext(ctx, query, user.UserID, user.Username, user.FirstName, user.LastName, user.LastSeenUnix)
+	return err
+}
+
+func GetUser(ctx context.Context, db *sql.DB, userID int64) (User, error) {
+	query := `
+	SELECT user_id, username, first_name, last_name, last_seen_unix
+	FROM users
+	WHERE user_id = ?;
+	`
+	var user User
+	err := db.QueryRowContext(ctx, query, userID).Scan(&user.UserID, &user.Username, &user.FirstName, &user.LastName, &user.LastSeenUnix)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, ErrUserNotFound
+	}
+	if err != nil {
+		return User{}, err
+	}
+	return user, nil
+}
@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestUpsertUser(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	if _, err := GetUser(ctx, db, 1001); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("GetUser() of an unknown user error = %v, want ErrUserNotFound", err)
+	}
+
+	alice := User{UserID: 1001, Username: "alice", FirstName: "Alice", LastName: "Liddell", LastSeenUnix: 1740880800}
+	if err := UpsertUser(ctx, db, alice); err != nil {
+		t.Fatalf("UpsertUser() error = %v", err)
+	}
+
+	// An older sighting, like a backfilled message, doesn't bring back an old name
+	if err := UpsertUser(ctx, db, User{UserID: 1001, Username: "alice_old", LastSeenUnix: 1740800000}); err != nil {
+		t.Fatalf("UpsertUser() error = %v", err)
+	}
+	user, err := GetUser(ctx, db, 1001)
+	if err != nil {
+		t.Fatalf("GetUser() error = %v", err)
+	}
+	if user != alice {
+		t.Errorf("GetUser() = %+v, want %+v", user, alice)
+	}
+
+	// A newer one replaces every name, including dropping the username
+	renamed := User{UserID: 1001, FirstName: "Alice", LastSeenUnix: 1740900000}
+	if err := UpsertUser(ctx, db, renamed); err != nil {
+		t.Fatalf("UpsertUser() error = %v", err)
+	}
+	user, err = GetUser(ctx, db, 1001)
+	if err != nil {
+		t.Fatalf("GetUser() error = %v", err)
+	}
+	if user != renamed {
+		t.Errorf("GetUser() after renaming = %+v, want %+v", user, renamed)
+	}
+	if user.DisplayName() != "Alice" {
+		t.Errorf("DisplayName() without a username = %q, want the first name", user.DisplayName())
+	}
+}
+
+func TestStatsUseCurrentDisplayName(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	logPoopAt(t, db, 1001, "alice_old", 1, time.Date(2025, 3, 1, 8, 0, 0, 0, time.UTC))
+	logPoopAt(t, db, 1001, "alice_old", 2, time.Date(2025, 3, 2, 8, 0, 0, 0, time.UTC))
+	logPoopAt(t, db, 1002, "", 3, time.Date(2025, 3, 3, 8, 0, 0, 0, time.UTC))
+	logPoopAt(t, db, 1003, "charlie", 4, time.Date(2025, 3, 4, 8, 0, 0, 0, time.UTC))
+
+	users := []User{
+		{UserID: 1001, Username: "alice", FirstName: "Alice", LastSeenUnix: 1742400000},
+		{UserID: 1002, FirstName: "Bob", LastSeenUnix: 1742400000},
+	}
+	for _, user := range users {
+		if err := UpsertUser(ctx, db, user); err != nil {
+			t.Fatalf("UpsertUser() error = %v", err)
+		}
+	}
+
+	leaderboard, err := GetLeaderboard(ctx, db, testChatID, MonthPeriod(2025, time.March), MostPoopsFirst, 0)
+	if err != nil {
+		t.Fatalf("GetLeaderboard() error = %v", err)
+	}
+	// charlie was never seen since users were tracked, so the logged username is all there is
+	want := []UserPoopCount{{Username: "alice", PoopCount: 2, Rank: 1}, {Username: "Bob", PoopCount: 1, Rank: 2}, {Username: "charlie", PoopCount: 1, Rank: 2}}
+	if len(leaderboard) != len(want) {
+		t.Fatalf("GetLeaderboard() = %+v, want %+v", leaderboard, want)
+	}
+	for i := range want {
+		if leaderboard[i] != want[i] {
+			t.Errorf("GetLeaderboard()[%d] = %+v, want %+v", i, leaderboard[i], want[i])
+		}
+	}
+
+	awards, err := GetGroupAwards(ctx, db, testChatID, 2025)
+	if err != nil {
+		t.Fatalf("GetGroupAwards() error = %v", err)
+	}
+	for _, award := range awards {
+		if award.Winner == "alice_old" || award.Winner == "" {
+			t.Errorf("award %q went to %q, want a current display name", award.AwardName, award.Winner)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// GetLocalDayPoopCount counts the user's poops on the local day containing at, returning that day as YYYY-MM-DD
+func GetLocalDayPoopCount(ctx context.Context, db *sql.DB, chatID int64, userID int64, at time.Time) (string, int, error) {
+	loc, err := userLocation(ctx, db, chatID, userID)
+	if err != nil {
+		return "", 0, err
+	}
+	local := at.In(loc)
+	day := local.Format("2006-01-02")
+	start, end := RangePeriod(local, local).utcBounds()
+
+	query := `
+	SELECT COUNT(*)
+	FROM poop_log
+	WHERE chat_id = ? AND user_id = ? AND created_at_unix >= ? AND created_at_unix < ? AND date(timestamp) = ?;
+	`
+	var count int
+	err = db.QueryRowContext(ctx, query, chatID, userID, start, end, day).Scan(&count)
+	if err != nil {
+		return "", 0, err
+	}
+	return day, count, nil
+}
+
+// ClaimWellnessAlert records that a wellness alert of the given level is being sent for a user's day.
+// It returns false when an alert of that level or higher was already sent that day.
+func ClaimWellnessAlert(ctx context.Context, db *sql.DB, chatID int64, userID int64, day string, level int, sentAtUnix int64) (bool, error) {
+	query := `
+	INSERT INTO wellness_alerts (chat_id, user_id, day, level, sent_at_unix)
+	VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT (chat_id, user_id, day) DO UPDATE SET
+		level = excluded.level,
+		sent_at_unix = excluded.sent_at_unix
+	WHERE level < excluded.level;
+	`
+	result, err := db.ExecContext(ctx, query, chatID, userID, day, level, sentAtUnix)
+	if err != nil {
+		return false, err
+	}
+
+	claimed, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return claimed > 0, nil
+}
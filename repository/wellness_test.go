@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestGetLocalDayPoopCount(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	if err := RegisterGroup(ctx, db, testChatID, "Poopers", "Asia/Tokyo"); err != nil {
+		t.Fatalf("RegisterGroup() error = %v", err)
+	}
+
+	// 16:00 UTC is already the next day in Tokyo
+	logPoopAt(t, db, 1001, "alice", 1, time.Date(2025, 3, 1, 14, 0, 0, 0, time.UTC))
+	logPoopAt(t, db, 1001, "alice", 2, time.Date(2025, 3, 1, 16, 0, 0, 0, time.UTC))
+	logPoopAt(t, db, 1001, "alice", 3, time.Date(2025, 3, 2, 1, 0, 0, 0, time.UTC))
+	logPoopAt(t, db, 1002, "bob", 4, time.Date(2025, 3, 2, 1, 0, 0, 0, time.UTC))
+
+	day, count, err := GetLocalDayPoopCount(ctx, db, testChatID, 1001, time.Date(2025, 3, 2, 1, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("GetLocalDayPoopCount() error = %v", err)
+	}
+	if day != "2025-03-02" || count != 2 {
+		t.Errorf("GetLocalDayPoopCount() = %s, %d, want 2025-03-02, 2", day, count)
+	}
+}
+
+func TestClaimWellnessAlert(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	tests := []struct {
+		name  string
+		day   string
+		level int
+		want  bool
+	}{
+		{name: "first alert", day: "2025-03-02", level: 1, want: true},
+		{name: "repeated alert", day: "2025-03-02", level: 1, want: false},
+		{name: "escalation", day: "2025-03-02", level: 2, want: true},
+		{name: "repeated escalation", day: "2025-03-02", level: 2, want: false},
+		{name: "lower level after escalation", day: "2025-03-02", level: 1, want: false},
+		{name: "next day", day: "2025-03-03", level: 1, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claimed, err := ClaimWellnessAlert(ctx, db, testChatID, 1001, tt.day, tt.level, 1740880800)
+			if err != nil {
+				t.Fatalf("ClaimWellnessAlert() error = %v", err)
+			}
+			if claimed != tt.want {
+				t.Errorf("ClaimWellnessAlert() = %v, want %v", claimed, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"src/logging"
+
+	"github.com/robfig/cron/v3"
+)
+
+// maxCatchUp limits how far back runs missed while the bot was stopped are replayed
+const maxCatchUp = 7 * 24 * time.Hour
+
+// ErrUnknownJob is returned when triggering a job that isn't scheduled
+var ErrUnknownJob = errors.New("unknown job")
+
+// Run is a single run of a job
+type Run struct {
+	// ScheduledAt is when the run was due. Jobs use it instead of the current time, so a caught up run does what the missed one would have.
+	ScheduledAt time.Time
+	// Manual is set for runs triggered by hand, which shouldn't wait for the job's usual time of day
+	Manual bool
+}
+
+// Job is a named task run on a cron schedule
+type Job struct {
+	Name string
+	// Spec is a standard five field cron expression, evaluated in UTC
+	Spec string
+	// CatchUp replays the runs missed while the bot was stopped when the scheduler starts
+	CatchUp bool
+	Run     func(ctx context.Context, run Run) error
+}
+
+// Store persists the last successful run of each job
+type Store interface {
+	GetLastScheduledRun(ctx context.Context, job string) (int64, error)
+	RecordScheduledRun(ctx context.Context, job string, scheduledAtUnix int64, finishedAtUnix int64) error
+}
+
+// Status describes a job for the /jobs command
+type Status struct {
+	Name    string
+	Spec    string
+	LastRun time.Time // zero when the job never ran
+	NextRun time.Time
+}
+
+type entry struct {
+	Job
+	schedule cron.Schedule
+	// running keeps a job from overlapping with itself, e.g. a manual run with a scheduled one
+	running sync.Mutex
+}
+
+// Scheduler runs every job in a single cron and remembers when each last succeeded
+type Scheduler struct {
+	store Store
+	cron  *cron.Cron
+	jobs  []*entry
+	now   func() time.Time
+
+	// caughtUp is closed once the runs missed while the bot was stopped are replayed, scheduled runs wait for it
+	caughtUp chan struct{}
+	// catchingUp tracks the catch-up, so Stop can wait for it
+	catchingUp sync.WaitGroup
+	// stopping is closed by Stop, the catch-up gives up on the runs it hasn't replayed yet
+	stopping chan struct{}
+}
+
+// New checks the jobs' specs and names, the jobs only start running with Start
+func New(store Store, jobs []Job) (*Scheduler, error) {
+	s := &Scheduler{
+		store: store,
+		cron:  cron.New(cron.WithLocation(time.UTC)),
+		now:   time.Now,
+
+		caughtUp: make(chan struct{}),
+		stopping: make(chan struct{}),
+	}
+
+	names := make(map[string]bool)
+	for _, job := range jobs {
+		if names[job.Name] {
+			return nil, fmt.Errorf("job %q is scheduled twice", job.Name)
+		}
+		names[job.Name] = true
+
+		schedule, err := cron.ParseStandard(job.Spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q for job %q: %w", job.Spec, job.Name, err)
+		}
+		s.jobs = append(s.jobs, &entry{Job: job, schedule: schedule})
+	}
+	return s, nil
+}
+
+// Start runs every job on its schedule until Stop. It returns right away, catching up on missed runs in the
+// background, and scheduled runs only start once the catch-up is done so they don't overtake it.
+func (s *Scheduler) Start(ctx context.Context) {
+	s.catchingUp.Add(1)
+	go func() {
+		defer s.catchingUp.Done()
+		defer close(s.caughtUp)
+		s.CatchUp(ctx)
+	}()
+
+	for _, e := range s.jobs {
+		e := e
+		s.cron.Schedule(e.schedule, cron.FuncJob(func() {
+			select {
+			case <-s.caughtUp:
+			case <-s.stopping:
+				return
+			}
+			// Cron fires on the minute it was scheduled for
+			scheduledAt := s.now().UTC().Truncate(time.Minute)
+			if err := s.run(ctx, e, Run{ScheduledAt: scheduledAt}); err != nil {
+				slog.ErrorContext(ctx, "Scheduled job failed", "job", e.Name, "error", err)
+			}
+		}))
+	}
+	s.cron.Start()
+}
+
+// Stop stops scheduling runs and catching up, the returned context is done once running jobs finish
+func (s *Scheduler) Stop() context.Context {
+	close(s.stopping)
+	cronStopped := s.cron.Stop()
+
+	ctx, done := context.WithCancel(context.Background())
+	go func() {
+		<-cronStopped.Done()
+		s.catchingUp.Wait()
+		done()
+	}()
+	return ctx
+}
+
+// CatchUp replays, in order, the runs of catch-up jobs that were due since their last successful run.
+// A job that never ran only starts counting from now, so a fresh deploy doesn't replay a week of announcements.
+func (s *Scheduler) CatchUp(ctx context.Context) {
+	now := s.now().UTC()
+	for _, e := range s.jobs {
+		if !e.CatchUp {
+			continue
+		}
+
+		lastUnix, err := s.store.GetLastScheduledRun(ctx, e.Name)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to get the last run of job, not catching up", "job", e.Name, "error", err)
+			continue
+		}
+		if lastUnix == 0 {
+			if err := s.store.RecordScheduledRun(ctx, e.Name, now.Unix(), now.Unix()); err != nil {
+				slog.ErrorContext(ctx, "Failed to record the first run of job", "job", e.Name, "error", err)
+			}
+			continue
+		}
+
+		from := time.Unix(lastUnix, 0).UTC()
+		if oldest := now.Add(-maxCatchUp); from.Before(oldest) {
+			slog.WarnContext(ctx, "Job last ran too long ago, only catching up on the most recent runs", "job", e.Name, "last_run", from, "max_catch_up", maxCatchUp)
+			from = oldest
+		}
+
+		for due := e.schedule.Next(from); !due.After(now); due = e.schedule.Next(due) {
+			if isClosed(s.stopping) {
+				// The next start picks up from the last run that was replayed
+				slog.InfoContext(ctx, "Stopping, not catching up on the remaining runs", "job", e.Name, "scheduled_at", due)
+				return
+			}
+			slog.InfoContext(ctx, "Catching up on missed job run", "job", e.Name, "scheduled_at", due)
+			if err := s.run(ctx, e, Run{ScheduledAt: due}); err != nil {
+				// Stop here so the next start retries from the failed run
+				slog.ErrorContext(ctx, "Catching up on job failed", "job", e.Name, "scheduled_at", due, "error", err)
+				break
+			}
+		}
+	}
+}
+
+// isClosed reports whether ch was closed, without waiting
+func isClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// Trigger runs a job right away, as a manual run
+func (s *Scheduler) Trigger(ctx context.Context, name string) error {
+	for _, e := range s.jobs {
+		if e.Name == name {
+			return s.run(ctx, e, Run{ScheduledAt: s.now().UTC(), Manual: true})
+		}
+	}
+	return fmt.Errorf("%w %q", ErrUnknownJob, name)
+}
+
+// Jobs returns every job with its last and next run
+func (s *Scheduler) Jobs(ctx context.Context) ([]Status, error) {
+	now := s.now().UTC()
+	var statuses []Status
+	for _, e := range s.jobs {
+		lastUnix, err := s.store.GetLastScheduledRun(ctx, e.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the last run of job %s: %w", e.Name, err)
+		}
+
+		status := Status{Name: e.Name, Spec: e.Spec, NextRun: e.schedule.Next(now)}
+		if lastUnix != 0 {
+			status.LastRun = time.Unix(lastUnix, 0).UTC()
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// run runs a job and records it when it succeeds. Manual runs aren't recorded, they don't stand in for a scheduled one.
+func (s *Scheduler) run(ctx context.Context, e *entry, run Run) error {
+	e.running.Lock()
+	defer e.running.Unlock()
+
+	// Everything the job logs says which job it was
+	ctx = logging.With(ctx, slog.String("job", e.Name))
+	if err := e.Run(ctx, run); err != nil {
+		return err
+	}
+	if run.Manual {
+		return nil
+	}
+	return s.store.RecordScheduledRun(ctx, e.Name, run.ScheduledAt.Unix(), s.now().Unix())
+}
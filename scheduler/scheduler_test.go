@@ -0,0 +1,266 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryStore keeps last runs in memory
+type memoryStore struct {
+	mu   sync.Mutex
+	runs map[string]int64
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{runs: make(map[string]int64)}
+}
+
+func (s *memoryStore) GetLastScheduledRun(ctx context.Context, job string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.runs[job], nil
+}
+
+func (s *memoryStore) RecordScheduledRun(ctx context.Context, job string, scheduledAtUnix int64, finishedAtUnix int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if scheduledAtUnix > s.runs[job] {
+		s.runs[job] = scheduledAtUnix
+	}
+	return nil
+}
+
+// recordingJob is an hourly job that remembers its runs
+func recordingJob(name string, catchUp bool, runs *[]Run, fail func(Run) bool) Job {
+	return Job{
+		Name:    name,
+		Spec:    "0 * * * *",
+		CatchUp: catchUp,
+		Run: func(ctx context.Context, run Run) error {
+			*runs = append(*runs, run)
+			if fail != nil && fail(run) {
+				return errors.New("boom")
+			}
+			return nil
+		},
+	}
+}
+
+func newTestScheduler(t *testing.T, store Store, now time.Time, jobs ...Job) *Scheduler {
+	t.Helper()
+	s, err := New(store, jobs)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	s.now = func() time.Time { return now }
+	return s
+}
+
+func TestCatchUp_ReplaysMissedRuns(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+	store.runs["announcements"] = time.Date(2025, 3, 31, 22, 0, 0, 0, time.UTC).Unix()
+	store.runs["checkins"] = time.Date(2025, 3, 31, 22, 0, 0, 0, time.UTC).Unix()
+
+	var announcements, checkins []Run
+	now := time.Date(2025, 4, 1, 1, 30, 0, 0, time.UTC)
+	s := newTestScheduler(t, store, now,
+		recordingJob("announcements", true, &announcements, nil),
+		recordingJob("checkins", false, &checkins, nil),
+	)
+
+	s.CatchUp(ctx)
+
+	want := []time.Time{
+		time.Date(2025, 3, 31, 23, 0, 0, 0, time.UTC),
+		time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2025, 4, 1, 1, 0, 0, 0, time.UTC),
+	}
+	if len(announcements) != len(want) {
+		t.Fatalf("CatchUp() ran %+v, want the runs at %v", announcements, want)
+	}
+	for i := range want {
+		if !announcements[i].ScheduledAt.Equal(want[i]) || announcements[i].Manual {
+			t.Errorf("run %d = %+v, want scheduled at %s", i, announcements[i], want[i])
+		}
+	}
+	if len(checkins) != 0 {
+		t.Errorf("CatchUp() ran %d runs of a job without catch-up", len(checkins))
+	}
+	if last := store.runs["announcements"]; last != want[2].Unix() {
+		t.Errorf("last run = %d, want %d", last, want[2].Unix())
+	}
+
+	// Restarting right after doesn't run anything twice
+	announcements = nil
+	s.CatchUp(ctx)
+	if len(announcements) != 0 {
+		t.Errorf("second CatchUp() ran %+v, want nothing", announcements)
+	}
+}
+
+func TestCatchUp_StopsAtFailedRun(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+	store.runs["announcements"] = time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC).Unix()
+
+	var runs []Run
+	failing := time.Date(2025, 4, 1, 2, 0, 0, 0, time.UTC)
+	s := newTestScheduler(t, store, time.Date(2025, 4, 1, 3, 30, 0, 0, time.UTC),
+		recordingJob("announcements", true, &runs, func(run Run) bool { return run.ScheduledAt.Equal(failing) }),
+	)
+
+	s.CatchUp(ctx)
+
+	if len(runs) != 2 {
+		t.Fatalf("CatchUp() ran %+v, want to stop at the failed run", runs)
+	}
+	if last := store.runs["announcements"]; last != time.Date(2025, 4, 1, 1, 0, 0, 0, time.UTC).Unix() {
+		t.Errorf("last run = %d, want the run before the failure", last)
+	}
+}
+
+func TestCatchUp_NeverRanStartsFromNow(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+
+	var runs []Run
+	now := time.Date(2025, 4, 1, 3, 30, 0, 0, time.UTC)
+	s := newTestScheduler(t, store, now, recordingJob("announcements", true, &runs, nil))
+
+	s.CatchUp(ctx)
+
+	if len(runs) != 0 {
+		t.Errorf("CatchUp() of a job that never ran made %+v, want nothing", runs)
+	}
+	if last := store.runs["announcements"]; last != now.Unix() {
+		t.Errorf("last run = %d, want now", last)
+	}
+}
+
+func TestCatchUp_LimitsHowFarBack(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+	store.runs["announcements"] = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC).Unix()
+
+	var runs []Run
+	s := newTestScheduler(t, store, time.Date(2025, 4, 1, 0, 30, 0, 0, time.UTC), recordingJob("announcements", true, &runs, nil))
+
+	s.CatchUp(ctx)
+
+	if len(runs) != int(maxCatchUp/time.Hour) {
+		t.Errorf("CatchUp() made %d runs, want %d", len(runs), int(maxCatchUp/time.Hour))
+	}
+}
+
+func TestStart_CatchesUpInTheBackground(t *testing.T) {
+	store := newMemoryStore()
+	store.runs["announcements"] = time.Date(2025, 3, 31, 0, 0, 0, 0, time.UTC).Unix()
+
+	started, release := make(chan struct{}), make(chan struct{})
+	var runs []Run
+	s := newTestScheduler(t, store, time.Date(2025, 4, 1, 0, 30, 0, 0, time.UTC), Job{
+		Name:    "announcements",
+		Spec:    "0 * * * *",
+		CatchUp: true,
+		Run: func(ctx context.Context, run Run) error {
+			if len(runs) == 0 {
+				close(started)
+				<-release
+			}
+			runs = append(runs, run)
+			return nil
+		},
+	})
+
+	// Start doesn't wait for the 24 missed runs
+	returned := make(chan struct{})
+	go func() {
+		s.Start(context.Background())
+		close(returned)
+	}()
+	<-started
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Fatal("Start() waited for the catch-up")
+	}
+
+	// Stopping waits for the run in progress and skips the rest
+	stopped := s.Stop()
+	close(release)
+	select {
+	case <-stopped.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Stop() didn't finish after the catch-up stopped")
+	}
+	if len(runs) != 1 {
+		t.Errorf("catch-up made %d runs after stopping, want only the one in progress", len(runs))
+	}
+	if last := store.runs["announcements"]; last != time.Date(2025, 3, 31, 1, 0, 0, 0, time.UTC).Unix() {
+		t.Errorf("last run = %d, want the run that was replayed", last)
+	}
+}
+
+func TestTrigger(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+
+	var runs []Run
+	now := time.Date(2025, 4, 1, 3, 30, 0, 0, time.UTC)
+	s := newTestScheduler(t, store, now, recordingJob("announcements", true, &runs, nil))
+
+	if err := s.Trigger(ctx, "announcements"); err != nil {
+		t.Fatalf("Trigger() error = %v", err)
+	}
+	if len(runs) != 1 || !runs[0].Manual || !runs[0].ScheduledAt.Equal(now) {
+		t.Errorf("Trigger() ran %+v, want one manual run now", runs)
+	}
+	if _, ok := store.runs["announcements"]; ok {
+		t.Error("Trigger() recorded a manual run as the last scheduled run")
+	}
+
+	if err := s.Trigger(ctx, "nope"); !errors.Is(err, ErrUnknownJob) {
+		t.Errorf("Trigger() of an unknown job error = %v, want ErrUnknownJob", err)
+	}
+}
+
+func TestJobs(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+	lastRun := time.Date(2025, 4, 1, 3, 0, 0, 0, time.UTC)
+	store.runs["announcements"] = lastRun.Unix()
+
+	var runs []Run
+	s := newTestScheduler(t, store, time.Date(2025, 4, 1, 3, 30, 0, 0, time.UTC),
+		recordingJob("announcements", true, &runs, nil),
+		recordingJob("checkins", false, &runs, nil),
+	)
+
+	statuses, err := s.Jobs(ctx)
+	if err != nil {
+		t.Fatalf("Jobs() error = %v", err)
+	}
+	if len(statuses) != 2 || statuses[0].Name != "announcements" || statuses[1].Name != "checkins" {
+		t.Fatalf("Jobs() = %+v, want both jobs in order", statuses)
+	}
+	if !statuses[0].LastRun.Equal(lastRun) || !statuses[1].LastRun.IsZero() {
+		t.Errorf("Jobs() last runs = %s, %s, want %s and never", statuses[0].LastRun, statuses[1].LastRun, lastRun)
+	}
+	if want := time.Date(2025, 4, 1, 4, 0, 0, 0, time.UTC); !statuses[0].NextRun.Equal(want) {
+		t.Errorf("Jobs() next run = %s, want %s", statuses[0].NextRun, want)
+	}
+}
+
+func TestNew_RejectsBadJobs(t *testing.T) {
+	run := func(ctx context.Context, run Run) error { return nil }
+	if _, err := New(newMemoryStore(), []Job{{Name: "a", Spec: "not a spec", Run: run}}); err == nil {
+		t.Error("New() accepted an invalid spec")
+	}
+	if _, err := New(newMemoryStore(), []Job{{Name: "a", Spec: "0 * * * *", Run: run}, {Name: "a", Spec: "30 * * * *", Run: run}}); err == nil {
+		t.Error("New() accepted a job scheduled twice")
+	}
+}
@@ -0,0 +1,314 @@
+// Package telegramtest provides a local stand-in for the Telegram Bot API, for end-to-end tests.
+// Updates are scripted with Push and handed out by getUpdates, every other request is recorded so tests can assert on it.
+package telegramtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tg_bot "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Token is the bot token the server expects, requests for any other token are rejected like Telegram would
+const Token = "123456:TEST"
+
+// BotUser is who the server claims the bot is in getMe
+var BotUser = tg_bot.User{ID: 123456, IsBot: true, FirstName: "Poop Bot", UserName: "poop_bot"}
+
+// maxPollWait caps how long getUpdates waits for new updates, so stopping the bot doesn't hang on a long poll
+const maxPollWait = 100 * time.Millisecond
+
+// Request is a Bot API call the server received
+type Request struct {
+	Method string
+	Params map[string]string
+	// Files maps the field names of uploaded files to their names
+	Files map[string]string
+}
+
+// Server is a fake Bot API listening on a local port
+type Server struct {
+	server *httptest.Server
+
+	mu            sync.Mutex
+	requests      []Request
+	updates       []tg_bot.Update
+	nextUpdateID  int
+	nextMessageID int
+	failures      map[string]string
+	newActivity   chan struct{}
+	closed        chan struct{}
+}
+
+// NewServer starts a fake Bot API, callers must Close it
+func NewServer() *Server {
+	s := &Server{
+		nextUpdateID:  1,
+		nextMessageID: 1000,
+		failures:      make(map[string]string),
+		newActivity:   make(chan struct{}),
+		closed:        make(chan struct{}),
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// URL is the root of the fake API
+func (s *Server) URL() string {
+	return s.server.URL
+}
+
+// APIBaseURL is the value for cfg.APIBaseURL that points the bot at the server
+func (s *Server) APIBaseURL() string {
+	return s.server.URL + "/bot"
+}
+
+func (s *Server) Close() {
+	close(s.closed)
+	s.server.Close()
+}
+
+// Push queues updates for getUpdates, numbering the ones without an update ID
+func (s *Server) Push(updates ...tg_bot.Update) {
+	s.mu.Lock()
+	for _, update := range updates {
+		if update.UpdateID == 0 {
+			update.UpdateID = s.nextUpdateID
+		}
+		s.nextUpdateID = update.UpdateID + 1
+		s.updates = append(s.updates, update)
+	}
+	s.notifyLocked()
+	s.mu.Unlock()
+}
+
+// Fail makes every later call to method fail with a Bad Request carrying description
+func (s *Server) Fail(method string, description string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[method] = description
+}
+
+// Requests returns the received requests in order, leaving out getMe and getUpdates
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	requests := make([]Request, len(s.requests))
+	copy(requests, s.requests)
+	return requests
+}
+
+// RequestsTo returns the received requests of a single method
+func (s *Server) RequestsTo(method string) []Request {
+	var requests []Request
+	for _, request := range s.Requests() {
+		if request.Method == method {
+			requests = append(requests, request)
+		}
+	}
+	return requests
+}
+
+// Reset forgets the received requests
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = nil
+}
+
+// WaitForRequests waits until n requests were received and returns them, or returns what arrived when timeout runs out
+func (s *Server) WaitForRequests(n int, timeout time.Duration) ([]Request, error) {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		s.mu.Lock()
+		received := len(s.requests)
+		activity := s.newActivity
+		s.mu.Unlock()
+
+		if received >= n {
+			return s.Requests(), nil
+		}
+		select {
+		case <-activity:
+		case <-deadline.C:
+			requests := s.Requests()
+			return requests, fmt.Errorf("received %d requests, want %d: %v", len(requests), n, requests)
+		}
+	}
+}
+
+// WaitForUpdatesConsumed waits until the bot confirmed every pushed update by polling past it
+func (s *Server) WaitForUpdatesConsumed(timeout time.Duration) error {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		s.mu.Lock()
+		pending := len(s.updates)
+		activity := s.newActivity
+		s.mu.Unlock()
+
+		if pending == 0 {
+			return nil
+		}
+		select {
+		case <-activity:
+		case <-deadline.C:
+			return fmt.Errorf("%d updates were never consumed", pending)
+		}
+	}
+}
+
+// notifyLocked wakes up everyone waiting for requests or updates, s.mu must be held
+func (s *Server) notifyLocked() {
+	close(s.newActivity)
+	s.newActivity = make(chan struct{})
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	token, method, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/bot"), "/")
+	if !ok || token != Token {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	request, err := parseRequest(method, r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Bad Request: "+err.Error())
+		return
+	}
+
+	switch method {
+	case "getMe":
+		writeResult(w, BotUser)
+		return
+	case "getUpdates":
+		writeResult(w, s.pollUpdates(request.Params))
+		return
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, request)
+	description, fail := s.failures[method]
+	s.notifyLocked()
+	s.mu.Unlock()
+
+	if fail {
+		writeError(w, http.StatusBadRequest, "Bad Request: "+description)
+		return
+	}
+
+	switch method {
+	case "sendMessage", "sendPhoto", "sendDocument", "editMessageText":
+		writeResult(w, s.message(request))
+	case "sendMediaGroup":
+		var media []json.RawMessage
+		json.Unmarshal([]byte(request.Params["media"]), &media)
+		messages := make([]tg_bot.Message, 0, len(media))
+		for range media {
+			messages = append(messages, s.message(request))
+		}
+		writeResult(w, messages)
+	default:
+		writeResult(w, true)
+	}
+}
+
+// pollUpdates confirms the updates before offset and returns the rest, waiting briefly for new ones like a long poll
+func (s *Server) pollUpdates(params map[string]string) []tg_bot.Update {
+	offset, _ := strconv.Atoi(params["offset"])
+
+	s.mu.Lock()
+	confirmed := 0
+	for confirmed < len(s.updates) && s.updates[confirmed].UpdateID < offset {
+		confirmed++
+	}
+	if confirmed > 0 {
+		s.updates = s.updates[confirmed:]
+		s.notifyLocked()
+	}
+	pending, activity := len(s.updates), s.newActivity
+	s.mu.Unlock()
+
+	if pending == 0 {
+		select {
+		case <-activity:
+		case <-time.After(maxPollWait):
+		case <-s.closed:
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	updates := make([]tg_bot.Update, len(s.updates))
+	copy(updates, s.updates)
+	return updates
+}
+
+// message is what Telegram answers a send with, a new message in the requested chat
+func (s *Server) message(request Request) tg_bot.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	chatID, _ := strconv.ParseInt(request.Params["chat_id"], 10, 64)
+	messageID, _ := strconv.Atoi(request.Params["message_id"])
+	if messageID == 0 {
+		messageID = s.nextMessageID
+		s.nextMessageID++
+	}
+
+	return tg_bot.Message{
+		MessageID: messageID,
+		From:      &BotUser,
+		Chat:      &tg_bot.Chat{ID: chatID},
+		Date:      int(time.Now().Unix()),
+		Text:      request.Params["text"],
+	}
+}
+
+func parseRequest(method string, r *http.Request) (Request, error) {
+	request := Request{Method: method, Params: make(map[string]string)}
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := r.ParseMultipartForm(32 << 20); err != nil {
+			return request, err
+		}
+		for field, headers := range r.MultipartForm.File {
+			if request.Files == nil {
+				request.Files = make(map[string]string)
+			}
+			request.Files[field] = headers[0].Filename
+		}
+	} else if err := r.ParseForm(); err != nil {
+		return request, err
+	}
+
+	for key := range r.Form {
+		request.Params[key] = r.Form.Get(key)
+	}
+	return request, nil
+}
+
+type response struct {
+	OK          bool        `json:"ok"`
+	Result      interface{} `json:"result,omitempty"`
+	ErrorCode   int         `json:"error_code,omitempty"`
+	Description string      `json:"description,omitempty"`
+}
+
+func writeResult(w http.ResponseWriter, result interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response{OK: true, Result: result})
+}
+
+func writeError(w http.ResponseWriter, status int, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response{ErrorCode: status, Description: description})
+}
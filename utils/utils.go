@@ -3,6 +3,7 @@ package utils
 import (
 	"fmt"
 	"strconv"
+	"time"
 
 	dotenv "github.com/joho/godotenv"
 )
@@ -22,3 +23,24 @@ func LoadEnv() error {
 	}
 	return nil
 }
+
+// PoopEmoji is the message, or sticker emoji, that logs a poop
+const PoopEmoji = "💩"
+
+// IsPoop reports whether a message logs a poop, stickerEmoji is empty for messages that aren't stickers.
+// The live bot and the backfill importer share it so both count the same messages.
+func IsPoop(text string, stickerEmoji string) bool {
+	return text == PoopEmoji || stickerEmoji == PoopEmoji
+}
+
+// ValidateTimezone checks that timezone is a known IANA timezone name.
+// Unlike time.LoadLocation it rejects "" and "Local", which would silently mean UTC or the server's zone.
+func ValidateTimezone(timezone string) error {
+	if timezone == "" || timezone == "Local" {
+		return fmt.Errorf("invalid timezone %q", timezone)
+	}
+	if _, err := time.LoadLocation(timezone); err != nil {
+		return fmt.Errorf("invalid timezone %q: %w", timezone, err)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package wrapped
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"sync"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/image/vector"
+)
+
+type fontStyle int
+
+const (
+	regular fontStyle = iota
+	bold
+	italic
+)
+
+var (
+	fontsOnce sync.Once
+	fonts     map[fontStyle]*opentype.Font
+	fontsErr  error
+)
+
+// loadFonts parses the embedded Go fonts once
+func loadFonts() (map[fontStyle]*opentype.Font, error) {
+	fontsOnce.Do(func() {
+		sources := map[fontStyle][]byte{
+			regular: goregular.TTF,
+			bold:    gobold.TTF,
+			italic:  goitalic.TTF,
+		}
+
+		fonts = make(map[fontStyle]*opentype.Font, len(sources))
+		for style, ttf := range sources {
+			f, err := opentype.Parse(ttf)
+			if err != nil {
+				fontsErr = fmt.Errorf("failed to parse embedded font: %w", err)
+				return
+			}
+			fonts[style] = f
+		}
+	})
+	return fonts, fontsErr
+}
+
+// canvas is a single slide being drawn
+type canvas struct {
+	img   *image.RGBA
+	fonts map[fontStyle]*opentype.Font
+}
+
+func newCanvas(background color.Color) (*canvas, error) {
+	loaded, err := loadFonts()
+	if err != nil {
+		return nil, err
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, SlideWidth, SlideHeight))
+	draw.Draw(img, img.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+	return &canvas{img: img, fonts: loaded}, nil
+}
+
+// text draws a line of text horizontally centred on the slide and vertically centred on y,
+// where y is a fraction of the slide height measured from the bottom like the original matplotlib slides
+func (c *canvas) text(s string, y float64, size float64, style fontStyle, col color.Color) error {
+	face, err := opentype.NewFace(c.fonts[style], &opentype.FaceOptions{
+		Size:    size,
+		DPI:     72,
+		Hinting: font.HintingFull,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create font face: %w", err)
+	}
+	defer face.Close()
+
+	drawer := &font.Drawer{
+		Dst:  c.img,
+		Src:  image.NewUniform(col),
+		Face: face,
+	}
+
+	metrics := face.Metrics()
+	width := drawer.MeasureString(s)
+	centreY := fixed.I(int(math.Round(float64(SlideHeight) * (1 - y))))
+
+	drawer.Dot = fixed.Point26_6{
+		X: (fixed.I(SlideWidth) - width) / 2,
+		Y: centreY + (metrics.Ascent-metrics.Descent)/2,
+	}
+	drawer.DrawString(s)
+	return nil
+}
+
+// ellipse fills an anti-aliased ellipse centred on (cx, cy) in pixels
+func (c *canvas) ellipse(cx, cy, rx, ry float64, col color.Color) {
+	// Control point distance that best approximates a quarter ellipse with a cubic Bézier curve
+	const k = 0.5522847498
+
+	r := vector.NewRasterizer(SlideWidth, SlideHeight)
+	r.MoveTo(float32(cx+rx), float32(cy))
+	r.CubeTo(float32(cx+rx), float32(cy+k*ry), float32(cx+k*rx), float32(cy+ry), float32(cx), float32(cy+ry))
+	r.CubeTo(float32(cx-k*rx), float32(cy+ry), float32(cx-rx), float32(cy+k*ry), float32(cx-rx), float32(cy))
+	r.CubeTo(float32(cx-rx), float32(cy-k*ry), float32(cx-k*rx), float32(cy-ry), float32(cx), float32(cy-ry))
+	r.CubeTo(float32(cx+k*rx), float32(cy-ry), float32(cx+rx), float32(cy-k*ry), float32(cx+rx), float32(cy))
+	r.ClosePath()
+	r.Draw(c.img, c.img.Bounds(), image.NewUniform(col), image.Point{})
+}
+
+// poop draws the 💩 mascot centred on (cx, cy), since the embedded fonts have no emoji glyphs
+func (c *canvas) poop(cx, cy, size float64) {
+	brown := color.RGBA{0x8b, 0x5a, 0x2b, 0xff}
+	darkBrown := color.RGBA{0x6b, 0x42, 0x1e, 0xff}
+	white := color.RGBA{0xff, 0xff, 0xff, 0xff}
+	black := color.RGBA{0x19, 0x14, 0x14, 0xff}
+
+	// Three stacked swirls topped by a tip, each slightly offset for a darker outline
+	c.ellipse(cx, cy+0.32*size, 0.52*size, 0.2*size, darkBrown)
+	c.ellipse(cx, cy+0.3*size, 0.5*size, 0.18*size, brown)
+	c.ellipse(cx, cy+0.06*size, 0.4*size, 0.17*size, darkBrown)
+	c.ellipse(cx, cy+0.04*size, 0.38*size, 0.15*size, brown)
+	c.ellipse(cx, cy-0.17*size, 0.27*size, 0.14*size, darkBrown)
+	c.ellipse(cx, cy-0.19*size, 0.25*size, 0.12*size, brown)
+	c.ellipse(cx+0.04*size, cy-0.34*size, 0.11*size, 0.09*size, brown)
+
+	// Eyes
+	c.ellipse(cx-0.14*size, cy+0.02*size, 0.08*size, 0.09*size, white)
+	c.ellipse(cx+0.14*size, cy+0.02*size, 0.08*size, 0.09*size, white)
+	c.ellipse(cx-0.12*size, cy+0.04*size, 0.04*size, 0.05*size, black)
+	c.ellipse(cx+0.16*size, cy+0.04*size, 0.04*size, 0.05*size, black)
+
+	// Smile
+	c.ellipse(cx, cy+0.27*size, 0.16*size, 0.07*size, black)
+	c.ellipse(cx, cy+0.24*size, 0.17*size, 0.05*size, brown)
+}
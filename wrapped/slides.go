@@ -0,0 +1,129 @@
+// Package wrapped renders the Poop Wrapped slides as PNG images.
+package wrapped
+
+import (
+	"bytes"
+	"fmt"
+	"image/color"
+	"image/png"
+
+	repo "src/repository"
+)
+
+// Slide dimensions in pixels
+const (
+	SlideWidth  = 1200
+	SlideHeight = 800
+)
+
+var (
+	backgroundColor = color.RGBA{0x19, 0x14, 0x14, 0xff}
+	accentColor     = color.RGBA{0x1d, 0xb9, 0x54, 0xff}
+	textColor       = color.RGBA{0xff, 0xff, 0xff, 0xff}
+)
+
+type PersonalWrappedStats struct {
+	UserID           int64
+	Username         string
+	Year             int
+	TotalPoops       int
+	GroupTotal       int
+	GroupRank        repo.YearlyRanking
+	MaxStreak        int
+	DayWithMostPoops string
+	MostPoopsCount   int
+	DaysWithoutPoop  int
+}
+
+// Slide is a rendered slide, Name is a file name suitable for uploading it
+type Slide struct {
+	Name string
+	PNG  []byte
+}
+
+type slideRenderer struct {
+	name   string
+	render func(c *canvas, stats PersonalWrappedStats) error
+}
+
+var personalSlides = []slideRenderer{
+	{"slide_01_title.png", renderTitleSlide},
+	{"slide_02_total.png", renderTotalSlide},
+	{"slide_03_streak.png", renderStreakSlide},
+	{"slide_04_extreme.png", renderExtremeDaySlide},
+	{"slide_05_ranking.png", renderRankingSlide},
+}
+
+// RenderPersonalWrapped draws every slide of a personal Poop Wrapped, in the order they should be sent
+func RenderPersonalWrapped(stats PersonalWrappedStats) ([]Slide, error) {
+	slides := make([]Slide, 0, len(personalSlides))
+	for _, s := range personalSlides {
+		c, err := newCanvas(backgroundColor)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := s.render(c, stats); err != nil {
+			return nil, fmt.Errorf("failed to render %s: %w", s.name, err)
+		}
+
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, c.img); err != nil {
+			return nil, fmt.Errorf("failed to encode %s: %w", s.name, err)
+		}
+		slides = append(slides, Slide{Name: s.name, PNG: buf.Bytes()})
+	}
+	return slides, nil
+}
+
+func renderTitleSlide(c *canvas, stats PersonalWrappedStats) error {
+	if err := c.text(fmt.Sprintf("Your Poop Wrapped %d", stats.Year), 0.65, 72, bold, textColor); err != nil {
+		return err
+	}
+	c.poop(SlideWidth/2, SlideHeight*0.62, 260)
+	return nil
+}
+
+func renderTotalSlide(c *canvas, stats PersonalWrappedStats) error {
+	if err := c.text(fmt.Sprint(stats.TotalPoops), 0.7, 140, bold, accentColor); err != nil {
+		return err
+	}
+	if err := c.text("Total dumps", 0.5, 56, regular, textColor); err != nil {
+		return err
+	}
+	if stats.GroupRank.TotalUsers > 0 {
+		return c.text(fmt.Sprintf("That's more than %.1f%% of the group", stats.GroupRank.Percentage), 0.3, 40, italic, textColor)
+	}
+	return nil
+}
+
+func renderStreakSlide(c *canvas, stats PersonalWrappedStats) error {
+	if err := c.text(fmt.Sprint(stats.MaxStreak), 0.7, 140, bold, accentColor); err != nil {
+		return err
+	}
+	if err := c.text("Longest streak", 0.5, 56, regular, textColor); err != nil {
+		return err
+	}
+	return c.text("Your bowels respect routine", 0.3, 40, italic, textColor)
+}
+
+func renderExtremeDaySlide(c *canvas, stats PersonalWrappedStats) error {
+	if err := c.text(fmt.Sprint(stats.MostPoopsCount), 0.7, 140, bold, accentColor); err != nil {
+		return err
+	}
+	if err := c.text(fmt.Sprintf("poops on %s", stats.DayWithMostPoops), 0.5, 56, regular, textColor); err != nil {
+		return err
+	}
+	return c.text("Your wildest day", 0.3, 40, italic, textColor)
+}
+
+func renderRankingSlide(c *canvas, stats PersonalWrappedStats) error {
+	if stats.GroupRank.TotalUsers == 0 {
+		return c.text("Ranking unavailable", 0.6, 56, regular, textColor)
+	}
+
+	if err := c.text(fmt.Sprintf("#%d", stats.GroupRank.Rank), 0.7, 140, bold, accentColor); err != nil {
+		return err
+	}
+	return c.text(fmt.Sprintf("out of %d poopers", stats.GroupRank.TotalUsers), 0.5, 56, regular, textColor)
+}
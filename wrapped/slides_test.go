@@ -0,0 +1,135 @@
+package wrapped
+
+import (
+	"bytes"
+	"flag"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	repo "src/repository"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden slide images in testdata")
+
+func testStats() PersonalWrappedStats {
+	return PersonalWrappedStats{
+		UserID:           1001,
+		Username:         "alice",
+		Year:             2025,
+		TotalPoops:       412,
+		GroupTotal:       6,
+		GroupRank:        repo.YearlyRanking{Rank: 2, TotalUsers: 6, Percentage: 66.7},
+		MaxStreak:        19,
+		DayWithMostPoops: "2025-03-14",
+		MostPoopsCount:   6,
+		DaysWithoutPoop:  12,
+	}
+}
+
+func decodePNG(t *testing.T, data []byte) image.Image {
+	t.Helper()
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to decode PNG: %v", err)
+	}
+	return img
+}
+
+// samePixels compares two images pixel by pixel, ignoring how they were encoded
+func samePixels(a, b image.Image) bool {
+	if a.Bounds() != b.Bounds() {
+		return false
+	}
+	for y := a.Bounds().Min.Y; y < a.Bounds().Max.Y; y++ {
+		for x := a.Bounds().Min.X; x < a.Bounds().Max.X; x++ {
+			r1, g1, b1, a1 := a.At(x, y).RGBA()
+			r2, g2, b2, a2 := b.At(x, y).RGBA()
+			if r1 != r2 || g1 != g2 || b1 != b2 || a1 != a2 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func checkGolden(t *testing.T, dir string, slides []Slide) {
+	t.Helper()
+	for _, slide := range slides {
+		golden := filepath.Join("testdata", dir, slide.Name)
+
+		if *update {
+			if err := os.MkdirAll(filepath.Dir(golden), 0755); err != nil {
+				t.Fatalf("Failed to create testdata directory: %v", err)
+			}
+			if err := os.WriteFile(golden, slide.PNG, 0644); err != nil {
+				t.Fatalf("Failed to update golden image: %v", err)
+			}
+			continue
+		}
+
+		want, err := os.ReadFile(golden)
+		if err != nil {
+			t.Fatalf("Failed to read golden image (run go test ./wrapped -update to create it): %v", err)
+		}
+
+		got := decodePNG(t, slide.PNG)
+		if got.Bounds().Dx() != SlideWidth || got.Bounds().Dy() != SlideHeight {
+			t.Errorf("%s is %v, want %dx%d", slide.Name, got.Bounds(), SlideWidth, SlideHeight)
+		}
+		if !samePixels(got, decodePNG(t, want)) {
+			t.Errorf("%s differs from %s, run go test ./wrapped -update if the change is intended", slide.Name, golden)
+		}
+	}
+}
+
+func TestRenderPersonalWrapped(t *testing.T) {
+	slides, err := RenderPersonalWrapped(testStats())
+	if err != nil {
+		t.Fatalf("RenderPersonalWrapped() error = %v", err)
+	}
+
+	wantNames := []string{"slide_01_title.png", "slide_02_total.png", "slide_03_streak.png", "slide_04_extreme.png", "slide_05_ranking.png"}
+	if len(slides) != len(wantNames) {
+		t.Fatalf("RenderPersonalWrapped() returned %d slides, want %d", len(slides), len(wantNames))
+	}
+	for i, slide := range slides {
+		if slide.Name != wantNames[i] {
+			t.Errorf("slide %d name = %s, want %s", i, slide.Name, wantNames[i])
+		}
+	}
+
+	checkGolden(t, "personal", slides)
+}
+
+func TestRenderPersonalWrapped_NoRanking(t *testing.T) {
+	stats := testStats()
+	stats.GroupRank = repo.YearlyRanking{}
+
+	slides, err := RenderPersonalWrapped(stats)
+	if err != nil {
+		t.Fatalf("RenderPersonalWrapped() error = %v", err)
+	}
+
+	// Only the slides that mention the ranking change
+	checkGolden(t, "no_ranking", []Slide{slides[1], slides[4]})
+}
+
+func TestRenderPersonalWrapped_Deterministic(t *testing.T) {
+	first, err := RenderPersonalWrapped(testStats())
+	if err != nil {
+		t.Fatalf("RenderPersonalWrapped() error = %v", err)
+	}
+	second, err := RenderPersonalWrapped(testStats())
+	if err != nil {
+		t.Fatalf("RenderPersonalWrapped() error = %v", err)
+	}
+
+	for i := range first {
+		if !bytes.Equal(first[i].PNG, second[i].PNG) {
+			t.Errorf("%s rendered differently on the second run", first[i].Name)
+		}
+	}
+}